@@ -12,8 +12,12 @@ func main() {
 	// app
 	// - config
 	cfg := &application.ConfigServerChi{
-		ServerAddress: ":8080",
-		LoaderFilePath: "docs/db/vehicles_100.json",
+		ServerAddress:           ":8080",
+		LoaderFilePath:          "docs/db/vehicles_100.json",
+		SnapshotFilePath:        "data/vehicles.json",
+		JournalFilePath:         "data/vehicles.log",
+		HistoryFilePath:         "data/vehicles_history.log",
+		ValidationRulesFilePath: "docs/config/vehicle_rules.json",
 	}
 	app := application.NewServerChi(cfg)
 	// - run
@@ -21,4 +25,4 @@ func main() {
 		fmt.Println(err)
 		return
 	}
-}
\ No newline at end of file
+}
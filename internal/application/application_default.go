@@ -1,11 +1,16 @@
 package application
 
 import (
+	"app/internal"
 	"app/internal/handler"
 	"app/internal/loader"
 	"app/internal/repository"
 	"app/internal/service"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -17,13 +22,51 @@ type ConfigServerChi struct {
 	ServerAddress string
 	// LoaderFilePath is the path to the file that contains the vehicles
 	LoaderFilePath string
+	// SnapshotFilePath is the path to the file where the vehicles are written by PersistChanges and by the
+	// snapshots of the journal, it is loaded instead of the loader file once it exists, so the loader file is only
+	// read, the loader file is written when it is not set
+	SnapshotFilePath string
+	// PersistChanges enables writing every change back to the snapshot file
+	PersistChanges bool
+	// JournalFilePath is the path to the journal where the changes are appended,
+	// when set the snapshot file is written by the compactions and PersistChanges is ignored
+	JournalFilePath string
+	// CompactionInterval is the interval between snapshots of the journal
+	CompactionInterval time.Duration
+	// HistoryFilePath is the path to the file where the versions of the vehicles are written by the compactions
+	// of the journal or after every change with PersistChanges, so the vehicles can be read as of a past time after a
+	// restart, without it they can not be read as of a time before the restart
+	HistoryFilePath string
+	// HistoryRetention is how long the past versions of the vehicles are kept, 365 days by default,
+	// a negative retention keeps them forever
+	HistoryRetention time.Duration
+	// CacheControl is the Cache-Control header of the reads of vehicles, no-cache by default so the clients
+	// revalidate their copies with If-None-Match or If-Modified-Since, set it to "-" to send none
+	CacheControl string
+	// TrashRetention is how long the deleted vehicles are kept in the trash before they are purged,
+	// 30 days by default, a negative retention keeps them until they are purged by hand
+	TrashRetention time.Duration
+	// UniquenessPolicy are the keys no two vehicles can share, only the registration when nil,
+	// an empty policy allows any duplicate
+	UniquenessPolicy internal.UniquenessPolicy
+	// ValidationRulesFilePath is the path to the file that contains the validation rules of the vehicles,
+	// internal.DefaultValidationRules are used when it is not set
+	ValidationRulesFilePath string
+	// ValidationRulesReloadInterval is the interval between reloads of the validation rules file,
+	// so the rules change without a restart
+	ValidationRulesReloadInterval time.Duration
 }
 
 // NewServerChi is a function that returns a new instance of ServerChi
 func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 	// default values
 	defaultConfig := &ConfigServerChi{
-		ServerAddress: ":8080",
+		ServerAddress:                 ":8080",
+		CompactionInterval:            5 * time.Minute,
+		CacheControl:                  "no-cache",
+		TrashRetention:                30 * 24 * time.Hour,
+		HistoryRetention:              365 * 24 * time.Hour,
+		ValidationRulesReloadInterval: 10 * time.Second,
 	}
 	if cfg != nil {
 		if cfg.ServerAddress != "" {
@@ -32,11 +75,54 @@ func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 		if cfg.LoaderFilePath != "" {
 			defaultConfig.LoaderFilePath = cfg.LoaderFilePath
 		}
+		if cfg.SnapshotFilePath != "" {
+			defaultConfig.SnapshotFilePath = cfg.SnapshotFilePath
+		}
+		defaultConfig.PersistChanges = cfg.PersistChanges
+		if cfg.JournalFilePath != "" {
+			defaultConfig.JournalFilePath = cfg.JournalFilePath
+		}
+		if cfg.CompactionInterval > 0 {
+			defaultConfig.CompactionInterval = cfg.CompactionInterval
+		}
+		if cfg.HistoryFilePath != "" {
+			defaultConfig.HistoryFilePath = cfg.HistoryFilePath
+		}
+		if cfg.HistoryRetention != 0 {
+			defaultConfig.HistoryRetention = cfg.HistoryRetention
+		}
+		if cfg.CacheControl != "" {
+			defaultConfig.CacheControl = cfg.CacheControl
+		}
+		if cfg.TrashRetention != 0 {
+			defaultConfig.TrashRetention = cfg.TrashRetention
+		}
+		defaultConfig.UniquenessPolicy = cfg.UniquenessPolicy
+		if cfg.ValidationRulesFilePath != "" {
+			defaultConfig.ValidationRulesFilePath = cfg.ValidationRulesFilePath
+		}
+		if cfg.ValidationRulesReloadInterval > 0 {
+			defaultConfig.ValidationRulesReloadInterval = cfg.ValidationRulesReloadInterval
+		}
+	}
+	if defaultConfig.CacheControl == "-" {
+		defaultConfig.CacheControl = ""
 	}
 
 	return &ServerChi{
-		serverAddress:  defaultConfig.ServerAddress,
-		loaderFilePath: defaultConfig.LoaderFilePath,
+		serverAddress:                 defaultConfig.ServerAddress,
+		loaderFilePath:                defaultConfig.LoaderFilePath,
+		snapshotFilePath:              defaultConfig.SnapshotFilePath,
+		persistChanges:                defaultConfig.PersistChanges,
+		journalFilePath:               defaultConfig.JournalFilePath,
+		compactionInterval:            defaultConfig.CompactionInterval,
+		historyFilePath:               defaultConfig.HistoryFilePath,
+		historyRetention:              defaultConfig.HistoryRetention,
+		cacheControl:                  defaultConfig.CacheControl,
+		trashRetention:                defaultConfig.TrashRetention,
+		uniquenessPolicy:              defaultConfig.UniquenessPolicy,
+		validationRulesFilePath:       defaultConfig.ValidationRulesFilePath,
+		validationRulesReloadInterval: defaultConfig.ValidationRulesReloadInterval,
 	}
 }
 
@@ -46,48 +132,190 @@ type ServerChi struct {
 	serverAddress string
 	// loaderFilePath is the path to the file that contains the vehicles
 	loaderFilePath string
+	// snapshotFilePath is the path to the file where the vehicles are written, the loader file when it is empty
+	snapshotFilePath string
+	// persistChanges enables writing every change back to the snapshot file
+	persistChanges bool
+	// journalFilePath is the path to the journal where the changes are appended
+	journalFilePath string
+	// compactionInterval is the interval between snapshots of the journal
+	compactionInterval time.Duration
+	// historyFilePath is the path to the file where the versions of the vehicles are written
+	historyFilePath string
+	// historyRetention is how long the past versions of the vehicles are kept, negative to keep them
+	historyRetention time.Duration
+	// cacheControl is the Cache-Control header of the reads of vehicles
+	cacheControl string
+	// trashRetention is how long the deleted vehicles are kept in the trash, negative to keep them
+	trashRetention time.Duration
+	// uniquenessPolicy are the keys no two vehicles can share
+	uniquenessPolicy internal.UniquenessPolicy
+	// validationRulesFilePath is the path to the file that contains the validation rules of the vehicles
+	validationRulesFilePath string
+	// validationRulesReloadInterval is the interval between reloads of the validation rules file
+	validationRulesReloadInterval time.Duration
 }
 
 // Run is a method that runs the application
 func (a *ServerChi) Run() (err error) {
 	// dependencies
-	// - loader
+	// - loader, the snapshot replaces the vehicles of the loader file once it was written
+	snapshotFilePath := a.snapshotFilePath
+	if snapshotFilePath == "" {
+		snapshotFilePath = a.loaderFilePath
+	}
 	ld := loader.NewVehicleJSONFile(a.loaderFilePath)
+	if _, statErr := os.Stat(snapshotFilePath); statErr == nil {
+		ld = loader.NewVehicleJSONFile(snapshotFilePath)
+	}
 	db, err := ld.Load()
 	if err != nil {
 		return
 	}
+	// - writer of the snapshots
+	wr := loader.NewVehicleJSONFile(snapshotFilePath)
 	// - repository
-	rp := repository.NewVehicleMap(db, len(db))
+	// the last id is the highest id loaded, ids may have gaps after deletes
+	lastId := 0
+	for id := range db {
+		if id > lastId {
+			lastId = id
+		}
+	}
+	mp := repository.NewVehicleMap(db, lastId, a.uniquenessPolicy)
+	// - the vehicles loaded with the same unique keys are kept, uniqueness is only enforced on the changes
+	for key, values := range mp.Duplicates() {
+		for value, ids := range values {
+			log.Printf("uniqueness: vehicles %v were loaded with the same %s %q", ids, key, value)
+		}
+	}
+	var rp internal.VehicleRepository = mp
+	// - history of the versions of the vehicles written by the stores that persist them, the versions are only kept in
+	// memory without a history file
+	var hs internal.VehicleHistory
+	if a.historyFilePath != "" && (a.journalFilePath != "" || a.persistChanges) {
+		if err = makeDirs(a.historyFilePath); err != nil {
+			return
+		}
+		hsLog := loader.NewVehicleJSONLog(a.historyFilePath)
+		defer hsLog.Close()
+		hs = hsLog
+	}
+	switch {
+	// - append every change to the journal and snapshot it to the loader file
+	case a.journalFilePath != "":
+		if err = makeDirs(snapshotFilePath, a.journalFilePath); err != nil {
+			return
+		}
+		jr := loader.NewVehicleJSONLog(a.journalFilePath)
+		defer jr.Close()
+		rpJournal := repository.NewVehicleMapJournal(mp, jr, hs, wr)
+		if err = rpJournal.Recover(); err != nil {
+			return
+		}
+		// - compact once so the vehicles stamped when they were loaded keep their time after a restart
+		if err = rpJournal.Compact(); err != nil {
+			return
+		}
+		go func() {
+			for range time.Tick(a.compactionInterval) {
+				if err := rpJournal.Compact(); err != nil {
+					log.Println("compaction:", err)
+				}
+			}
+		}()
+		rp = rpJournal
+	// - write every change back to the loader file, and the versions to the history
+	case a.persistChanges:
+		if err = makeDirs(snapshotFilePath); err != nil {
+			return
+		}
+		rpFile := repository.NewVehicleMapFile(mp, wr, hs)
+		if err = rpFile.Recover(); err != nil {
+			return
+		}
+		rp = rpFile
+	}
+	// - the versions before a restart were not kept without a history, so the vehicles can not be read as of then
+	if hs == nil && (a.journalFilePath != "" || a.persistChanges) {
+		mp.PruneVersions(time.Now())
+	}
+	// - forget the versions older than the retention, the next write of the history removes them from it
+	if a.historyRetention > 0 {
+		mp.PruneVersions(time.Now().Add(-a.historyRetention))
+		go func() {
+			for range time.Tick(time.Hour) {
+				mp.PruneVersions(time.Now().Add(-a.historyRetention))
+			}
+		}()
+	}
 	// - service
-	sv := service.NewVehicleDefault(rp)
+	// - audit, kept in memory
+	au := repository.NewAuditMap()
+	// - registration plates, with the built-in formats
+	pl := internal.NewPlateRegistry()
+	// - validation rules, reloaded from their file so they change without a restart
+	vr := internal.NewVehicleValidator(internal.DefaultValidationRules)
+	if a.validationRulesFilePath != "" {
+		rl := loader.NewValidationRulesJSONFile(a.validationRulesFilePath)
+		if err = vr.Reload(rl); err != nil {
+			return
+		}
+		go func() {
+			for range time.Tick(a.validationRulesReloadInterval) {
+				// the current rules are kept while the file is not valid
+				if err := vr.Reload(rl); err != nil {
+					log.Println("validation rules:", err)
+				}
+			}
+		}()
+	}
+	// - vocabularies of the fuel type, the transmission and the color
+	vc := internal.DefaultVocabularies
+	sv := service.NewVehicleDefault(rp, au, pl, vr, vc)
+	// - canonicalize the values of the vehicles saved before they had a vocabulary, the trash too, nothing is changed
+	// once they are, the vehicles that can not be changed are kept as they were loaded
+	canonicalized, err := sv.As("enum-migration").Canonicalize()
+	if err != nil {
+		log.Println("enum migration:", err)
+		err = nil
+	}
+	if canonicalized > 0 {
+		log.Printf("enum migration: %d vehicles canonicalized", canonicalized)
+	}
+	// - purge the trash, checked at most every hour so a short retention is still honored
+	if a.trashRetention > 0 {
+		interval := min(a.trashRetention, time.Hour)
+		purger := sv.As("trash-retention")
+		go func() {
+			for range time.Tick(interval) {
+				if _, err := purger.PurgeTrash(time.Now().Add(-a.trashRetention)); err != nil {
+					log.Println("trash retention:", err)
+				}
+			}
+		}()
+	}
 	// - handler
-	hd := handler.NewVehicleDefault(sv)
+	hd := handler.NewVehicleDefault(sv, a.cacheControl)
 	// router
 	rt := chi.NewRouter()
 	// - middlewares
 	rt.Use(middleware.Logger)
 	rt.Use(middleware.Recoverer)
-	// - endpoints
-	rt.Route("/vehicles", func(rt chi.Router) {
-		// - GET /vehicles
-		rt.Get("/", hd.GetAll())
-		rt.Post("/", hd.Save())
-		rt.Get("/color/{color}/year/{year}", hd.FindByColorAndYear())
-		rt.Get("/brand/{brand}/between/{start_year}/{end_year}", hd.FindByBrandAndYearRange())
-		rt.Get("/average_speed/brand/{brand}", hd.VelocityAveragebyBrand())
-		rt.Post("/batch", hd.SaveMany())
-		rt.Patch("/{id}/update_speed", hd.UpdateMaxSpeed())
-		rt.Get("/fuel_type/{type}", hd.FindByFuelType())
-		rt.Delete("/{id}", hd.Delete())
-		rt.Get("/transmission/{type}", hd.FindByTransmission())
-		rt.Get("/average_capacity/brand/{brand}", hd.CapacityAveragebyBrand())
-		rt.Patch("/{id}/update_fuel", hd.UpdateFuelType())
-		rt.Get("/dimensions", hd.FindAll())
-		rt.Get("/weight", hd.FilterByWeight())
-	})
+	// - endpoints, with the errors of the router as problems like the ones of the handlers
+	hd.Routes(rt)
 
 	// run server
 	err = http.ListenAndServe(a.serverAddress, rt)
 	return
 }
+
+// makeDirs is a function that creates the directories of files that do not exist yet
+func makeDirs(paths ...string) (err error) {
+	for _, path := range paths {
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return
+		}
+	}
+	return
+}
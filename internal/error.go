@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind is a type that represents the category of a domain error
+// every kind is reported with its own status by the handlers, whatever the error of that kind is
+type ErrorKind int
+
+const (
+	// KindInternal is the kind of the unexpected errors, and of every error that is not a domain error
+	KindInternal ErrorKind = iota
+	// KindInvalid is the kind of the errors of requests that are not valid: vehicles, filters, pages, patches...
+	KindInvalid
+	// KindNotFound is the kind of the errors of requests for vehicles that do not exist
+	KindNotFound
+	// KindConflict is the kind of the errors of changes that conflict with the current vehicles
+	KindConflict
+	// KindPrecondition is the kind of the errors of changes whose precondition does not hold, like the version
+	KindPrecondition
+	// KindUnsupported is the kind of the errors of requests in a format that is not supported
+	KindUnsupported
+	// KindNotAllowed is the kind of the errors of operations that are not allowed on a resource
+	KindNotAllowed
+)
+
+// String is a method that returns the name of the kind
+func (k ErrorKind) String() string {
+	switch k {
+	case KindInvalid:
+		return "invalid"
+	case KindNotFound:
+		return "not_found"
+	case KindConflict:
+		return "conflict"
+	case KindPrecondition:
+		return "precondition"
+	case KindUnsupported:
+		return "unsupported"
+	case KindNotAllowed:
+		return "not_allowed"
+	}
+	return "internal"
+}
+
+// NewError is a function that returns a new domain error, it is used to declare the sentinel errors
+func NewError(kind ErrorKind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Error is a struct that represents a domain error
+// the sentinel errors are domain errors and Errorf returns an occurrence of one of them, errors.Is matches
+// both by their code
+type Error struct {
+	// Kind is the category of the error
+	Kind ErrorKind
+	// Code identifies the error, it is stable and unique to each sentinel, e.g. vehicle_not_found
+	Code string
+	// Field is the field of the vehicle, or the parameter of the request, the error is about, empty if none
+	Field string
+	// Message is the summary of the error, the same for every occurrence
+	Message string
+	// Err is the cause of the error, nil if none
+	Err error
+}
+
+// Error is a method that returns the message followed by the cause
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap is a method that returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is is a method that returns whether the target is a domain error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Errorf is a method that returns an occurrence of the error about a field, empty if none
+// the cause is formatted like fmt.Errorf, so %w wraps other errors
+func (e *Error) Errorf(field, format string, args ...any) *Error {
+	return &Error{Kind: e.Kind, Code: e.Code, Field: field, Message: e.Message, Err: fmt.Errorf(format, args...)}
+}
+
+// KindOf is a function that returns the kind of the first domain error of the chain of an error
+// errors that are not domain errors are KindInternal
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"app/internal"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// MediaTypeProblem is the media type of a problem details response (RFC 7807)
+	MediaTypeProblem = "application/problem+json"
+	// ProblemTypeBase is the prefix of the type URIs of the problems, relative to the API
+	ProblemTypeBase = "/problems/"
+)
+
+var (
+	// errBadRequest is an error that occurs when a request can not be read: malformed ids, bodies or query params
+	errBadRequest = internal.NewError(internal.KindInvalid, "bad_request", "bad request")
+	// errUnsupportedMediaType is an error that occurs when the body of a request is of a media type the route does
+	// not accept
+	errUnsupportedMediaType = internal.NewError(internal.KindUnsupported, "unsupported_media_type", "unsupported media type")
+	// errRouteNotFound is an error that occurs when no route matches the path of a request
+	errRouteNotFound = internal.NewError(internal.KindNotFound, "route_not_found", "route not found")
+	// errMethodNotAllowed is an error that occurs when a route does not accept the method of a request
+	errMethodNotAllowed = internal.NewError(internal.KindNotAllowed, "method_not_allowed", "method not allowed")
+)
+
+// statusOf is a function that returns the HTTP status of the errors of a kind
+func statusOf(kind internal.ErrorKind) int {
+	switch kind {
+	case internal.KindInvalid:
+		return http.StatusBadRequest
+	case internal.KindNotFound:
+		return http.StatusNotFound
+	case internal.KindConflict:
+		return http.StatusConflict
+	case internal.KindPrecondition:
+		return http.StatusPreconditionFailed
+	case internal.KindUnsupported:
+		return http.StatusUnsupportedMediaType
+	case internal.KindNotAllowed:
+		return http.StatusMethodNotAllowed
+	}
+	return http.StatusInternalServerError
+}
+
+// ProblemJSON is a struct that represents a problem details response (RFC 7807) in JSON format
+// the members after Instance are extensions, only set for the problems they describe
+type ProblemJSON struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Errors are the field-level violations of the request
+	Errors []ProblemErrorJSON `json:"errors,omitempty"`
+	// Index is the position of the vehicle of a batch that failed
+	Index *int `json:"index,omitempty"`
+	// ConflictingID and ConflictingKey are the id and the unique key of the vehicle a conflict is with
+	ConflictingID  int    `json:"conflicting_id,omitempty"`
+	ConflictingKey string `json:"conflicting_key,omitempty"`
+}
+
+// ProblemErrorJSON is a struct that represents a field-level violation of a problem in JSON format
+type ProblemErrorJSON struct {
+	// Field is the JSON name of the field of the vehicle, or the path of a patch operation
+	Field string `json:"field"`
+	// Message is the description of the violation
+	Message string `json:"message"`
+	// Index and Op are the position and the name of the operation of a JSON Patch
+	Index *int   `json:"index,omitempty"`
+	Op    string `json:"op,omitempty"`
+}
+
+// newProblemJSON is a function that returns the problem of an error
+// the detail is the message of the error, except for internal server errors, which never expose it
+func newProblemJSON(err error) (p ProblemJSON) {
+	// the problem is described by the first domain error of the chain, its type and title are the same for every
+	// occurrence of that error
+	var e *internal.Error
+	if !errors.As(err, &e) || e.Kind == internal.KindInternal {
+		return ProblemJSON{
+			Type:   "about:blank",
+			Title:  http.StatusText(http.StatusInternalServerError),
+			Status: http.StatusInternalServerError,
+		}
+	}
+	p = ProblemJSON{
+		Type:   ProblemTypeBase + strings.ReplaceAll(e.Code, "_", "-"),
+		Title:  strings.ToUpper(e.Message[:1]) + e.Message[1:],
+		Status: statusOf(e.Kind),
+		Detail: err.Error(),
+	}
+
+	// extensions
+	var invalid *internal.ValidationError
+	if errors.As(err, &invalid) {
+		fields := make([]string, 0, len(invalid.Fields))
+		for field := range invalid.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			for _, message := range invalid.Fields[field] {
+				p.Errors = append(p.Errors, ProblemErrorJSON{Field: field, Message: message})
+			}
+		}
+	}
+	var patchErrs JSONPatchErrors
+	var patchErr *JSONPatchError
+	switch {
+	case errors.As(err, &patchErrs):
+	case errors.As(err, &patchErr):
+		patchErrs = JSONPatchErrors{patchErr}
+	}
+	for _, e := range patchErrs {
+		index := e.Index
+		p.Errors = append(p.Errors, ProblemErrorJSON{Field: e.Path, Message: e.Message, Index: &index, Op: e.Op})
+	}
+	if len(p.Errors) == 0 && e.Field != "" {
+		message := e.Message
+		if e.Err != nil {
+			message = e.Err.Error()
+		}
+		p.Errors = []ProblemErrorJSON{{Field: e.Field, Message: message}}
+	}
+	var conflict *internal.VehicleConflictError
+	if errors.As(err, &conflict) {
+		p.ConflictingID = conflict.Id
+		p.ConflictingKey = string(conflict.Key)
+	}
+	var batchErr *internal.VehicleBatchError
+	if errors.As(err, &batchErr) {
+		index := batchErr.Index
+		p.Index = &index
+	}
+	return
+}
+
+// problem is a function that writes the problem of an error as the response of a request
+func problem(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, newProblemJSON(err))
+}
+
+// problemDetail is a function that writes the problem of an error with a detail of its own, for the errors whose
+// message does not describe the occurrence
+func problemDetail(w http.ResponseWriter, r *http.Request, err error, detail string) {
+	p := newProblemJSON(err)
+	if p.Status != http.StatusInternalServerError {
+		p.Detail = detail
+	}
+	writeProblem(w, r, p)
+}
+
+// writeProblem is a function that writes a problem as the response of a request, its instance is the path of the
+// request
+func writeProblem(w http.ResponseWriter, r *http.Request, p ProblemJSON) {
+	p.Instance = r.URL.Path
+	b, err := json.Marshal(p)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", MediaTypeProblem)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
+
+// NotFound is a function that handles the requests whose path matches no route
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	problemDetail(w, r, errRouteNotFound, "no route matches "+r.URL.Path)
+}
+
+// MethodNotAllowed is a function that handles the requests whose method is not accepted by the route of their path
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	problemDetail(w, r, errMethodNotAllowed, r.Method+" is not allowed for "+r.URL.Path)
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestVehicleDefault_Problems checks the media type and the members of the problem of every kind of error
+func TestVehicleDefault_Problems(t *testing.T) {
+	const invalid = `{"brand":"","model":"Focus","registration":"IJ-345","color":"Red","year":2015,"passengers":5,"max_speed":190,"transmission":"manual"}`
+	index := func(i int) *int { return &i }
+	cases := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		headers []string
+		fail    bool
+		want    ProblemJSON
+	}{
+		{name: "invalid", method: "POST", target: "/vehicles", body: invalid, want: ProblemJSON{
+			Type: "/problems/invalid-vehicle", Title: "Invalid vehicle", Status: http.StatusBadRequest, Detail: "invalid vehicle: brand is required", Instance: "/vehicles",
+			Errors: []ProblemErrorJSON{{Field: "brand", Message: "is required"}},
+		}},
+		{name: "bad request", method: "GET", target: "/vehicles/abc", want: ProblemJSON{
+			Type: "/problems/bad-request", Title: "Bad request", Status: http.StatusBadRequest, Detail: "invalid vehicle id", Instance: "/vehicles/abc",
+		}},
+		{name: "patch", method: "PATCH", target: "/vehicles/1", body: `[{"op":"remove","path":"/foo"}]`, headers: []string{"Content-Type", MediaTypeJSONPatch}, want: ProblemJSON{
+			Type: "/problems/invalid-patch", Title: "Invalid patch", Status: http.StatusBadRequest, Detail: "invalid patch: operation 0 (remove /foo): path not found", Instance: "/vehicles/1",
+			Errors: []ProblemErrorJSON{{Field: "/foo", Message: "path not found", Index: index(0), Op: "remove"}},
+		}},
+		{name: "batch", method: "POST", target: "/vehicles/batch", body: "[" + testVehicleBody("GH-012") + "," + invalid + "]", want: ProblemJSON{
+			Type: "/problems/invalid-vehicle", Title: "Invalid vehicle", Status: http.StatusBadRequest, Detail: "vehicle 1: invalid vehicle: brand is required", Instance: "/vehicles/batch",
+			Errors: []ProblemErrorJSON{{Field: "brand", Message: "is required"}}, Index: index(1),
+		}},
+		{name: "not found", method: "GET", target: "/vehicles/99", want: ProblemJSON{
+			Type: "/problems/vehicle-not-found", Title: "Vehicle not found", Status: http.StatusNotFound, Detail: "vehicle not found", Instance: "/vehicles/99",
+		}},
+		{name: "route not found", method: "GET", target: "/trucks", want: ProblemJSON{
+			Type: "/problems/route-not-found", Title: "Route not found", Status: http.StatusNotFound, Detail: "no route matches /trucks", Instance: "/trucks",
+		}},
+		{name: "conflict", method: "POST", target: "/vehicles", body: testVehicleBody("cd-456"), want: ProblemJSON{
+			Type: "/problems/vehicle-conflict", Title: "Vehicle already exists", Status: http.StatusConflict, Detail: "vehicle already exists: vehicle 2 has the same registration", Instance: "/vehicles",
+			ConflictingID: 2, ConflictingKey: "registration",
+		}},
+		{name: "precondition", method: "DELETE", target: "/vehicles/1", headers: []string{"If-Match", `"5"`}, want: ProblemJSON{
+			Type: "/problems/version-mismatch", Title: "Vehicle version does not match", Status: http.StatusPreconditionFailed, Detail: "vehicle version does not match: the current version is 1", Instance: "/vehicles/1",
+		}},
+		{name: "unsupported", method: "PATCH", target: "/vehicles/1", body: `{}`, headers: []string{"Content-Type", "text/plain"}, want: ProblemJSON{
+			Type: "/problems/unsupported-media-type", Title: "Unsupported media type", Status: http.StatusUnsupportedMediaType, Detail: "unsupported patch content type, use application/merge-patch+json or application/json-patch+json", Instance: "/vehicles/1",
+		}},
+		{name: "not allowed", method: "POST", target: "/vehicles/1", want: ProblemJSON{
+			Type: "/problems/method-not-allowed", Title: "Method not allowed", Status: http.StatusMethodNotAllowed, Detail: "POST is not allowed for /vehicles/1", Instance: "/vehicles/1",
+		}},
+		// - the detail of an internal error is never exposed
+		{name: "internal", method: "DELETE", target: "/vehicles/1", fail: true, want: ProblemJSON{
+			Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError, Instance: "/vehicles/1",
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rt, _, jr := newTestRouter()
+			if c.fail {
+				jr.Fail(errors.New("disk full"))
+			}
+			res := serveTest(rt, c.method, c.target, c.body, c.headers...)
+			if res.Code != c.want.Status {
+				t.Fatalf("status %d, want %d: %s", res.Code, c.want.Status, res.Body)
+			}
+			if got := res.Header().Get("Content-Type"); got != MediaTypeProblem {
+				t.Fatalf("content type %q, want %q", got, MediaTypeProblem)
+			}
+			var got ProblemJSON
+			decodeTest(t, res, &got)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("problem %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
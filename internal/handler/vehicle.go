@@ -4,10 +4,12 @@ import (
 	"app/internal"
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/bootcamp-go/web/request"
 	"github.com/bootcamp-go/web/response"
 	"github.com/go-chi/chi/v5"
 )
@@ -15,9 +17,11 @@ import (
 // VehicleJSON is a struct that represents a vehicle in JSON format
 type VehicleJSON struct {
 	ID              int     `json:"id"`
+	Version         int     `json:"version"`
 	Brand           string  `json:"brand"`
 	Model           string  `json:"model"`
 	Registration    string  `json:"registration"`
+	Country         string  `json:"country"`
 	Color           string  `json:"color"`
 	FabricationYear int     `json:"year"`
 	Capacity        int     `json:"passengers"`
@@ -28,13 +32,19 @@ type VehicleJSON struct {
 	Height          float64 `json:"height"`
 	Length          float64 `json:"length"`
 	Width           float64 `json:"width"`
+	// DeletedAt is only set for the vehicles in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// VehicleRequestJSON is a struct that represents the body of a request that replaces a vehicle in JSON format
+// the version and the deleted_at of the vehicle are not part of it, they are kept by the repository and ignored
+// when sent
 type VehicleRequestJSON struct {
 	ID              int     `json:"id"`
 	Brand           string  `json:"brand"`
 	Model           string  `json:"model"`
 	Registration    string  `json:"registration"`
+	Country         string  `json:"country"`
 	Color           string  `json:"color"`
 	FabricationYear int     `json:"year"`
 	Capacity        int     `json:"passengers"`
@@ -47,100 +57,296 @@ type VehicleRequestJSON struct {
 	Width           float64 `json:"width"`
 }
 
+// newVehicleJSON is a function that deserializes a vehicle to VehicleJSON
+func newVehicleJSON(vehicle internal.Vehicle) (v VehicleJSON) {
+	v = VehicleJSON{
+		ID:              vehicle.Id,
+		Version:         vehicle.Version,
+		Brand:           vehicle.Brand,
+		Model:           vehicle.Model,
+		Registration:    vehicle.Registration,
+		Country:         vehicle.Country,
+		Color:           vehicle.Color,
+		FabricationYear: vehicle.FabricationYear,
+		Capacity:        vehicle.Capacity,
+		MaxSpeed:        vehicle.MaxSpeed,
+		FuelType:        vehicle.FuelType,
+		Transmission:    vehicle.Transmission,
+		Weight:          vehicle.Weight,
+		Height:          vehicle.Height,
+		Length:          vehicle.Length,
+		Width:           vehicle.Width,
+	}
+	if vehicle.Deleted() {
+		deletedAt := vehicle.DeletedAt
+		v.DeletedAt = &deletedAt
+	}
+	return
+}
+
+// vehicle is a method that serializes VehicleRequestJSON to a vehicle, without a version
+func (req VehicleRequestJSON) vehicle() internal.Vehicle {
+	return internal.Vehicle{
+		Id: req.ID,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           req.Brand,
+			Model:           req.Model,
+			Registration:    req.Registration,
+			Country:         req.Country,
+			Color:           req.Color,
+			FabricationYear: req.FabricationYear,
+			Capacity:        req.Capacity,
+			MaxSpeed:        req.MaxSpeed,
+			FuelType:        req.FuelType,
+			Transmission:    req.Transmission,
+			Weight:          req.Weight,
+			Dimensions: internal.Dimensions{
+				Height: req.Height,
+				Length: req.Length,
+				Width:  req.Width,
+			},
+		},
+	}
+}
+
+// vehicle is a method that serializes VehicleJSON to a vehicle
+func (req VehicleJSON) vehicle() internal.Vehicle {
+	return internal.Vehicle{
+		Id:      req.ID,
+		Version: req.Version,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           req.Brand,
+			Model:           req.Model,
+			Registration:    req.Registration,
+			Country:         req.Country,
+			Color:           req.Color,
+			FabricationYear: req.FabricationYear,
+			Capacity:        req.Capacity,
+			MaxSpeed:        req.MaxSpeed,
+			FuelType:        req.FuelType,
+			Transmission:    req.Transmission,
+			Weight:          req.Weight,
+			Dimensions: internal.Dimensions{
+				Height: req.Height,
+				Length: req.Length,
+				Width:  req.Width,
+			},
+		},
+	}
+}
+
+// PageMetaJSON is a struct that represents the metadata of a page of vehicles in JSON format
+type PageMetaJSON struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// parsePageRequest is a function that reads the page of a list from the query params limit, offset, cursor and sort
+// sort is a comma separated list of fields and a field prefixed by - is ordered descending, e.g. sort=brand,-year
+func parsePageRequest(r *http.Request) (page internal.PageRequest, err error) {
+	query := r.URL.Query()
+	if limit := query.Get("limit"); limit != "" {
+		if page.Limit, err = strconv.Atoi(limit); err != nil || page.Limit < 0 {
+			err = internal.ErrInvalidPage.Errorf("limit", "invalid limit")
+			return
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if page.Offset, err = strconv.Atoi(offset); err != nil || page.Offset < 0 {
+			err = internal.ErrInvalidPage.Errorf("offset", "invalid offset")
+			return
+		}
+	}
+	page.Cursor = query.Get("cursor")
+	page.Sort, err = internal.ParseSort(query.Get("sort"))
+	return
+}
+
+// parseAsOf is a function that reads the query param as_of, a RFC 3339 time, ok is false when it is not set
+func parseAsOf(r *http.Request) (at time.Time, ok bool, err error) {
+	query := r.URL.Query().Get("as_of")
+	if query == "" {
+		return
+	}
+	if at, err = time.Parse(time.RFC3339, query); err != nil {
+		err = errBadRequest.Errorf("as_of", "invalid as_of, expected a RFC 3339 time")
+		return
+	}
+	ok = true
+	return
+}
+
+// newPageJSON is a function that returns the response body of a page of vehicles
+func newPageJSON(message string, result internal.VehiclePage, page internal.PageRequest) map[string]any {
+	data := make([]VehicleJSON, len(result.Vehicles))
+	for i, vehicle := range result.Vehicles {
+		data[i] = newVehicleJSON(vehicle)
+	}
+	return map[string]any{
+		"message": message,
+		"data":    data,
+		"meta": PageMetaJSON{
+			Total:      result.Total,
+			Limit:      page.Limit,
+			Offset:     page.Offset,
+			NextCursor: result.NextCursor,
+		},
+	}
+}
+
 // NewVehicleDefault is a function that returns a new instance of VehicleDefault
-func NewVehicleDefault(sv internal.VehicleService) *VehicleDefault {
-	return &VehicleDefault{sv: sv}
+// cacheControl is the Cache-Control header of the reads that can be cached, none is sent when it is empty
+func NewVehicleDefault(sv internal.VehicleService, cacheControl string) *VehicleDefault {
+	return &VehicleDefault{sv: sv, cacheControl: cacheControl}
 }
 
 // VehicleDefault is a struct with methods that represent handlers for vehicles
 type VehicleDefault struct {
 	// sv is the service that will be used by the handler
 	sv internal.VehicleService
+	// cacheControl is the Cache-Control header of the reads that can be cached
+	cacheControl string
 }
 
 // GetAll is a method that returns a handler for the route GET /vehicles
+// the optional filter query param selects the vehicles, see ParseFilter for its syntax, and the optional as_of
+// query param returns the vehicles as they were at that time, including the ones deleted since
 func (h *VehicleDefault) GetAll() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// request
-		// ...
+		// - parse filter, every vehicle is returned without it
+		var filter internal.Filter
+		if query := r.URL.Query().Get("filter"); query != "" {
+			var err error
+			filter, err = ParseFilter(query)
+			if err != nil {
+				problem(w, r, err)
+				return
+			}
+		}
+
+		// - parse page
+		page, err := parsePageRequest(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+		// - parse as_of
+		at, asOf, err := parseAsOf(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
 
 		// process
-		// - get all vehicles
-		v, err := h.sv.FindAll()
+		// - get the vehicles that match the filter
+		var result internal.VehiclePage
+		if asOf {
+			result, err = h.sv.SearchAsOf(filter, page, at)
+		} else {
+			result, err = h.sv.Search(filter, page)
+		}
 		if err != nil {
-			response.JSON(w, http.StatusInternalServerError, nil)
+			problem(w, r, err)
 			return
 		}
 
 		// response
-		data := make(map[int]VehicleJSON)
-		for key, value := range v {
-			data[key] = VehicleJSON{
-				ID:              value.Id,
-				Brand:           value.Brand,
-				Model:           value.Model,
-				Registration:    value.Registration,
-				Color:           value.Color,
-				FabricationYear: value.FabricationYear,
-				Capacity:        value.Capacity,
-				MaxSpeed:        value.MaxSpeed,
-				FuelType:        value.FuelType,
-				Transmission:    value.Transmission,
-				Weight:          value.Weight,
-				Height:          value.Height,
-				Length:          value.Length,
-				Width:           value.Width,
+		response.JSON(w, http.StatusOK, newPageJSON("success", result, page))
+	}
+}
+
+// Get is a method that returns a handler for the route GET /vehicles/{id}
+// the optional as_of query param returns the vehicle as it was at that time, even if it was deleted since
+func (h *VehicleDefault) Get() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		// - get vehicle id from url
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problemDetail(w, r, errBadRequest, "invalid vehicle id")
+			return
+		}
+		// - parse as_of
+		at, asOf, err := parseAsOf(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+		// process
+		var vehicle internal.Vehicle
+		if asOf {
+			vehicle, err = h.sv.GetByIDAsOf(id, at)
+		} else {
+			vehicle, err = h.sv.GetByID(id)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, internal.ErrNotFound):
+				problemDetail(w, r, err, "vehicle not found")
+			default:
+				problem(w, r, err)
 			}
+			return
+		}
+		// response
+		// - the client may already have this version
+		if h.notModified(w, r, vehicleETag(vehicle), vehicle.UpdatedAt) {
+			return
 		}
 		response.JSON(w, http.StatusOK, map[string]any{
 			"message": "success",
-			"data":    data,
+			"data":    newVehicleJSON(vehicle),
 		})
 	}
 }
 
-func (h *VehicleDefault) Get() http.HandlerFunc {
+// Update is a method that returns a handler for the route PUT /vehicles/{id}
+// the body replaces the whole vehicle, fields that are not sent are set to their zero value
+func (h *VehicleDefault) Update() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// request
 		// - get vehicle id from url
 		id, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "invalid vehicle id",
-			})
+			problemDetail(w, r, errBadRequest, "invalid vehicle id")
+			return
+		}
+		// - decode request body, every field of the vehicle is replaced
+		var req VehicleRequestJSON
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problemDetail(w, r, errBadRequest, "invalid request body")
+			return
+		}
+		// - the id of the body, if sent, must match the one of the url
+		if req.ID != 0 && req.ID != id {
+			problemDetail(w, r, errBadRequest, "vehicle id does not match the url")
 			return
 		}
+		req.ID = id
+		vehicle := req.vehicle()
+		// - the version is only checked when the request has If-Match
+		vehicle.Version = h.ifMatch(r, id)
+
 		// process
-		vehicle, err := h.sv.GetByID(id)
-		if err != nil {
+		// - replace vehicle
+		if err := h.service(r).UpdateVehicle(&vehicle); err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "ID not found")
+				problemDetail(w, r, err, "vehicle not found")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
+
 		// response
-		data := VehicleRequestJSON{
-			ID:              vehicle.Id,
-			Brand:           vehicle.Brand,
-			Model:           vehicle.Model,
-			Registration:    vehicle.Registration,
-			Color:           vehicle.Color,
-			FabricationYear: vehicle.FabricationYear,
-			Capacity:        vehicle.Capacity,
-			MaxSpeed:        vehicle.MaxSpeed,
-			FuelType:        vehicle.FuelType,
-			Transmission:    vehicle.Transmission,
-			Weight:          vehicle.Weight,
-			Height:          vehicle.Height,
-			Length:          vehicle.Length,
-			Width:           vehicle.Width,
-		}
+		w.Header().Set("ETag", vehicleETag(vehicle))
 		response.JSON(w, http.StatusOK, map[string]any{
 			"message": "success",
-			"data":    data,
+			"data":    newVehicleJSON(vehicle),
 		})
 	}
 }
@@ -155,9 +361,7 @@ func (h *VehicleDefault) Save() http.HandlerFunc {
 		// decode request body and convert it to VehicleJSON
 		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "invalid request body",
-			})
+			problemDetail(w, r, errBadRequest, "invalid request body")
 			return
 		}
 
@@ -172,6 +376,7 @@ func (h *VehicleDefault) Save() http.HandlerFunc {
 			Brand:           req.Brand,
 			Model:           req.Model,
 			Registration:    req.Registration,
+			Country:         req.Country,
 			Color:           req.Color,
 			FabricationYear: req.FabricationYear,
 			Capacity:        req.Capacity,
@@ -187,41 +392,17 @@ func (h *VehicleDefault) Save() http.HandlerFunc {
 
 		// process
 		// - save vehicle
-		if err := h.sv.Save(&vehicle); err != nil {
-			switch {
-			// if vehicle already exists, return 409 Conflict
-			case errors.Is(err, internal.ErrVehicleAlreadyExists):
-				response.Text(w, http.StatusConflict, "vehicle already exists")
-			// if vehicle is invalid, return 400 Bad Request
-			case errors.Is(err, internal.ErrFieldRequired):
-				response.Text(w, http.StatusBadRequest, "Invalid body")
-			// if vehicle is invalid, return 400 Bad Request
-			default:
-				response.Text(w, http.StatusInternalServerError, "internal server error")
-			}
+		// - 409 Conflict if it already exists and 400 Bad Request with every violation if it is invalid
+		if err := h.service(r).Save(&vehicle); err != nil {
+			problem(w, r, err)
 			return
 		}
 		// response
-		data := VehicleRequestJSON{
-			ID:              vehicle.Id,
-			Brand:           vehicle.Brand,
-			Model:           vehicle.Model,
-			Registration:    vehicle.Registration,
-			Color:           vehicle.Color,
-			FabricationYear: vehicle.FabricationYear,
-			Capacity:        vehicle.Capacity,
-			MaxSpeed:        vehicle.MaxSpeed,
-			FuelType:        vehicle.FuelType,
-			Transmission:    vehicle.Transmission,
-			Weight:          vehicle.Weight,
-			Height:          vehicle.Height,
-			Length:          vehicle.Length,
-			Width:           vehicle.Width,
-		}
 		// return 201 Created
+		w.Header().Set("ETag", vehicleETag(vehicle))
 		response.JSON(w, http.StatusCreated, map[string]any{
 			"message": "success",
-			"data":    data,
+			"data":    newVehicleJSON(vehicle),
 		})
 	}
 }
@@ -232,23 +413,30 @@ func (h *VehicleDefault) FindByColorAndYear() http.HandlerFunc {
 		// request
 		color := chi.URLParam(r, "color")
 		// convert year to int
-		year, _ := strconv.Atoi(chi.URLParam(r, "year"))
+		year, err := strconv.Atoi(chi.URLParam(r, "year"))
+		if err != nil {
+			problemDetail(w, r, errBadRequest, "invalid year")
+			return
+		}
+		// - parse page
+		page, err := parsePageRequest(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
 		// process
-		vehicles, err := h.sv.FindByColorAndYear(color, year)
+		result, err := h.sv.FindByColorAndYear(color, year, page)
 		if err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Vehicle not found")
+				problemDetail(w, r, err, "vehicle not found")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
 		// response
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Success",
-			"data":    vehicles,
-		})
+		response.JSON(w, http.StatusOK, newPageJSON("Success", result, page))
 
 	}
 }
@@ -259,26 +447,37 @@ func (h *VehicleDefault) FindByBrandAndYearRange() http.HandlerFunc {
 		// request
 		brand := chi.URLParam(r, "brand")
 		// convert year to int
-		start, _ := strconv.Atoi(chi.URLParam(r, "start_year"))
-		end, _ := strconv.Atoi(chi.URLParam(r, "end_year"))
+		start, err := strconv.Atoi(chi.URLParam(r, "start_year"))
+		if err != nil {
+			problemDetail(w, r, errBadRequest, "invalid start_year")
+			return
+		}
+		end, err := strconv.Atoi(chi.URLParam(r, "end_year"))
+		if err != nil {
+			problemDetail(w, r, errBadRequest, "invalid end_year")
+			return
+		}
 		yearRange := [2]int{start, end}
+		// - parse page
+		page, err := parsePageRequest(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
 		// process
-		vehicles, err := h.sv.FindByBrandAndYearRange(brand, yearRange)
+		result, err := h.sv.FindByBrandAndYearRange(brand, yearRange, page)
 		if err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Vehicle not found")
+				problemDetail(w, r, err, "vehicle not found")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
 
 		// response
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Success",
-			"data":    vehicles,
-		})
+		response.JSON(w, http.StatusOK, newPageJSON("Success", result, page))
 	}
 }
 
@@ -292,9 +491,9 @@ func (h *VehicleDefault) VelocityAveragebyBrand() http.HandlerFunc {
 		if err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Vehicle not found")
+				problemDetail(w, r, err, "vehicle not found")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
@@ -305,189 +504,11 @@ func (h *VehicleDefault) VelocityAveragebyBrand() http.HandlerFunc {
 	}
 }
 
-// SaveMany is a method that returns a handler for the route POST /vehicles/many
-func (h *VehicleDefault) SaveMany() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// request
-		// - decode request body
-		var req []VehicleJSON
-		// decode request body and convert it to VehicleJSON
-		err := json.NewDecoder(r.Body).Decode(&req)
-		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "invalid request body",
-			})
-			return
-		}
-		//for each vehicle in req, create a vehicle and save it
-		for _, vehicle := range req {
-			// create vehicle - serialize request body to vehicle
-			dimensions := internal.Dimensions{
-				Height: vehicle.Height,
-				Length: vehicle.Length,
-				Width:  vehicle.Width,
-			}
-
-			attributes := internal.VehicleAttributes{
-				Brand:           vehicle.Brand,
-				Model:           vehicle.Model,
-				Registration:    vehicle.Registration,
-				Color:           vehicle.Color,
-				FabricationYear: vehicle.FabricationYear,
-				Capacity:        vehicle.Capacity,
-				MaxSpeed:        vehicle.MaxSpeed,
-				FuelType:        vehicle.FuelType,
-				Transmission:    vehicle.Transmission,
-				Weight:          vehicle.Weight,
-				Dimensions:      dimensions,
-			}
-			vehicle := internal.Vehicle{
-				VehicleAttributes: attributes,
-			}
-			// process
-			// - save vehicle
-			if err := h.sv.Save(&vehicle); err != nil {
-				switch {
-				// if vehicle already exists, return 409 Conflict
-				case errors.Is(err, internal.ErrVehicleAlreadyExists):
-					response.Text(w, http.StatusConflict, "vehicle already exists")
-				// if vehicle is invalid, return 400 Bad Request
-				case errors.Is(err, internal.ErrFieldRequired):
-					response.Text(w, http.StatusBadRequest, "Invalid body")
-				// if vehicle is invalid, return 400 Bad Request
-				default:
-					response.Text(w, http.StatusInternalServerError, "internal server error")
-				}
-				return
-			}
-			// // response
-			data := VehicleRequestJSON{
-				ID:              vehicle.Id,
-				Brand:           vehicle.Brand,
-				Model:           vehicle.Model,
-				Registration:    vehicle.Registration,
-				Color:           vehicle.Color,
-				FabricationYear: vehicle.FabricationYear,
-				Capacity:        vehicle.Capacity,
-				MaxSpeed:        vehicle.MaxSpeed,
-				FuelType:        vehicle.FuelType,
-				Transmission:    vehicle.Transmission,
-				Weight:          vehicle.Weight,
-				Height:          vehicle.Height,
-				Length:          vehicle.Length,
-				Width:           vehicle.Width,
-			}
-			// return 201 Created
-			response.JSON(w, http.StatusCreated, map[string]any{
-				"message": "success",
-				"data":    data,
-			})
-		}
-	}
-}
-
-// UpdateMaxSpeed is a method that returns a handler for the route PUT /vehicles/:id/max-speed
+// UpdateMaxSpeed is a method that returns a handler for the route PATCH /vehicles/{id}/update_speed
+// it is kept for compatibility, the body is applied as a merge patch like PATCH /vehicles/{id}
 func (h *VehicleDefault) UpdateMaxSpeed() http.HandlerFunc {
-	// request
 	return func(w http.ResponseWriter, r *http.Request) {
-		id, err := strconv.Atoi(chi.URLParam(r, "id"))
-		if err != nil {
-			response.Text(w, http.StatusBadRequest, "Invalid id")
-			return
-		}
-		//check if vehicle exists
-		vehicle, err := h.sv.GetByID(id)
-		if err != nil {
-			switch {
-			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "vehicle not found")
-			default:
-				response.Text(w, http.StatusInternalServerError, "internal server error")
-			}
-			return
-		}
-		// create vehicle - serialize request body to vehicle
-		data := VehicleRequestJSON{
-			ID:              vehicle.Id,
-			Brand:           vehicle.Brand,
-			Model:           vehicle.Model,
-			Registration:    vehicle.Registration,
-			Color:           vehicle.Color,
-			FabricationYear: vehicle.FabricationYear,
-			Capacity:        vehicle.Capacity,
-			MaxSpeed:        vehicle.MaxSpeed,
-			FuelType:        vehicle.FuelType,
-			Transmission:    vehicle.Transmission,
-			Weight:          vehicle.Weight,
-			Height:          vehicle.Height,
-			Length:          vehicle.Length,
-			Width:           vehicle.Width,
-		}
-
-		// decode request body and convert it to VehicleJSON
-		if err := request.JSON(r, &data); err != nil {
-			response.Text(w, http.StatusBadRequest, "Invalid request body")
-			return
-		}
-		// create vehicle - serialize request body to vehicle
-		dimensions := internal.Dimensions{
-			Height: data.Height,
-			Length: data.Length,
-			Width:  data.Width,
-		}
-		attributes := internal.VehicleAttributes{
-			Brand:           data.Brand,
-			Model:           data.Model,
-			Registration:    data.Registration,
-			Color:           data.Color,
-			FabricationYear: data.FabricationYear,
-			Capacity:        data.Capacity,
-			MaxSpeed:        data.MaxSpeed,
-			FuelType:        data.FuelType,
-			Transmission:    data.Transmission,
-			Weight:          data.Weight,
-			Dimensions:      dimensions,
-		}
-		vehicleserialize := internal.Vehicle{
-			Id:                id,
-			VehicleAttributes: attributes,
-		}
-		// process
-		if err := h.sv.UpdateVehicle(&vehicleserialize); err != nil {
-			switch {
-			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Vehicle not found")
-			case errors.Is(err, internal.ErrFieldRequired):
-				response.Text(w, http.StatusBadRequest, "Invalid body")
-			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
-			}
-			return
-		}
-
-		// response
-		// - deserialize vehicle to VehicleJSON
-		dataResponse := VehicleJSON{
-			ID:              vehicle.Id,
-			Brand:           vehicle.Brand,
-			Model:           vehicle.Model,
-			Registration:    vehicle.Registration,
-			Color:           vehicle.Color,
-			FabricationYear: vehicle.FabricationYear,
-			Capacity:        vehicle.Capacity,
-			MaxSpeed:        vehicle.MaxSpeed,
-			FuelType:        vehicle.FuelType,
-			Transmission:    vehicle.Transmission,
-			Weight:          vehicle.Weight,
-			Height:          vehicle.Height,
-			Length:          vehicle.Length,
-			Width:           vehicle.Width,
-		}
-
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Updated successfully",
-			"data":    dataResponse,
-		})
+		h.patch(w, r, newMergePatch)
 	}
 }
 
@@ -497,23 +518,26 @@ func (h *VehicleDefault) FindByFuelType() http.HandlerFunc {
 		// request
 		//find by fuel type
 		brand := chi.URLParam(r, "type")
+		// - parse page
+		page, err := parsePageRequest(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
 		// process
-		vehicles, err := h.sv.FindByFuelType(brand)
+		result, err := h.sv.FindByFuelType(brand, page)
 		if err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Not found vehicles with this fuel type")
+				problemDetail(w, r, err, "not found vehicles with this fuel type")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
 
 		// response
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Find By Fuel Type successfully",
-			"data":    vehicles,
-		})
+		response.JSON(w, http.StatusOK, newPageJSON("Find By Fuel Type successfully", result, page))
 	}
 }
 
@@ -523,19 +547,16 @@ func (h *VehicleDefault) Delete() http.HandlerFunc {
 		// request
 		id, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "invalid id",
-				"data":    nil,
-			})
+			problemDetail(w, r, errBadRequest, "invalid vehicle id")
 			return
 		}
 		// process
-		if err := h.sv.Delete(id); err != nil {
+		if err := h.service(r).Delete(id, h.ifMatch(r, id)); err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Vehicle not found")
+				problemDetail(w, r, err, "vehicle not found")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
@@ -552,23 +573,26 @@ func (h *VehicleDefault) FindByTransmission() http.HandlerFunc {
 		// request
 		//find by fuel type
 		transmission := chi.URLParam(r, "type")
+		// - parse page
+		page, err := parsePageRequest(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
 		// process
-		vehicles, err := h.sv.FindByTransmission(transmission)
+		result, err := h.sv.FindByTransmission(transmission, page)
 		if err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Not found vehicles with this transmission")
+				problemDetail(w, r, err, "not found vehicles with this transmission")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
 
 		// response
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Find By Transmission successfully",
-			"data":    vehicles,
-		})
+		response.JSON(w, http.StatusOK, newPageJSON("Find By Transmission successfully", result, page))
 	}
 }
 
@@ -584,9 +608,9 @@ func (h *VehicleDefault) CapacityAveragebyBrand() http.HandlerFunc {
 		if err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Not found vehicles with this brand")
+				problemDetail(w, r, err, "not found vehicles with this brand")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
@@ -599,181 +623,51 @@ func (h *VehicleDefault) CapacityAveragebyBrand() http.HandlerFunc {
 	}
 }
 
-// UpdateFuelType is a method that returns a handler for the route PUT /vehicles/:id/fuel-type
+// UpdateFuelType is a method that returns a handler for the route PATCH /vehicles/{id}/update_fuel
+// it is kept for compatibility, the body is applied as a merge patch like PATCH /vehicles/{id}
 func (h *VehicleDefault) UpdateFuelType() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		id, err := strconv.Atoi(chi.URLParam(r, "id"))
-		if err != nil {
-			response.Text(w, http.StatusBadRequest, "Invalid id")
-			return
-		}
-		//check if vehicle exists
-		vehicle, err := h.sv.GetByID(id)
-		if err != nil {
-			switch {
-			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Vehicle not found")
-			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
-			}
-			return
-		}
-		// create vehicle - serialize request body to vehicle
-		data := VehicleRequestJSON{
-			ID:              vehicle.Id,
-			Brand:           vehicle.Brand,
-			Model:           vehicle.Model,
-			Registration:    vehicle.Registration,
-			Color:           vehicle.Color,
-			FabricationYear: vehicle.FabricationYear,
-			Capacity:        vehicle.Capacity,
-			MaxSpeed:        vehicle.MaxSpeed,
-			FuelType:        vehicle.FuelType,
-			Transmission:    vehicle.Transmission,
-			Weight:          vehicle.Weight,
-			Height:          vehicle.Height,
-			Length:          vehicle.Length,
-			Width:           vehicle.Width,
-		}
-
-		// decode request body and convert it to VehicleJSON
-		if err := request.JSON(r, &data); err != nil {
-			response.Text(w, http.StatusBadRequest, "Invalid request body")
-			return
-		}
-		// create vehicle - serialize request body to vehicle
-		dimensions := internal.Dimensions{
-			Height: data.Height,
-			Length: data.Length,
-			Width:  data.Width,
-		}
-		attributes := internal.VehicleAttributes{
-			Brand:           data.Brand,
-			Model:           data.Model,
-			Registration:    data.Registration,
-			Color:           data.Color,
-			FabricationYear: data.FabricationYear,
-			Capacity:        data.Capacity,
-			MaxSpeed:        data.MaxSpeed,
-			FuelType:        data.FuelType,
-			Transmission:    data.Transmission,
-			Weight:          data.Weight,
-			Dimensions:      dimensions,
-		}
-		vehicleserialize := internal.Vehicle{
-			Id:                id,
-			VehicleAttributes: attributes,
-		}
-		// process
-		if err := h.sv.UpdateVehicle(&vehicleserialize); err != nil {
-			switch {
-			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Vehicle not found")
-			case errors.Is(err, internal.ErrFieldRequired):
-				response.Text(w, http.StatusBadRequest, "Invalid body")
-			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
-			}
-			return
-		}
-
-		// response
-		// - deserialize vehicle to VehicleJSON
-		dataResponse := VehicleJSON{
-			ID:              vehicle.Id,
-			Brand:           vehicle.Brand,
-			Model:           vehicle.Model,
-			Registration:    vehicle.Registration,
-			Color:           vehicle.Color,
-			FabricationYear: vehicle.FabricationYear,
-			Capacity:        vehicle.Capacity,
-			MaxSpeed:        vehicle.MaxSpeed,
-			FuelType:        vehicle.FuelType,
-			Transmission:    vehicle.Transmission,
-			Weight:          vehicle.Weight,
-			Height:          vehicle.Height,
-			Length:          vehicle.Length,
-			Width:           vehicle.Width,
-		}
-
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Updated successfully",
-			"data":    dataResponse,
-		})
+		h.patch(w, r, newMergePatch)
 	}
 }
 
-// FindAll is a method that returns a handler for the route GET /vehicles
-func (h *VehicleDefault) FindAll() http.HandlerFunc {
+// FindByDimensions is a method that returns a handler for the route GET /vehicles/dimensions
+// every min_<field> and max_<field> is optional, the fields are height, length, width, volume and footprint,
+// any other min_ or max_ param is a bad request
+func (h *VehicleDefault) FindByDimensions() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// request
 		query := make(map[string]any)
-		//request query params -min_length-
-		minLength, ok := r.URL.Query()["min_length"]
-		if ok {
-			//convert string to float64
-			minLengthFloat, err := strconv.ParseFloat(minLength[0], 64)
-			if err != nil {
-				//if error return bad request
-				response.Text(w, http.StatusBadRequest, "Invalid min length")
-				return
+		//request query params -min_<field>- and -max_<field>-, the service rejects the unknown fields
+		for key, value := range r.URL.Query() {
+			if !strings.HasPrefix(key, "min_") && !strings.HasPrefix(key, "max_") {
+				continue
 			}
-			//if no error add to query map
-			query["min_length"] = minLengthFloat
-		}
-		//request query params -max_length-
-		maxLength, ok := r.URL.Query()["max_length"]
-		if ok {
-			//convert string to float64
-			maxLengthFloat, err := strconv.ParseFloat(maxLength[0], 64)
-			if err != nil {
-				response.Text(w, http.StatusBadRequest, "Invalid max_length")
-				return
-			}
-			//if no error add to query map
-			query["max_length"] = maxLengthFloat
-		}
-		//request query params -min_width-
-		minWidth, ok := r.URL.Query()["min_width"]
-		if ok {
-			//convert string to float64
-			minWidthFloat, err := strconv.ParseFloat(minWidth[0], 64)
-			if err != nil {
-				response.Text(w, http.StatusBadRequest, "Invalid min_width")
+			//convert string to a finite float64
+			valueFloat, err := strconv.ParseFloat(value[0], 64)
+			if err != nil || math.IsNaN(valueFloat) || math.IsInf(valueFloat, 0) {
+				//if error return bad request
+				problemDetail(w, r, errBadRequest, "invalid "+key)
 				return
 			}
 			//if no error add to query map
-			query["min_width"] = minWidthFloat
+			query[key] = valueFloat
 		}
-		//request query params -max_width-
-		maxWidth, ok := r.URL.Query()["max_width"]
-		if ok {
-			//convert string to float64
-			maxWidthFloat, err := strconv.ParseFloat(maxWidth[0], 64)
-			if err != nil {
-				response.Text(w, http.StatusBadRequest, "Invalid max_width")
-				return
-			}
-			//if no error add to query map
-			query["max_width"] = maxWidthFloat
+		// - parse page
+		page, err := parsePageRequest(r)
+		if err != nil {
+			problem(w, r, err)
+			return
 		}
 		// process
 		//send query to service and get response
-		items, err := h.sv.FindQuery(query)
+		result, err := h.sv.FindByDimensions(query, page)
 		if err != nil {
-			switch {
-			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Not found vehicles")
-			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
-			}
+			problem(w, r, err)
 			return
 		}
 		// response
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Find by query successfully",
-			"data":    items,
-		})
+		response.JSON(w, http.StatusOK, newPageJSON("Find by dimensions successfully", result, page))
 	}
 }
 
@@ -788,7 +682,7 @@ func (h *VehicleDefault) FilterByWeight() http.HandlerFunc {
 			//convert string to float64
 			weightMinFloat, err := strconv.ParseFloat(weightMin[0], 64)
 			if err != nil {
-				response.Text(w, http.StatusBadRequest, "Invalid min length")
+				problemDetail(w, r, errBadRequest, "invalid weight_min")
 				return
 			}
 			//if no error add to query map
@@ -800,26 +694,29 @@ func (h *VehicleDefault) FilterByWeight() http.HandlerFunc {
 			//convert string to float64
 			weightMaxFloat, err := strconv.ParseFloat(weightMax[0], 64)
 			if err != nil {
-				response.Text(w, http.StatusBadRequest, "Invalid max_length")
+				problemDetail(w, r, errBadRequest, "invalid weight_max")
 				return
 			}
 			//if no error add to query map
 			query["weight_max"] = weightMaxFloat
 		}
+		// - parse page
+		page, err := parsePageRequest(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
 		// process
-		items, err := h.sv.FilterByWeight(query)
+		result, err := h.sv.FilterByWeight(query, page)
 		if err != nil {
 			switch {
 			case errors.Is(err, internal.ErrNotFound):
-				response.Text(w, http.StatusNotFound, "Not found vehicles")
+				problemDetail(w, r, err, "not found vehicles")
 			default:
-				response.Text(w, http.StatusInternalServerError, "Internal server error")
+				problem(w, r, err)
 			}
 			return
 		}
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Find by query successfully",
-			"data":    items,
-		})
+		response.JSON(w, http.StatusOK, newPageJSON("Find by query successfully", result, page))
 	}
 }
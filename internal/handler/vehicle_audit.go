@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootcamp-go/web/response"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// HeaderActor is the header of a request that names who makes the changes, they are audited as anonymous without it
+	HeaderActor = "X-Actor"
+)
+
+// AuditChangeJSON is a struct that represents the change of a field of a vehicle in JSON format
+type AuditChangeJSON struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// AuditEntryJSON is a struct that represents an audit entry in JSON format
+type AuditEntryJSON struct {
+	Seq       int               `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Actor     string            `json:"actor"`
+	Operation string            `json:"operation"`
+	VehicleID int               `json:"vehicle_id"`
+	Version   int               `json:"version"`
+	Changes   []AuditChangeJSON `json:"changes"`
+}
+
+// newAuditEntriesJSON is a function that deserializes audit entries to AuditEntryJSON
+func newAuditEntriesJSON(entries []internal.AuditEntry) []AuditEntryJSON {
+	data := make([]AuditEntryJSON, len(entries))
+	for i, entry := range entries {
+		changes := make([]AuditChangeJSON, len(entry.Changes))
+		for j, change := range entry.Changes {
+			changes[j] = AuditChangeJSON{Field: change.Field, Before: change.Before, After: change.After}
+		}
+		data[i] = AuditEntryJSON{
+			Seq:       entry.Seq,
+			Time:      entry.Time,
+			Actor:     entry.Actor,
+			Operation: string(entry.Op),
+			VehicleID: entry.VehicleId,
+			Version:   entry.Version,
+			Changes:   changes,
+		}
+	}
+	return data
+}
+
+// auditETag is a function that returns the strong entity tag and the modification time of the responses with audit
+// entries, the entries are only appended and their Seq is never repeated, so the latest one tells them apart
+// the audit trail is appended after the vehicles change, so it is not tagged with their revision
+func auditETag(entries []internal.AuditEntry) (etag string, modified time.Time) {
+	if len(entries) == 0 {
+		return `"a0"`, time.Time{}
+	}
+	last := entries[len(entries)-1]
+	return `"a` + strconv.Itoa(last.Seq) + `"`, last.Time
+}
+
+// service is a method that returns the service for the changes of a request, made by the actor of its X-Actor header
+func (h *VehicleDefault) service(r *http.Request) internal.VehicleService {
+	return h.sv.As(r.Header.Get(HeaderActor))
+}
+
+// History is a method that returns a handler for the route GET /vehicles/{id}/history
+// the response is tagged with its latest entry, so it can be revalidated with If-None-Match or If-Modified-Since
+func (h *VehicleDefault) History() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problemDetail(w, r, errBadRequest, "invalid vehicle id")
+			return
+		}
+		// process
+		entries, err := h.sv.History(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, internal.ErrNotFound):
+				problemDetail(w, r, err, "vehicle not found")
+			default:
+				problem(w, r, err)
+			}
+			return
+		}
+		// response
+		// - the client may already have these entries
+		etag, modified := auditETag(entries)
+		if h.notModified(w, r, etag, modified) {
+			return
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    newAuditEntriesJSON(entries),
+		})
+	}
+}
+
+// Audit is a method that returns a handler for the route GET /audit
+// the optional query param since is a RFC 3339 time, only the entries made at or after it are returned,
+// the response is tagged with its latest entry, so it can be revalidated with If-None-Match or If-Modified-Since
+func (h *VehicleDefault) Audit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		var since time.Time
+		if query := r.URL.Query().Get("since"); query != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, query); err != nil {
+				problemDetail(w, r, errBadRequest, "invalid since, expected a RFC 3339 time")
+				return
+			}
+		}
+		// process
+		entries, err := h.sv.Audit(since)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+		// response
+		// - the client may already have these entries
+		etag, modified := auditETag(entries)
+		if h.notModified(w, r, etag, modified) {
+			return
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    newAuditEntriesJSON(entries),
+		})
+	}
+}
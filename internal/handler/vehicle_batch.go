@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"app/internal"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+const (
+	// BatchModeAtomic saves every vehicle of the batch or none
+	BatchModeAtomic = "atomic"
+	// BatchModeBestEffort saves every vehicle on its own and reports the result of each one
+	BatchModeBestEffort = "best_effort"
+)
+
+// BatchItemJSON is a struct that represents the result of a vehicle of a batch in JSON format
+type BatchItemJSON struct {
+	Index  int          `json:"index"`
+	Status int          `json:"status"`
+	ID     int          `json:"id,omitempty"`
+	Data   *VehicleJSON `json:"data,omitempty"`
+	// Error is the problem of the vehicle, for the ones that were not saved
+	Error *ProblemJSON `json:"error,omitempty"`
+}
+
+// SaveMany is a method that returns a handler for the route POST /vehicles/batch
+// the query param mode selects how the batch is saved:
+//   - atomic (default): every vehicle is validated and saved or none is, the response is 201 with the saved
+//     vehicles or the problem of the first vehicle that failed with its index
+//   - best_effort: every vehicle is saved on its own, the response is 207 with the status, id or problem of each one
+func (h *VehicleDefault) SaveMany() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		// - mode
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = BatchModeAtomic
+		}
+		if mode != BatchModeAtomic && mode != BatchModeBestEffort {
+			problemDetail(w, r, errBadRequest, "invalid mode, expected atomic or best_effort")
+			return
+		}
+		// - decode request body
+		var req []VehicleJSON
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problemDetail(w, r, errBadRequest, "invalid request body")
+			return
+		}
+		vehicles := make([]internal.Vehicle, len(req))
+		for i, rq := range req {
+			// the ids are assigned by the repository
+			rq.ID = 0
+			vehicles[i] = rq.vehicle()
+		}
+
+		// process
+		if mode == BatchModeBestEffort {
+			errs := h.service(r).SaveEach(vehicles)
+			data := make([]BatchItemJSON, len(vehicles))
+			for i, err := range errs {
+				if err != nil {
+					p := newProblemJSON(err)
+					data[i] = BatchItemJSON{Index: i, Status: p.Status, Error: &p}
+					continue
+				}
+				vehicle := newVehicleJSON(vehicles[i])
+				data[i] = BatchItemJSON{Index: i, Status: http.StatusCreated, ID: vehicles[i].Id, Data: &vehicle}
+			}
+			response.JSON(w, http.StatusMultiStatus, map[string]any{
+				"message": "batch processed",
+				"data":    data,
+			})
+			return
+		}
+
+		if err := h.service(r).SaveMany(vehicles); err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		// response
+		data := make([]VehicleJSON, len(vehicles))
+		for i, vehicle := range vehicles {
+			data[i] = newVehicleJSON(vehicle)
+		}
+		response.JSON(w, http.StatusCreated, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestVehicleDefault_SaveMany checks the body of an atomic batch, the body of each vehicle of a best effort batch and
+// that an atomic batch with an invalid vehicle saves none
+func TestVehicleDefault_SaveMany(t *testing.T) {
+	invalid := `{"brand":"","model":"Focus","registration":"IJ-345"}`
+
+	t.Run("atomic", func(t *testing.T) {
+		rt, _, _ := newTestRouter()
+		res := serveTest(rt, "POST", "/vehicles/batch", "["+testVehicleBody("GH-012")+","+testVehicleBody("KL-678")+"]")
+		if res.Code != http.StatusCreated {
+			t.Fatalf("status %d, want %d: %s", res.Code, http.StatusCreated, res.Body)
+		}
+		var body struct {
+			Message string        `json:"message"`
+			Data    []VehicleJSON `json:"data"`
+		}
+		decodeTest(t, res, &body)
+		if body.Message != "success" || len(body.Data) != 2 {
+			t.Fatalf("body %+v, want the 2 vehicles", body)
+		}
+		for i, want := range []VehicleJSON{{ID: 4, Registration: "GH-012"}, {ID: 5, Registration: "KL-678"}} {
+			if got := body.Data[i]; got.ID != want.ID || got.Version != 1 || got.Registration != want.Registration || got.Brand != "Ford" {
+				t.Fatalf("vehicle %d is %+v, want id %d, version 1 and registration %s", i, got, want.ID, want.Registration)
+			}
+		}
+		if res = serveTest(rt, "GET", "/vehicles/5", ""); res.Code != http.StatusOK {
+			t.Fatalf("get vehicle 5: status %d, want %d", res.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("atomic invalid", func(t *testing.T) {
+		rt, _, _ := newTestRouter()
+		res := serveTest(rt, "POST", "/vehicles/batch", "["+testVehicleBody("GH-012")+","+invalid+"]")
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("status %d, want %d: %s", res.Code, http.StatusBadRequest, res.Body)
+		}
+		var p ProblemJSON
+		decodeTest(t, res, &p)
+		if p.Index == nil || *p.Index != 1 {
+			t.Fatalf("problem %+v, want the index 1", p)
+		}
+		// - the valid vehicle was not saved either
+		if res = serveTest(rt, "GET", "/vehicles/registration/GH-012", ""); res.Code != http.StatusNotFound {
+			t.Fatalf("get the valid vehicle: status %d, want %d", res.Code, http.StatusNotFound)
+		}
+		var list struct {
+			Meta PageMetaJSON `json:"meta"`
+		}
+		decodeTest(t, serveTest(rt, "GET", "/vehicles", ""), &list)
+		if list.Meta.Total != 2 {
+			t.Fatalf("%d vehicles, want 2", list.Meta.Total)
+		}
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		rt, _, _ := newTestRouter()
+		res := serveTest(rt, "POST", "/vehicles/batch?mode=best_effort", "["+testVehicleBody("GH-012")+","+invalid+","+testVehicleBody("cd-456")+"]")
+		if res.Code != http.StatusMultiStatus {
+			t.Fatalf("status %d, want %d: %s", res.Code, http.StatusMultiStatus, res.Body)
+		}
+		var body struct {
+			Data []BatchItemJSON `json:"data"`
+		}
+		decodeTest(t, res, &body)
+		if len(body.Data) != 3 {
+			t.Fatalf("%d items, want 3", len(body.Data))
+		}
+		// - the saved vehicle
+		saved := body.Data[0]
+		if saved.Index != 0 || saved.Status != http.StatusCreated || saved.ID != 4 || saved.Data == nil || saved.Data.ID != 4 || saved.Error != nil {
+			t.Fatalf("item 0 is %+v, want vehicle 4 created", saved)
+		}
+		// - the invalid vehicle and the one in conflict, with their problems
+		for i, status := range map[int]int{1: http.StatusBadRequest, 2: http.StatusConflict} {
+			item := body.Data[i]
+			if item.Index != i || item.Status != status || item.ID != 0 || item.Data != nil || item.Error == nil || item.Error.Status != status {
+				t.Fatalf("item %d is %+v, want status %d with its problem", i, item, status)
+			}
+		}
+		if body.Data[2].Error.ConflictingID != 2 {
+			t.Fatalf("item 2 conflicts with %d, want 2", body.Data[2].Error.ConflictingID)
+		}
+	})
+}
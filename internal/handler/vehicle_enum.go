@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"app/internal"
+	"net/http"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+// VocabularyJSON is a struct that represents the vocabulary of a text field of a vehicle in JSON format
+type VocabularyJSON struct {
+	// Values are the canonical values
+	Values []string `json:"values"`
+	// Aliases are the canonical values by their other spellings
+	Aliases map[string]string `json:"aliases"`
+}
+
+// Enums is a method that returns a handler for the route GET /vehicles/enums
+// the values of the fields with a vocabulary are saved as their canonical value, whatever spelling is sent
+func (h *VehicleDefault) Enums() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// process
+		vocabularies := h.sv.Vocabularies()
+		// response
+		data := make(map[string]VocabularyJSON, len(vocabularies))
+		for _, field := range internal.VehicleVocabularyFields {
+			vocabulary, ok := vocabularies[field]
+			if !ok {
+				continue
+			}
+			aliases := vocabulary.Aliases()
+			if aliases == nil {
+				aliases = map[string]string{}
+			}
+			data[field] = VocabularyJSON{Values: vocabulary.Values(), Aliases: aliases}
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
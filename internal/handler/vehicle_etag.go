@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"app/internal"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vehicleETag is a function that returns the strong entity tag of a version of a vehicle
+func vehicleETag(vehicle internal.Vehicle) string {
+	return `"` + strconv.Itoa(vehicle.Version) + `"`
+}
+
+// revisionETag is a function that returns the strong entity tag of the responses built from a revision of the vehicles
+func revisionETag(revision internal.VehicleRevision) string {
+	return `"r` + strconv.FormatUint(revision.Counter, 36) + `"`
+}
+
+// ifMatch is a method that returns the version of the vehicle with an id required by the If-Match header of a request
+// it returns zero when there is no header or it lists *, and -1, which no vehicle has, when the header can not match
+// any version: weak tags and tags that were not created by vehicleETag never match,
+// when it lists many versions the precondition holds if any of them matches, so the current version of the vehicle
+// is required if it is listed, the service checks it again with the change and fails if the vehicle changed since
+func (h *VehicleDefault) ifMatch(r *http.Request, id int) (version int) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0
+	}
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return 0
+		}
+		if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		if v, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return -1
+	case 1:
+		return versions[0]
+	}
+	// many versions, the current one is required if it is listed
+	vehicle, err := h.sv.GetByID(id)
+	if err != nil || !slices.Contains(versions, vehicle.Version) {
+		return -1
+	}
+	return vehicle.Version
+}
+
+// Conditional is a method that returns a middleware for the routes that read many vehicles, lists or aggregates
+// their responses are tagged with the revision of the vehicles, so a request whose If-None-Match or
+// If-Modified-Since still matches it gets 304 Not Modified without running the handler
+func (h *VehicleDefault) Conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the revision is read before the vehicles, so a response is never tagged with a newer revision than its data
+		revision := h.sv.Revision()
+		etag := revisionETag(revision)
+		if fresh(r, etag, revision.ModifiedAt) {
+			h.setValidators(w.Header(), etag, revision.ModifiedAt)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next.ServeHTTP(&validatorsWriter{ResponseWriter: w, h: h, etag: etag, modified: revision.ModifiedAt}, r)
+	})
+}
+
+// notModified is a method that returns whether the client already has the representation with the validators
+// in that case it writes 304 Not Modified and the handler must not write anything else,
+// otherwise it sets the validators on the response
+func (h *VehicleDefault) notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	h.setValidators(w.Header(), etag, modified)
+	if !fresh(r, etag, modified) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// setValidators is a method that sets the ETag, Last-Modified and Cache-Control headers of a response
+// Last-Modified is not set when the modification time is not known
+func (h *VehicleDefault) setValidators(header http.Header, etag string, modified time.Time) {
+	header.Set("ETag", etag)
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if h.cacheControl != "" {
+		header.Set("Cache-Control", h.cacheControl)
+	}
+}
+
+// fresh is a function that returns whether the representation the client has is still the current one
+// If-None-Match is used when it is sent and If-Modified-Since otherwise, as required by RFC 9110
+func fresh(r *http.Request, etag string, modified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		// weak comparison, a weak tag matches the strong one with the same value
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !modified.IsZero() {
+		since, err := http.ParseTime(header)
+		// the header has a precision of seconds
+		return err == nil && !modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// validatorsWriter is a struct that sets the validators of a response only if it is successful
+type validatorsWriter struct {
+	http.ResponseWriter
+	// h is the handler that sets the validators
+	h *VehicleDefault
+	// etag and modified are the validators of the response
+	etag     string
+	modified time.Time
+	// wroteHeader is true once the status was written
+	wroteHeader bool
+}
+
+// WriteHeader is a method that sets the validators before writing a successful status
+func (w *validatorsWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status == http.StatusOK {
+			w.h.setValidators(w.Header(), w.etag, w.modified)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write is a method that writes the body, the status is 200 if it was not written
+func (w *validatorsWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestVehicleDefault_SaveVersion checks that a created vehicle is returned with its version and its entity tag, so
+// the client can change it with If-Match right away
+func TestVehicleDefault_SaveVersion(t *testing.T) {
+	rt, _, _ := newTestRouter()
+	res := serveTest(rt, "POST", "/vehicles", testVehicleBody("GH-012"))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("status %d, want %d: %s", res.Code, http.StatusCreated, res.Body)
+	}
+	var body struct {
+		Data VehicleJSON `json:"data"`
+	}
+	decodeTest(t, res, &body)
+	if body.Data.ID != 4 || body.Data.Version != 1 {
+		t.Fatalf("created vehicle %d version %d, want 4 version 1", body.Data.ID, body.Data.Version)
+	}
+	etag := res.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag %s, want \"1\"", etag)
+	}
+	if res = serveTest(rt, "PATCH", "/vehicles/4", `{"max_speed":150}`, "Content-Type", "application/merge-patch+json", "If-Match", etag); res.Code != http.StatusOK {
+		t.Fatalf("patch with the ETag of the create: status %d, want %d: %s", res.Code, http.StatusOK, res.Body)
+	}
+}
+
+// TestVehicleDefault_IfMatch checks that the precondition of a change holds when any tag of If-Match is the current
+// version of the vehicle, which is 1
+func TestVehicleDefault_IfMatch(t *testing.T) {
+	cases := []struct {
+		ifMatch string
+		status  int
+	}{
+		{`"1"`, http.StatusOK},
+		{`"2"`, http.StatusPreconditionFailed},
+		{`"3", "1"`, http.StatusOK},
+		{`"1","4"`, http.StatusOK},
+		{`"3", "4"`, http.StatusPreconditionFailed},
+		{`*`, http.StatusOK},
+		{`"3", *`, http.StatusOK},
+		{`W/"1"`, http.StatusPreconditionFailed},
+		{`W/"1", "3"`, http.StatusPreconditionFailed},
+		{`"r1", "1"`, http.StatusOK},
+		{`1`, http.StatusPreconditionFailed},
+	}
+	for _, c := range cases {
+		for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+			rt, _, _ := newTestRouter()
+			res := serveTest(rt, method, "/vehicles/1", testVehicleBody("AB-123"), "Content-Type", "application/merge-patch+json", "If-Match", c.ifMatch)
+			if res.Code != c.status {
+				t.Fatalf("%s with If-Match %s: status %d, want %d: %s", method, c.ifMatch, res.Code, c.status, res.Body)
+			}
+		}
+	}
+	// - a vehicle that does not exist is not found whatever the tags
+	rt, _, _ := newTestRouter()
+	if res := serveTest(rt, "DELETE", "/vehicles/99", "", "If-Match", `"1", "2"`); res.Code != http.StatusNotFound {
+		t.Fatalf("delete of a missing vehicle: status %d, want %d", res.Code, http.StatusNotFound)
+	}
+}
+
+// TestVehicleDefault_Conditional checks the validators of the lists and of a vehicle and the requests they answer with
+// 304 Not Modified, with strong, weak and * tags of If-None-Match and with If-Modified-Since
+func TestVehicleDefault_Conditional(t *testing.T) {
+	for _, target := range []string{"/vehicles", "/vehicles/1"} {
+		t.Run(target, func(t *testing.T) {
+			rt, _, _ := newTestRouter()
+			res := serveTest(rt, "GET", target, "")
+			if res.Code != http.StatusOK {
+				t.Fatalf("status %d, want %d: %s", res.Code, http.StatusOK, res.Body)
+			}
+			etag, lastModified := res.Header().Get("ETag"), res.Header().Get("Last-Modified")
+			if etag == "" || lastModified == "" || res.Header().Get("Cache-Control") != "no-cache" {
+				t.Fatalf("headers %v, want ETag, Last-Modified and Cache-Control", res.Header())
+			}
+			modified, err := http.ParseTime(lastModified)
+			if err != nil {
+				t.Fatalf("Last-Modified %s: %v", lastModified, err)
+			}
+
+			cases := []struct {
+				name    string
+				headers []string
+				status  int
+			}{
+				{"strong tag", []string{"If-None-Match", etag}, http.StatusNotModified},
+				{"weak tag", []string{"If-None-Match", "W/" + etag}, http.StatusNotModified},
+				{"list", []string{"If-None-Match", `"other", ` + etag}, http.StatusNotModified},
+				{"any", []string{"If-None-Match", "*"}, http.StatusNotModified},
+				{"other tag", []string{"If-None-Match", `"other"`}, http.StatusOK},
+				{"modified since", []string{"If-Modified-Since", lastModified}, http.StatusNotModified},
+				{"modified before", []string{"If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+				{"tag before date", []string{"If-None-Match", `"other"`, "If-Modified-Since", lastModified}, http.StatusOK},
+			}
+			for _, c := range cases {
+				res := serveTest(rt, "GET", target, "", c.headers...)
+				if res.Code != c.status {
+					t.Fatalf("%s: status %d, want %d", c.name, res.Code, c.status)
+				}
+				if res.Code == http.StatusNotModified && (res.Body.Len() != 0 || res.Header().Get("ETag") != etag) {
+					t.Fatalf("%s: 304 with body %q and ETag %s, want no body and ETag %s", c.name, res.Body, res.Header().Get("ETag"), etag)
+				}
+			}
+
+			// - a change of vehicle 1 makes the tag stale
+			if res = serveTest(rt, "PATCH", "/vehicles/1", `{"max_speed":150}`, "Content-Type", "application/merge-patch+json"); res.Code != http.StatusOK {
+				t.Fatalf("patch: status %d, want %d", res.Code, http.StatusOK)
+			}
+			res = serveTest(rt, "GET", target, "", "If-None-Match", etag)
+			if res.Code != http.StatusOK {
+				t.Fatalf("after a change: status %d, want %d", res.Code, http.StatusOK)
+			}
+			if changed := res.Header().Get("ETag"); changed == "" || changed == etag {
+				t.Fatalf("after a change: ETag %s, want a new one", changed)
+			}
+		})
+	}
+
+	// - a save or a change of another vehicle makes the tag of the lists stale, not the one of vehicle 1
+	rt, _, _ := newTestRouter()
+	list, vehicle := serveTest(rt, "GET", "/vehicles", "").Header().Get("ETag"), serveTest(rt, "GET", "/vehicles/1", "").Header().Get("ETag")
+	if res := serveTest(rt, "POST", "/vehicles", testVehicleBody("GH-012")); res.Code != http.StatusCreated {
+		t.Fatalf("save: status %d, want %d", res.Code, http.StatusCreated)
+	}
+	if res := serveTest(rt, "GET", "/vehicles", "", "If-None-Match", list); res.Code != http.StatusOK {
+		t.Fatalf("list after a save: status %d, want %d", res.Code, http.StatusOK)
+	}
+	if res := serveTest(rt, "GET", "/vehicles/1", "", "If-None-Match", vehicle); res.Code != http.StatusNotModified {
+		t.Fatalf("vehicle 1 after a save: status %d, want %d", res.Code, http.StatusNotModified)
+	}
+
+	// - the failed reads have no validators
+	if res := serveTest(rt, "GET", "/vehicles?limit=abc", ""); res.Code != http.StatusBadRequest || res.Header().Get("ETag") != "" {
+		t.Fatalf("failed list: status %d with ETag %q, want %d without it", res.Code, res.Header().Get("ETag"), http.StatusBadRequest)
+	}
+}
+
+// TestVehicleDefault_ConditionalAudit checks that the audit trail and the history of a vehicle are tagged with their
+// latest entry, so a tag taken before an entry was appended never answers 304 Not Modified without it
+func TestVehicleDefault_ConditionalAudit(t *testing.T) {
+	for _, target := range []string{"/audit", "/vehicles/1/history"} {
+		t.Run(target, func(t *testing.T) {
+			rt, _, _ := newTestRouter()
+			res := serveTest(rt, "GET", target, "")
+			empty := res.Header().Get("ETag")
+			if res.Code != http.StatusOK || empty == "" {
+				t.Fatalf("status %d with ETag %q, want %d with one", res.Code, empty, http.StatusOK)
+			}
+			if res = serveTest(rt, "GET", target, "", "If-None-Match", empty); res.Code != http.StatusNotModified {
+				t.Fatalf("same entries: status %d, want %d", res.Code, http.StatusNotModified)
+			}
+
+			// - a change appends an entry
+			if res = serveTest(rt, "PATCH", "/vehicles/1", `{"max_speed":150}`, "Content-Type", "application/merge-patch+json"); res.Code != http.StatusOK {
+				t.Fatalf("patch: status %d, want %d", res.Code, http.StatusOK)
+			}
+			res = serveTest(rt, "GET", target, "", "If-None-Match", empty)
+			var body struct {
+				Data []AuditEntryJSON `json:"data"`
+			}
+			decodeTest(t, res, &body)
+			if res.Code != http.StatusOK || len(body.Data) != 1 || body.Data[0].Seq != 1 {
+				t.Fatalf("after a change: status %d with %v, want %d with entry 1", res.Code, body.Data, http.StatusOK)
+			}
+			etag := res.Header().Get("ETag")
+			if etag == empty || res.Header().Get("Last-Modified") == "" {
+				t.Fatalf("after a change: ETag %s and Last-Modified %q, want new ones", etag, res.Header().Get("Last-Modified"))
+			}
+			if res = serveTest(rt, "GET", target, "", "If-None-Match", etag); res.Code != http.StatusNotModified {
+				t.Fatalf("same entries after a change: status %d, want %d", res.Code, http.StatusNotModified)
+			}
+		})
+	}
+}
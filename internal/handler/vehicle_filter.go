@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"app/internal"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseFilter is a function that parses the filter of the route GET /vehicles?filter=...
+//
+//	filter    = logical | predicate
+//	logical   = ("and" | "or") "(" filter { "," filter } ")" | "not" "(" filter ")"
+//	predicate = operator "(" field { "," value } ")"
+//	operator  = "eq" | "ne" | "lt" | "lte" | "gt" | "gte" | "in" | "between" | "prefix" | "contains"
+//	value     = word | "'" { character | "''" } "'"
+//
+// fields are the JSON names of the vehicle (brand, year, max_speed...) and the values of numeric fields are
+// parsed as finite numbers, eq, ne, lt, lte, gt, gte, prefix and contains take one value, in takes one or more and
+// between takes the lower and upper bound, both included. A word is any text without spaces, commas,
+// parentheses or quotes, any other value must be quoted and a quote inside a quoted value is written twice.
+// Spaces between tokens are ignored, for example
+//
+//	and(eq(brand,Ford),between(year,2000,2010),not(in(color,Red,'Dark Blue')))
+func ParseFilter(s string) (filter internal.Filter, err error) {
+	p := &filterParser{s: s}
+	if filter, err = p.filter(); err != nil {
+		return
+	}
+	if p.next(); p.kind != tokenEOF {
+		err = p.errorf("unexpected %q after the end of the filter", p.text)
+	}
+	return
+}
+
+// tokenKind is a type that represents the kind of a token of a filter
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenQuoted
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+// filterParser is a struct that parses a filter by recursive descent
+type filterParser struct {
+	// s is the filter being parsed
+	s string
+	// pos is the position of the next token
+	pos int
+	// kind, text and start describe the current token
+	kind  tokenKind
+	text  string
+	start int
+}
+
+// filter is a method that parses a logical expression or a predicate
+func (p *filterParser) filter() (filter internal.Filter, err error) {
+	if err = p.expect(tokenWord, "an operator"); err != nil {
+		return
+	}
+	filter.Op = internal.FilterOp(p.text)
+	if err = p.expect(tokenOpen, "("); err != nil {
+		return
+	}
+
+	switch filter.Op {
+	case internal.FilterAnd, internal.FilterOr, internal.FilterNot:
+		// children
+		for {
+			child, err := p.filter()
+			if err != nil {
+				return filter, err
+			}
+			filter.Filters = append(filter.Filters, child)
+			if done, err := p.listEnd(); err != nil || done {
+				return filter, err
+			}
+		}
+	case internal.FilterEq, internal.FilterNe, internal.FilterLt, internal.FilterLte, internal.FilterGt, internal.FilterGte,
+		internal.FilterIn, internal.FilterBetween, internal.FilterPrefix, internal.FilterContains:
+		// field
+		if err = p.expect(tokenWord, "a field"); err != nil {
+			return
+		}
+		filter.Field = p.text
+		field, ok := internal.VehicleFields[filter.Field]
+		if !ok {
+			err = p.errorf("unknown field %q, expected one of %s", filter.Field, strings.Join(internal.VehicleFieldNames(), ", "))
+			return
+		}
+		if done, err := p.listEnd(); err != nil || done {
+			return filter, err
+		}
+		// values
+		for {
+			p.next()
+			if p.kind != tokenWord && p.kind != tokenQuoted {
+				return filter, p.errorf("expected a value, found %q", p.text)
+			}
+			var value any = p.text
+			if field.Kind == internal.FieldNumber {
+				number, parseErr := strconv.ParseFloat(p.text, 64)
+				// NaN and the infinities can not be ordered, so they are not numbers of a filter
+				if parseErr != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+					return filter, p.errorf("field %q requires a finite number, found %q", filter.Field, p.text)
+				}
+				value = number
+			}
+			filter.Values = append(filter.Values, value)
+			if done, err := p.listEnd(); err != nil || done {
+				return filter, err
+			}
+		}
+	default:
+		err = p.errorf("unknown operator %q", filter.Op)
+		return
+	}
+}
+
+// listEnd is a method that consumes the separator of an argument list, it returns true at the closing parenthesis
+func (p *filterParser) listEnd() (done bool, err error) {
+	p.next()
+	switch p.kind {
+	case tokenComma:
+		return false, nil
+	case tokenClose:
+		return true, nil
+	}
+	return false, p.errorf("expected , or ), found %q", p.text)
+}
+
+// expect is a method that reads the next token and checks its kind
+func (p *filterParser) expect(kind tokenKind, what string) (err error) {
+	p.next()
+	if p.kind != kind {
+		if p.kind == tokenEOF {
+			return p.errorf("expected %s, found the end of the filter", what)
+		}
+		return p.errorf("expected %s, found %q", what, p.text)
+	}
+	return
+}
+
+// next is a method that reads the next token
+func (p *filterParser) next() {
+	// skip spaces
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+	p.start = p.pos
+	if p.pos >= len(p.s) {
+		p.kind, p.text = tokenEOF, ""
+		return
+	}
+
+	switch c := p.s[p.pos]; c {
+	case '(', ')', ',':
+		p.kind = map[byte]tokenKind{'(': tokenOpen, ')': tokenClose, ',': tokenComma}[c]
+		p.text = string(c)
+		p.pos++
+	case '\'':
+		// quoted value, a quote is escaped by another quote
+		var b strings.Builder
+		p.pos++
+		for {
+			if p.pos >= len(p.s) {
+				// report the unterminated value as a word so the error shows it
+				p.kind, p.text = tokenEOF, p.s[p.start:]
+				return
+			}
+			if p.s[p.pos] == '\'' {
+				if p.pos+1 < len(p.s) && p.s[p.pos+1] == '\'' {
+					b.WriteByte('\'')
+					p.pos += 2
+					continue
+				}
+				p.pos++
+				break
+			}
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		}
+		p.kind, p.text = tokenQuoted, b.String()
+	default:
+		for p.pos < len(p.s) && !strings.ContainsRune("(),' \t\r\n", rune(p.s[p.pos])) {
+			p.pos++
+		}
+		p.kind, p.text = tokenWord, p.s[p.start:p.pos]
+	}
+}
+
+// errorf is a method that returns a parse error at the position of the current token
+func (p *filterParser) errorf(format string, args ...any) error {
+	return internal.ErrInvalidFilter.Errorf("filter", "at position %d: %s", p.start+1, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"testing"
+)
+
+// TestParseFilter checks the filters that are parsed and the ones that are rejected by the parser or the validation
+func TestParseFilter(t *testing.T) {
+	valid := []string{
+		"eq(brand,Ford)",
+		"and(eq(brand,Ford),between(year,2000,2010),not(in(color,Red,'Dark Blue')))",
+		"gte(max_speed, 120.5)",
+		"eq(model,'O''Brien')",
+	}
+	for _, s := range valid {
+		filter, err := ParseFilter(s)
+		if err != nil {
+			t.Fatalf("parse %s: %v", s, err)
+		}
+		if err = filter.Validate(); err != nil {
+			t.Fatalf("validate %s: %v", s, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"eq(brand)",
+		"eq(foo,1)",
+		"foo(brand,Ford)",
+		"eq(year,abc)",
+		"eq(year,2000",
+		"eq(year,2000))",
+		"prefix(year,2)",
+		"eq(model,'Ford)",
+		// numbers that can not be ordered
+		"eq(passengers,NaN)",
+		"eq(year,nan)",
+		"gt(max_speed,Inf)",
+		"lt(weight,-Inf)",
+		"between(year,-infinity,+Infinity)",
+	}
+	for _, s := range invalid {
+		filter, err := ParseFilter(s)
+		if err == nil {
+			err = filter.Validate()
+		}
+		if !errors.Is(err, internal.ErrInvalidFilter) {
+			t.Fatalf("parse %s: got %v, want %v", s, err, internal.ErrInvalidFilter)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"app/internal"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MediaTypeJSONPatch is the media type of a JSON Patch (RFC 6902)
+	MediaTypeJSONPatch = "application/json-patch+json"
+)
+
+var (
+	// errPatchTestFailed is an error that occurs when a test operation does not match the vehicle
+	errPatchTestFailed = internal.NewError(internal.KindConflict, "patch_test_failed", "patch test failed")
+	// errPatchPathNotFound is an error that occurs when an operation targets a location that does not exist
+	errPatchPathNotFound = errors.New("path not found")
+)
+
+// JSONPatchOperationJSON is a struct that represents an operation of a JSON Patch in JSON format
+type JSONPatchOperationJSON struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatchError is a struct that represents an error of an operation of a JSON Patch
+type JSONPatchError struct {
+	// Index is the position of the operation in the patch
+	Index int `json:"index"`
+	// Op is the name of the operation
+	Op string `json:"op"`
+	// Path is the target location of the operation
+	Path string `json:"path"`
+	// Message is the description of the error
+	Message string `json:"message"`
+	// err is the cause of the error
+	err error
+}
+
+// Error is a method that returns the description of the error
+func (e *JSONPatchError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Message)
+}
+
+// Unwrap is a method that returns the cause of the error
+func (e *JSONPatchError) Unwrap() error {
+	return e.err
+}
+
+// JSONPatchErrors is a type that represents the errors of every invalid operation of a JSON Patch
+type JSONPatchErrors []*JSONPatchError
+
+// Error is a method that returns the description of the errors
+func (e JSONPatchErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// jsonPatchOperation is a struct that represents a decoded operation of a JSON Patch
+type jsonPatchOperation struct {
+	op    string
+	path  []string
+	from  []string
+	value any
+}
+
+// newJSONPatch is a function that decodes a JSON Patch (RFC 6902) for a vehicle
+// every operation is checked before any is applied and the errors of all the invalid ones are returned together,
+// the operations are applied in order over a copy of the vehicle, so if one fails the vehicle is left unchanged
+func newJSONPatch(body []byte) (patch internal.VehiclePatch, err error) {
+	var req []JSONPatchOperationJSON
+	if err = json.Unmarshal(body, &req); err != nil {
+		err = fmt.Errorf("%w: json patch must be an array of operations: %s", internal.ErrInvalidPatch, err.Error())
+		return
+	}
+
+	// decode operations
+	operations := make([]jsonPatchOperation, len(req))
+	var errs JSONPatchErrors
+	for i, rq := range req {
+		operation, opErr := decodeJSONPatchOperation(rq)
+		if opErr != nil {
+			path := ""
+			if rq.Path != nil {
+				path = *rq.Path
+			}
+			errs = append(errs, &JSONPatchError{Index: i, Op: rq.Op, Path: path, Message: opErr.Error(), err: opErr})
+			continue
+		}
+		operations[i] = operation
+	}
+	if len(errs) > 0 {
+		err = fmt.Errorf("%w: %w", internal.ErrInvalidPatch, errs)
+		return
+	}
+
+	patch = func(vehicle *internal.Vehicle) (err error) {
+		return patchVehicleJSON(vehicle, func(doc any) (any, error) {
+			for i, operation := range operations {
+				var opErr error
+				doc, opErr = operation.apply(doc)
+				if opErr != nil {
+					return nil, &JSONPatchError{Index: i, Op: req[i].Op, Path: *req[i].Path, Message: opErr.Error(), err: opErr}
+				}
+			}
+			return doc, nil
+		})
+	}
+	return
+}
+
+// decodeJSONPatchOperation is a function that checks the members required by an operation
+func decodeJSONPatchOperation(rq JSONPatchOperationJSON) (operation jsonPatchOperation, err error) {
+	operation.op = rq.Op
+	if rq.Path == nil {
+		err = errors.New("missing path")
+		return
+	}
+	if operation.path, err = parseJSONPointer(*rq.Path); err != nil {
+		return
+	}
+
+	switch rq.Op {
+	case "add", "replace", "test":
+		if rq.Value == nil {
+			err = errors.New("missing value")
+			return
+		}
+		if err = json.Unmarshal(rq.Value, &operation.value); err != nil {
+			return
+		}
+	case "move", "copy":
+		if rq.From == nil {
+			err = errors.New("missing from")
+			return
+		}
+		if operation.from, err = parseJSONPointer(*rq.From); err != nil {
+			return
+		}
+		// a location can not be moved into one of its children
+		if rq.Op == "move" && len(operation.path) > len(operation.from) && reflect.DeepEqual(operation.from, operation.path[:len(operation.from)]) {
+			err = errors.New("from is a prefix of path")
+			return
+		}
+	case "remove":
+	default:
+		err = fmt.Errorf("unknown operation %q", rq.Op)
+		return
+	}
+	return
+}
+
+// apply is a method that applies the operation to a document and returns the result
+func (o jsonPatchOperation) apply(doc any) (any, error) {
+	switch o.op {
+	case "add":
+		return jsonPointerAdd(doc, o.path, o.value)
+	case "remove":
+		doc, _, err := jsonPointerRemove(doc, o.path)
+		return doc, err
+	case "replace":
+		doc, _, err := jsonPointerRemove(doc, o.path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, o.path, o.value)
+	case "move":
+		doc, value, err := jsonPointerRemove(doc, o.from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, o.path, value)
+	case "copy":
+		value, err := jsonPointerGet(doc, o.from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, o.path, deepCopyJSON(value))
+	case "test":
+		value, err := jsonPointerGet(doc, o.path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, o.value) {
+			return nil, errPatchTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", o.op)
+}
+
+// parseJSONPointer is a function that splits a JSON Pointer (RFC 6901) into its reference tokens
+func parseJSONPointer(pointer string) (tokens []string, err error) {
+	if pointer == "" {
+		return
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		err = fmt.Errorf("invalid pointer %q", pointer)
+		return
+	}
+	tokens = strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return
+}
+
+// jsonPointerGet is a function that returns the value of the document at the location of the tokens
+func jsonPointerGet(doc any, tokens []string) (value any, err error) {
+	value = doc
+	for _, token := range tokens {
+		switch node := value.(type) {
+		case map[string]any:
+			var ok bool
+			if value, ok = node[token]; !ok {
+				return nil, errPatchPathNotFound
+			}
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			value = node[i]
+		default:
+			return nil, errPatchPathNotFound
+		}
+	}
+	return
+}
+
+// jsonPointerAdd is a function that adds a value to the document at the location of the tokens
+func jsonPointerAdd(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := jsonPointerGet(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[token] = value
+		return doc, nil
+	case []any:
+		i := len(node)
+		if token != "-" {
+			if i, err = arrayIndex(token, len(node)); err != nil {
+				return nil, err
+			}
+		}
+		node = append(node[:i:i], append([]any{value}, node[i:]...)...)
+		return jsonPointerSet(doc, tokens[:len(tokens)-1], node)
+	}
+	return nil, errPatchPathNotFound
+}
+
+// jsonPointerRemove is a function that removes the value of the document at the location of the tokens
+func jsonPointerRemove(doc any, tokens []string) (any, any, error) {
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := jsonPointerGet(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	token := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		value, ok := node[token]
+		if !ok {
+			return nil, nil, errPatchPathNotFound
+		}
+		delete(node, token)
+		return doc, value, nil
+	case []any:
+		i, err := arrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = jsonPointerSet(doc, tokens[:len(tokens)-1], node)
+		return doc, value, err
+	}
+	return nil, nil, errPatchPathNotFound
+}
+
+// jsonPointerSet is a function that replaces the value of the document at the location of the tokens
+// it is used to store back an array that was grown or shrunk
+func jsonPointerSet(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := jsonPointerGet(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[token] = value
+		return doc, nil
+	case []any:
+		i, err := arrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = value
+		return doc, nil
+	}
+	return nil, errPatchPathNotFound
+}
+
+// arrayIndex is a function that parses an array index of a JSON Pointer, it must be between 0 and max
+func arrayIndex(token string, max int) (i int, err error) {
+	i, err = strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, errPatchPathNotFound
+	}
+	return
+}
+
+// deepCopyJSON is a function that returns a copy of a decoded JSON value
+func deepCopyJSON(value any) any {
+	switch node := value.(type) {
+	case map[string]any:
+		cp := make(map[string]any, len(node))
+		for key, v := range node {
+			cp[key] = deepCopyJSON(v)
+		}
+		return cp
+	case []any:
+		cp := make([]any, len(node))
+		for i, v := range node {
+			cp[i] = deepCopyJSON(v)
+		}
+		return cp
+	}
+	return value
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestVehicleDefault_JSONPatch checks the operations of a JSON Patch and that a patch with an operation that fails
+// leaves the vehicle and its version as they were
+func TestVehicleDefault_JSONPatch(t *testing.T) {
+	base := newVehicleJSON(newTestVehicle(1, "AB-123"))
+	cases := []struct {
+		name   string
+		body   string
+		status int
+		// change is applied to vehicle 1 to get the vehicle expected after the patch
+		change func(v *VehicleJSON)
+	}{
+		{name: "move", body: `[{"op":"move","from":"/height","path":"/width"}]`, status: 200, change: func(v *VehicleJSON) { v.Width, v.Height = 1.5, 0 }},
+		{name: "copy", body: `[{"op":"copy","from":"/length","path":"/width"}]`, status: 200, change: func(v *VehicleJSON) { v.Width = 4 }},
+		{name: "copy text", body: `[{"op":"copy","from":"/color","path":"/model"}]`, status: 200, change: func(v *VehicleJSON) { v.Model = "Red" }},
+		{name: "remove", body: `[{"op":"remove","path":"/weight"}]`, status: 200, change: func(v *VehicleJSON) { v.Weight = 0 }},
+		{name: "in order", body: `[{"op":"copy","from":"/max_speed","path":"/weight"},{"op":"move","from":"/weight","path":"/height"}]`, status: 200, change: func(v *VehicleJSON) { v.Height, v.Weight = 190, 0 }},
+		{name: "test and replace", body: `[{"op":"test","path":"/color","value":"Red"},{"op":"replace","path":"/color","value":"Blue"}]`, status: 200, change: func(v *VehicleJSON) { v.Color = "Blue" }},
+		{name: "remove a required field", body: `[{"op":"remove","path":"/model"}]`, status: 400},
+		{name: "move a required field", body: `[{"op":"move","from":"/model","path":"/country"}]`, status: 400},
+		{name: "remove an unknown field", body: `[{"op":"remove","path":"/foo"}]`, status: 400},
+		{name: "move from an unknown field", body: `[{"op":"move","from":"/foo","path":"/color"}]`, status: 400},
+		{name: "copy to an unknown field", body: `[{"op":"copy","from":"/color","path":"/foo"}]`, status: 400},
+		{name: "move without from", body: `[{"op":"move","path":"/color"}]`, status: 400},
+		// - the operations before the one that fails are not kept
+		{name: "test fails after changes", body: `[{"op":"replace","path":"/color","value":"Blue"},{"op":"remove","path":"/weight"},{"op":"move","from":"/height","path":"/width"},{"op":"test","path":"/color","value":"Red"}]`, status: 409},
+		{name: "test fails before changes", body: `[{"op":"test","path":"/passengers","value":4},{"op":"replace","path":"/color","value":"Blue"}]`, status: 409},
+		{name: "invalid after changes", body: `[{"op":"replace","path":"/color","value":"Blue"},{"op":"remove","path":"/brand"}]`, status: 400},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rt, sv, _ := newTestRouter()
+			list := serveTest(rt, "GET", "/vehicles", "").Header().Get("ETag")
+			res := serveTest(rt, "PATCH", "/vehicles/1", c.body, "Content-Type", MediaTypeJSONPatch)
+			if res.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", res.Code, c.status, res.Body)
+			}
+			stored, err := sv.GetByID(1)
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			got := newVehicleJSON(stored)
+			if c.status != http.StatusOK {
+				// - a patch that fails changes nothing, not even the version or the revision of the vehicles
+				if got != base {
+					t.Fatalf("vehicle %+v after a failed patch, want %+v", got, base)
+				}
+				if res = serveTest(rt, "GET", "/vehicles", "", "If-None-Match", list); res.Code != http.StatusNotModified {
+					t.Fatalf("list after a failed patch: status %d, want %d", res.Code, http.StatusNotModified)
+				}
+				return
+			}
+			want := base
+			want.Version = 2
+			c.change(&want)
+			if got != want {
+				t.Fatalf("vehicle %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"app/internal"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/bootcamp-go/web/response"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// MediaTypeMergePatch is the media type of a JSON Merge Patch (RFC 7386)
+	MediaTypeMergePatch = "application/merge-patch+json"
+)
+
+// Patch is a method that returns a handler for the route PATCH /vehicles/{id}
+// the body is applied to the JSON representation of the vehicle according to its content type
+func (h *VehicleDefault) Patch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		// - get patch format from the content type
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case MediaTypeMergePatch:
+			h.patch(w, r, newMergePatch)
+		case MediaTypeJSONPatch:
+			h.patch(w, r, newJSONPatch)
+		default:
+			problemDetail(w, r, errUnsupportedMediaType, "unsupported patch content type, use "+MediaTypeMergePatch+" or "+MediaTypeJSONPatch)
+		}
+	}
+}
+
+// patch is a method that decodes a patch from the request body and applies it to the vehicle of the url
+func (h *VehicleDefault) patch(w http.ResponseWriter, r *http.Request, decode func(body []byte) (internal.VehiclePatch, error)) {
+	// request
+	// - get vehicle id from url
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problemDetail(w, r, errBadRequest, "invalid vehicle id")
+		return
+	}
+	// - decode patch
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problemDetail(w, r, errBadRequest, "invalid request body")
+		return
+	}
+	patch, err := decode(body)
+	if err != nil {
+		problem(w, r, err)
+		return
+	}
+
+	// process
+	vehicle, err := h.service(r).PatchVehicle(id, h.ifMatch(r, id), patch)
+	if err != nil {
+		switch {
+		case errors.Is(err, internal.ErrNotFound):
+			problemDetail(w, r, err, "vehicle not found")
+		default:
+			problem(w, r, err)
+		}
+		return
+	}
+
+	// response
+	w.Header().Set("ETag", vehicleETag(vehicle))
+	response.JSON(w, http.StatusOK, map[string]any{
+		"message": "success",
+		"data":    newVehicleJSON(vehicle),
+	})
+}
+
+// newMergePatch is a function that decodes a JSON Merge Patch (RFC 7386) for a vehicle
+// only the members of the patch are changed and a null member resets the field to its zero value
+func newMergePatch(body []byte) (patch internal.VehiclePatch, err error) {
+	var doc any
+	if err = json.Unmarshal(body, &doc); err != nil {
+		err = fmt.Errorf("%w: %s", internal.ErrInvalidPatch, err.Error())
+		return
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		err = fmt.Errorf("%w: merge patch must be a JSON object", internal.ErrInvalidPatch)
+		return
+	}
+
+	patch = func(vehicle *internal.Vehicle) (err error) {
+		return patchVehicleJSON(vehicle, func(target any) (any, error) {
+			return mergePatch(target, doc), nil
+		})
+	}
+	return
+}
+
+// mergePatch is a function that applies a merge patch to a target document as defined by RFC 7386
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// patchVehicleJSON is a function that applies a change to the JSON representation of a vehicle
+// the id and the version of the vehicle can not be changed and unknown members are rejected
+func patchVehicleJSON(vehicle *internal.Vehicle, change func(doc any) (any, error)) (err error) {
+	// deserialize vehicle to a JSON document
+	b, err := json.Marshal(newVehicleJSON(*vehicle))
+	if err != nil {
+		return
+	}
+	var doc any
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return
+	}
+
+	// apply change
+	doc, err = change(doc)
+	if err != nil {
+		return
+	}
+
+	// serialize the JSON document back to a vehicle
+	b, err = json.Marshal(doc)
+	if err != nil {
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var req VehicleJSON
+	if err = dec.Decode(&req); err != nil {
+		return
+	}
+	if req.ID != 0 && req.ID != vehicle.Id {
+		err = errors.New("the id of a vehicle can not be changed")
+		return
+	}
+	if req.Version != 0 && req.Version != vehicle.Version {
+		err = errors.New("the version of a vehicle can not be changed, use If-Match to update a version")
+		return
+	}
+	vehicle.VehicleAttributes = req.vehicle().VehicleAttributes
+	return
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+
+	"github.com/bootcamp-go/web/response"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetByRegistration is a method that returns a handler for the route GET /vehicles/registration/{plate}
+// the plate is compared ignoring case and spaces
+func (h *VehicleDefault) GetByRegistration() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		plate := chi.URLParam(r, "plate")
+		if internal.NormalizeRegistration(plate) == "" {
+			problemDetail(w, r, errBadRequest, "invalid registration")
+			return
+		}
+		// process
+		vehicle, err := h.sv.GetByRegistration(plate)
+		if err != nil {
+			switch {
+			case errors.Is(err, internal.ErrNotFound):
+				problemDetail(w, r, err, "vehicle not found")
+			default:
+				problem(w, r, err)
+			}
+			return
+		}
+		// response
+		// - the client may already have this version
+		if h.notModified(w, r, vehicleETag(vehicle), vehicle.UpdatedAt) {
+			return
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    newVehicleJSON(vehicle),
+		})
+	}
+}
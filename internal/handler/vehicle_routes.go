@@ -0,0 +1,47 @@
+package handler
+
+import "github.com/go-chi/chi/v5"
+
+// Routes is a method that registers the endpoints of the vehicles and the audit trail on a router,
+// the routes that are not found or do not allow the method are answered as problems like the ones of the handlers
+// the middlewares of the router must be set before it is called
+func (h *VehicleDefault) Routes(rt chi.Router) {
+	// - errors of the router
+	rt.NotFound(NotFound)
+	rt.MethodNotAllowed(MethodNotAllowed)
+	// - endpoints
+	rt.Route("/vehicles", func(rt chi.Router) {
+		// - GET /vehicles
+		rt.Post("/", h.Save())
+		rt.Get("/{id}", h.Get())
+		rt.Get("/registration/{plate}", h.GetByRegistration())
+		rt.Get("/enums", h.Enums())
+		rt.Put("/{id}", h.Update())
+		rt.Patch("/{id}", h.Patch())
+		rt.Post("/batch", h.SaveMany())
+		rt.Post("/{id}/restore", h.Restore())
+		rt.Delete("/trash", h.EmptyTrash())
+		rt.Delete("/trash/{id}", h.Purge())
+		rt.Patch("/{id}/update_speed", h.UpdateMaxSpeed())
+		rt.Delete("/{id}", h.Delete())
+		rt.Patch("/{id}/update_fuel", h.UpdateFuelType())
+		rt.Get("/{id}/history", h.History())
+		// - lists and aggregates, validated with the revision of the vehicles
+		rt.Group(func(rt chi.Router) {
+			rt.Use(h.Conditional)
+			rt.Get("/", h.GetAll())
+			rt.Get("/color/{color}/year/{year}", h.FindByColorAndYear())
+			rt.Get("/brand/{brand}/between/{start_year}/{end_year}", h.FindByBrandAndYearRange())
+			rt.Get("/average_speed/brand/{brand}", h.VelocityAveragebyBrand())
+			rt.Get("/fuel_type/{type}", h.FindByFuelType())
+			rt.Get("/transmission/{type}", h.FindByTransmission())
+			rt.Get("/average_capacity/brand/{brand}", h.CapacityAveragebyBrand())
+			rt.Get("/dimensions", h.FindByDimensions())
+			rt.Get("/weight", h.FilterByWeight())
+			rt.Get("/stats", h.Stats())
+			rt.Get("/trash", h.Trash())
+		})
+	})
+	// - GET /audit, validated with its latest entry
+	rt.Get("/audit", h.Audit())
+}
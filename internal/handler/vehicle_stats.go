@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"app/internal"
+	"net/http"
+	"strings"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+// StatsColumnJSON is a struct that represents a column of a stats table in JSON format
+type StatsColumnJSON struct {
+	Name string `json:"name"`
+	// Type is the type of the values of the column, string or number
+	Type string `json:"type"`
+}
+
+// StatsJSON is a struct that represents a stats table in JSON format, every row has a value for each column
+type StatsJSON struct {
+	Columns []StatsColumnJSON `json:"columns"`
+	Rows    [][]any           `json:"rows"`
+}
+
+// newStatsJSON is a function that deserializes a stats result to StatsJSON
+func newStatsJSON(result internal.StatsResult) StatsJSON {
+	columns := make([]StatsColumnJSON, len(result.Columns))
+	for i, column := range result.Columns {
+		columns[i] = StatsColumnJSON{Name: column.Name, Type: "string"}
+		if column.Kind == internal.FieldNumber {
+			columns[i].Type = "number"
+		}
+	}
+	return StatsJSON{Columns: columns, Rows: result.Rows}
+}
+
+// Stats is a method that returns a handler for the route GET /vehicles/stats
+// the optional query params are group_by, a comma separated list of fields, metrics, a comma separated list of
+// count, sum(field), avg(field), min(field) and max(field), count when it is not set, and filter, see ParseFilter
+// for its syntax, for example
+//
+//	/vehicles/stats?group_by=brand,fuel_type&metrics=avg(max_speed),max(weight),count&filter=gte(year,2000)
+func (h *VehicleDefault) Stats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		var query internal.StatsQuery
+		// - parse group_by, every vehicle is a single group without it
+		if groupBy := r.URL.Query().Get("group_by"); groupBy != "" {
+			for _, name := range strings.Split(groupBy, ",") {
+				query.GroupBy = append(query.GroupBy, strings.TrimSpace(name))
+			}
+		}
+		// - parse metrics
+		var err error
+		if query.Metrics, err = internal.ParseMetrics(r.URL.Query().Get("metrics")); err != nil {
+			problem(w, r, err)
+			return
+		}
+		// - parse filter, every vehicle is aggregated without it
+		if filter := r.URL.Query().Get("filter"); filter != "" {
+			if query.Filter, err = ParseFilter(filter); err != nil {
+				problem(w, r, err)
+				return
+			}
+		}
+
+		// process
+		result, err := h.sv.Stats(query)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		// response
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    newStatsJSON(result),
+		})
+	}
+}
@@ -0,0 +1,440 @@
+package handler
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"app/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestVehicle is a function that returns a valid vehicle with an id and a registration
+func newTestVehicle(id int, registration string) internal.Vehicle {
+	return internal.Vehicle{Id: id, Version: 1, VehicleAttributes: internal.VehicleAttributes{
+		Brand: "Ford", Model: "Focus", Registration: registration, Color: "Red", FabricationYear: 2015, Capacity: 5,
+		MaxSpeed: 190, FuelType: "gasoline", Transmission: "manual", Weight: 1300,
+		Dimensions: internal.Dimensions{Height: 1.5, Length: 4, Width: 2},
+	}}
+}
+
+// newTestRouter is a function that returns the routes of the application over vehicles 1 and 2, and vehicle 3 in the
+// trash, the changes fail while the journal fails
+func newTestRouter() (rt *chi.Mux, sv internal.VehicleService, jr *repository.VehicleJournalMemory) {
+	db := map[int]internal.Vehicle{1: newTestVehicle(1, "AB-123"), 2: newTestVehicle(2, "CD-456"), 3: newTestVehicle(3, "EF-789")}
+	v3 := db[3]
+	v3.DeletedAt = time.Now().Add(-time.Hour)
+	db[3] = v3
+	jr = repository.NewVehicleJournalMemory()
+	rp := repository.NewVehicleMapJournal(repository.NewVehicleMap(db, 3, nil), jr, nil, nil)
+	sv = service.NewVehicleDefault(rp, repository.NewAuditMap(), internal.NewPlateRegistry(), internal.NewVehicleValidator(internal.DefaultValidationRules), internal.DefaultVocabularies)
+	hd := NewVehicleDefault(sv, "no-cache")
+
+	// the routes of the application
+	rt = chi.NewRouter()
+	hd.Routes(rt)
+	return
+}
+
+// testVehicleBody is a function that returns the request body of a valid vehicle with a registration
+func testVehicleBody(registration string) string {
+	return `{"brand":"Ford","model":"Focus","registration":"` + registration + `","color":"Red","year":2015,"passengers":5,"max_speed":190,"fuel_type":"gasoline","transmission":"manual","weight":1300}`
+}
+
+// serveTest is a function that serves a request on a router and returns the response
+// headers are pairs of name and value
+func serveTest(rt http.Handler, method, target, body string, headers ...string) (res *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	res = httptest.NewRecorder()
+	rt.ServeHTTP(res, req)
+	return
+}
+
+// decodeTest is a function that decodes the body of a response into v
+func decodeTest(t *testing.T, res *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatalf("decode %s: %v", res.Body, err)
+	}
+}
+
+// TestVehicleDefault_Failures checks the status of every way a request to every endpoint can fail
+func TestVehicleDefault_Failures(t *testing.T) {
+	const (
+		valid     = `{"brand":"Ford","model":"Focus","registration":"GH-012","color":"Red","year":2015,"passengers":5,"max_speed":190,"fuel_type":"gasoline","transmission":"manual","weight":1300}`
+		invalid   = `{"brand":"","model":"Focus","registration":"IJ-345","color":"Red","year":2015,"passengers":5,"max_speed":190,"fuel_type":"gasoline","transmission":"manual","weight":1300}`
+		conflict  = `{"brand":"Ford","model":"Focus","registration":"cd-456","color":"Red","year":2015,"passengers":5,"max_speed":190,"fuel_type":"gasoline","transmission":"manual","weight":1300}`
+		merge     = "application/merge-patch+json"
+		jsonPatch = "application/json-patch+json"
+	)
+	errDisk := errors.New("disk full")
+	cases := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		ifMatch     string
+		body        string
+		// prepare changes the vehicles before the request
+		prepare func(t *testing.T, sv internal.VehicleService, jr *repository.VehicleJournalMemory)
+		status  int
+	}{
+		// router
+		{name: "unknown route", method: "GET", target: "/foo", status: 404},
+		{name: "method not allowed", method: "PUT", target: "/audit", status: 405},
+
+		// GET /vehicles
+		{name: "list filter unknown field", method: "GET", target: "/vehicles?filter=eq(foo,1)", status: 400},
+		{name: "list filter malformed", method: "GET", target: "/vehicles?filter=eq(year,2000", status: 400},
+		{name: "list filter NaN", method: "GET", target: "/vehicles?filter=eq(passengers,NaN)", status: 400},
+		{name: "list limit", method: "GET", target: "/vehicles?limit=-1", status: 400},
+		{name: "list offset", method: "GET", target: "/vehicles?offset=abc", status: 400},
+		{name: "list sort", method: "GET", target: "/vehicles?sort=foo", status: 400},
+		{name: "list cursor", method: "GET", target: "/vehicles?cursor=abc", status: 400},
+		{name: "list as_of malformed", method: "GET", target: "/vehicles?as_of=yesterday", status: 400},
+
+		// GET /vehicles/{id}
+		{name: "get id", method: "GET", target: "/vehicles/abc", status: 400},
+		{name: "get not found", method: "GET", target: "/vehicles/99", status: 404},
+		{name: "get trashed", method: "GET", target: "/vehicles/3", status: 404},
+		{name: "get as_of malformed", method: "GET", target: "/vehicles/1?as_of=yesterday", status: 400},
+		{name: "get as_of before it was loaded", method: "GET", target: "/vehicles/1?as_of=2000-01-01T00:00:00Z", status: 404},
+
+		// GET /vehicles/registration/{plate}
+		{name: "registration empty", method: "GET", target: "/vehicles/registration/%20", status: 400},
+		{name: "registration not found", method: "GET", target: "/vehicles/registration/ZZ-999", status: 404},
+
+		// POST /vehicles
+		{name: "save body", method: "POST", target: "/vehicles", body: `{"brand":`, status: 400},
+		{name: "save invalid", method: "POST", target: "/vehicles", body: invalid, status: 400},
+		{name: "save plate", method: "POST", target: "/vehicles", body: strings.Replace(valid, "GH-012", "0", 1), status: 400},
+		{name: "save conflict", method: "POST", target: "/vehicles", body: conflict, status: 409},
+		{name: "save not persisted", method: "POST", target: "/vehicles", body: valid, prepare: failJournal(errDisk), status: 500},
+
+		// POST /vehicles/batch
+		{name: "batch mode", method: "POST", target: "/vehicles/batch?mode=foo", body: "[" + valid + "]", status: 400},
+		{name: "batch body", method: "POST", target: "/vehicles/batch", body: valid, status: 400},
+		{name: "batch invalid", method: "POST", target: "/vehicles/batch", body: "[" + valid + "," + invalid + "]", status: 400},
+		{name: "batch conflict", method: "POST", target: "/vehicles/batch", body: "[" + conflict + "]", status: 409},
+		{name: "batch conflict in the batch", method: "POST", target: "/vehicles/batch", body: "[" + valid + "," + valid + "]", status: 409},
+		{name: "batch not persisted", method: "POST", target: "/vehicles/batch", body: "[" + valid + "]", prepare: failJournal(errDisk), status: 500},
+
+		// PUT /vehicles/{id}
+		{name: "update id", method: "PUT", target: "/vehicles/abc", body: valid, status: 400},
+		{name: "update body", method: "PUT", target: "/vehicles/1", body: `[]`, status: 400},
+		{name: "update id mismatch", method: "PUT", target: "/vehicles/1", body: `{"id":2}`, status: 400},
+		{name: "update not found", method: "PUT", target: "/vehicles/99", body: valid, status: 404},
+		{name: "update invalid", method: "PUT", target: "/vehicles/1", body: invalid, status: 400},
+		{name: "update conflict", method: "PUT", target: "/vehicles/1", body: conflict, status: 409},
+		{name: "update version", method: "PUT", target: "/vehicles/1", ifMatch: `"7"`, body: valid, status: 412},
+		{name: "update not persisted", method: "PUT", target: "/vehicles/1", body: valid, prepare: failJournal(errDisk), status: 500},
+
+		// PATCH /vehicles/{id}
+		{name: "patch content type", method: "PATCH", target: "/vehicles/1", contentType: "application/json", body: `{}`, status: 415},
+		{name: "patch id", method: "PATCH", target: "/vehicles/abc", contentType: merge, body: `{}`, status: 400},
+		{name: "patch merge malformed", method: "PATCH", target: "/vehicles/1", contentType: merge, body: `{"max_speed":`, status: 400},
+		{name: "patch merge not an object", method: "PATCH", target: "/vehicles/1", contentType: merge, body: `[]`, status: 400},
+		{name: "patch unknown field", method: "PATCH", target: "/vehicles/1", contentType: merge, body: `{"foo":1}`, status: 400},
+		{name: "patch id changed", method: "PATCH", target: "/vehicles/1", contentType: merge, body: `{"id":2}`, status: 400},
+		{name: "patch not found", method: "PATCH", target: "/vehicles/99", contentType: merge, body: `{}`, status: 404},
+		{name: "patch invalid", method: "PATCH", target: "/vehicles/1", contentType: merge, body: `{"brand":null}`, status: 400},
+		{name: "patch conflict", method: "PATCH", target: "/vehicles/1", contentType: merge, body: `{"registration":"CD-456"}`, status: 409},
+		{name: "patch version", method: "PATCH", target: "/vehicles/1", contentType: merge, ifMatch: `"7"`, body: `{}`, status: 412},
+		{name: "patch json malformed", method: "PATCH", target: "/vehicles/1", contentType: jsonPatch, body: `{}`, status: 400},
+		{name: "patch json operation", method: "PATCH", target: "/vehicles/1", contentType: jsonPatch, body: `[{"op":"foo","path":"/color"}]`, status: 400},
+		{name: "patch json test", method: "PATCH", target: "/vehicles/1", contentType: jsonPatch, body: `[{"op":"test","path":"/color","value":"Blue"}]`, status: 409},
+		{name: "patch not persisted", method: "PATCH", target: "/vehicles/1", contentType: merge, body: `{"max_speed":150}`, prepare: failJournal(errDisk), status: 500},
+
+		// PATCH /vehicles/{id}/update_speed and /vehicles/{id}/update_fuel
+		{name: "update speed id", method: "PATCH", target: "/vehicles/abc/update_speed", body: `{"max_speed":150}`, status: 400},
+		{name: "update speed body", method: "PATCH", target: "/vehicles/1/update_speed", body: `150`, status: 400},
+		{name: "update speed not found", method: "PATCH", target: "/vehicles/99/update_speed", body: `{"max_speed":150}`, status: 404},
+		{name: "update speed invalid", method: "PATCH", target: "/vehicles/1/update_speed", body: `{"max_speed":null}`, status: 400},
+		{name: "update fuel id", method: "PATCH", target: "/vehicles/abc/update_fuel", body: `{"fuel_type":"diesel"}`, status: 400},
+		{name: "update fuel not found", method: "PATCH", target: "/vehicles/99/update_fuel", body: `{"fuel_type":"diesel"}`, status: 404},
+		{name: "update fuel invalid", method: "PATCH", target: "/vehicles/1/update_fuel", body: `{"fuel_type":"steam"}`, status: 400},
+
+		// DELETE /vehicles/{id}
+		{name: "delete id", method: "DELETE", target: "/vehicles/abc", status: 400},
+		{name: "delete not found", method: "DELETE", target: "/vehicles/99", status: 404},
+		{name: "delete trashed", method: "DELETE", target: "/vehicles/3", status: 404},
+		{name: "delete version", method: "DELETE", target: "/vehicles/1", ifMatch: `"7"`, status: 412},
+		{name: "delete not persisted", method: "DELETE", target: "/vehicles/1", prepare: failJournal(errDisk), status: 500},
+
+		// POST /vehicles/{id}/restore
+		{name: "restore id", method: "POST", target: "/vehicles/abc/restore", status: 400},
+		{name: "restore not in the trash", method: "POST", target: "/vehicles/1/restore", status: 404},
+		{name: "restore conflict", method: "POST", target: "/vehicles/3/restore", prepare: func(t *testing.T, sv internal.VehicleService, jr *repository.VehicleJournalMemory) {
+			vehicle := newTestVehicle(0, "ef-789")
+			if err := sv.Save(&vehicle); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+		}, status: 409},
+		{name: "restore not persisted", method: "POST", target: "/vehicles/3/restore", prepare: failJournal(errDisk), status: 500},
+
+		// DELETE /vehicles/trash and /vehicles/trash/{id}
+		{name: "empty trash before", method: "DELETE", target: "/vehicles/trash?before=yesterday", status: 400},
+		{name: "empty trash not persisted", method: "DELETE", target: "/vehicles/trash", prepare: failJournal(errDisk), status: 500},
+		{name: "purge id", method: "DELETE", target: "/vehicles/trash/abc", status: 400},
+		{name: "purge not in the trash", method: "DELETE", target: "/vehicles/trash/1", status: 404},
+		{name: "purge not persisted", method: "DELETE", target: "/vehicles/trash/3", prepare: failJournal(errDisk), status: 500},
+
+		// GET /vehicles/trash
+		{name: "trash limit", method: "GET", target: "/vehicles/trash?limit=abc", status: 400},
+
+		// GET /vehicles/color/{color}/year/{year}
+		{name: "color year", method: "GET", target: "/vehicles/color/Red/year/abc", status: 400},
+		{name: "color year limit", method: "GET", target: "/vehicles/color/Red/year/2015?limit=abc", status: 400},
+		{name: "color year not found", method: "GET", target: "/vehicles/color/Red/year/1990", status: 404},
+
+		// GET /vehicles/brand/{brand}/between/{start_year}/{end_year}
+		{name: "brand start year", method: "GET", target: "/vehicles/brand/Ford/between/abc/2020", status: 400},
+		{name: "brand end year", method: "GET", target: "/vehicles/brand/Ford/between/2010/abc", status: 400},
+		{name: "brand limit", method: "GET", target: "/vehicles/brand/Ford/between/2010/2020?limit=abc", status: 400},
+		{name: "brand not found", method: "GET", target: "/vehicles/brand/Fiat/between/2010/2020", status: 404},
+
+		// GET /vehicles/average_speed/brand/{brand} and /vehicles/average_capacity/brand/{brand}
+		{name: "average speed not found", method: "GET", target: "/vehicles/average_speed/brand/Fiat", status: 404},
+		{name: "average capacity not found", method: "GET", target: "/vehicles/average_capacity/brand/Fiat", status: 404},
+
+		// GET /vehicles/fuel_type/{type} and /vehicles/transmission/{type}
+		{name: "fuel type limit", method: "GET", target: "/vehicles/fuel_type/gasoline?limit=abc", status: 400},
+		{name: "fuel type not found", method: "GET", target: "/vehicles/fuel_type/diesel", status: 404},
+		{name: "transmission limit", method: "GET", target: "/vehicles/transmission/manual?limit=abc", status: 400},
+		{name: "transmission not found", method: "GET", target: "/vehicles/transmission/automatic", status: 404},
+
+		// GET /vehicles/dimensions
+		{name: "dimensions unknown bound", method: "GET", target: "/vehicles/dimensions?min_foo=1", status: 400},
+		{name: "dimensions not a number", method: "GET", target: "/vehicles/dimensions?min_height=abc", status: 400},
+		{name: "dimensions NaN", method: "GET", target: "/vehicles/dimensions?max_width=NaN", status: 400},
+		{name: "dimensions empty range", method: "GET", target: "/vehicles/dimensions?min_height=2&max_height=1", status: 400},
+		{name: "dimensions limit", method: "GET", target: "/vehicles/dimensions?limit=abc", status: 400},
+
+		// GET /vehicles/weight
+		{name: "weight min", method: "GET", target: "/vehicles/weight?weight_min=abc", status: 400},
+		{name: "weight max", method: "GET", target: "/vehicles/weight?weight_max=abc", status: 400},
+		{name: "weight NaN", method: "GET", target: "/vehicles/weight?weight_min=NaN", status: 400},
+		{name: "weight limit", method: "GET", target: "/vehicles/weight?limit=abc", status: 400},
+
+		// GET /vehicles/stats
+		{name: "stats metric malformed", method: "GET", target: "/vehicles/stats?metrics=avg(max_speed", status: 400},
+		{name: "stats metric unknown", method: "GET", target: "/vehicles/stats?metrics=median(max_speed)", status: 400},
+		{name: "stats group unknown", method: "GET", target: "/vehicles/stats?group_by=foo", status: 400},
+		{name: "stats filter", method: "GET", target: "/vehicles/stats?filter=eq(foo,1)", status: 400},
+
+		// GET /vehicles/{id}/history
+		{name: "history id", method: "GET", target: "/vehicles/abc/history", status: 400},
+		{name: "history not found", method: "GET", target: "/vehicles/99/history", status: 404},
+
+		// GET /audit
+		{name: "audit since", method: "GET", target: "/audit?since=yesterday", status: 400},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rt, sv, jr := newTestRouter()
+			if c.prepare != nil {
+				c.prepare(t, sv, jr)
+			}
+			req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+			if c.ifMatch != "" {
+				req.Header.Set("If-Match", c.ifMatch)
+			}
+			res := httptest.NewRecorder()
+			rt.ServeHTTP(res, req)
+
+			if res.Code != c.status {
+				t.Fatalf("%s %s: status %d, want %d: %s", c.method, c.target, res.Code, c.status, res.Body)
+			}
+			if contentType := res.Header().Get("Content-Type"); contentType != MediaTypeProblem {
+				t.Fatalf("%s %s: content type %q, want %q", c.method, c.target, contentType, MediaTypeProblem)
+			}
+		})
+	}
+}
+
+// failJournal is a function that returns a preparation that makes the journal fail with err
+func failJournal(err error) func(t *testing.T, sv internal.VehicleService, jr *repository.VehicleJournalMemory) {
+	return func(t *testing.T, sv internal.VehicleService, jr *repository.VehicleJournalMemory) {
+		jr.Fail(err)
+	}
+}
+
+// TestVehicleDefault_MergePatch checks that a merge patch sets the members it has, even to a zero value, clears the
+// members that are null, leaves alone the ones it does not have and rejects the ones a vehicle does not have
+func TestVehicleDefault_MergePatch(t *testing.T) {
+	base := newVehicleJSON(newTestVehicle(1, "AB-123"))
+	cases := []struct {
+		name   string
+		body   string
+		status int
+		// change is applied to vehicle 1 to get the vehicle expected after the patch
+		change func(v *VehicleJSON)
+	}{
+		{name: "empty", body: `{}`, status: 200, change: func(v *VehicleJSON) {}},
+		{name: "set", body: `{"color":"Blue","max_speed":150.5}`, status: 200, change: func(v *VehicleJSON) { v.Color, v.MaxSpeed = "Blue", 150.5 }},
+		{name: "null clears", body: `{"weight":null,"height":null}`, status: 200, change: func(v *VehicleJSON) { v.Weight, v.Height = 0, 0 }},
+		{name: "zero sets", body: `{"width":0,"length":0}`, status: 200, change: func(v *VehicleJSON) { v.Width, v.Length = 0, 0 }},
+		{name: "empty string sets", body: `{"fuel_type":""}`, status: 200, change: func(v *VehicleJSON) { v.FuelType = "" }},
+		{name: "null and set", body: `{"weight":null,"brand":"Fiat"}`, status: 200, change: func(v *VehicleJSON) { v.Weight, v.Brand = 0, "Fiat" }},
+		{name: "same id and version", body: `{"id":1,"version":1,"model":"Fiesta"}`, status: 200, change: func(v *VehicleJSON) { v.Model = "Fiesta" }},
+		{name: "null of a required field", body: `{"model":null}`, status: 400},
+		{name: "empty string of a required field", body: `{"model":""}`, status: 400},
+		{name: "zero of a required field", body: `{"passengers":0}`, status: 400},
+		{name: "unknown field", body: `{"foo":1}`, status: 400},
+		{name: "unknown field with a known one", body: `{"color":"Blue","dimensions":{"height":2}}`, status: 400},
+		{name: "null unknown field", body: `{"foo":null}`, status: 200, change: func(v *VehicleJSON) {}},
+		{name: "wrong type", body: `{"weight":"heavy"}`, status: 400},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rt, sv, _ := newTestRouter()
+			res := serveTest(rt, "PATCH", "/vehicles/1", c.body, "Content-Type", "application/merge-patch+json")
+			if res.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", res.Code, c.status, res.Body)
+			}
+			stored, err := sv.GetByID(1)
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			got := newVehicleJSON(stored)
+			got.Version = base.Version
+			if c.status != 200 {
+				// - a rejected patch changes nothing
+				if got != base || stored.Version != 1 {
+					t.Fatalf("vehicle %+v version %d after a rejected patch, want %+v version 1", got, stored.Version, base)
+				}
+				return
+			}
+			want := base
+			c.change(&want)
+			if got != want {
+				t.Fatalf("vehicle %+v, want %+v", got, want)
+			}
+			var body struct {
+				Data VehicleJSON `json:"data"`
+			}
+			decodeTest(t, res, &body)
+			if body.Data.Version != stored.Version || body.Data.Color != want.Color {
+				t.Fatalf("response %+v, want the stored vehicle %+v", body.Data, stored)
+			}
+		})
+	}
+}
+
+// TestVehicleDefault_FoldedText checks that the finders, the filters and the registration lookup match the text
+// fields ignoring case and accents, while the vehicles keep their spelling
+func TestVehicleDefault_FoldedText(t *testing.T) {
+	rt, sv, _ := newTestRouter()
+	for i, brand := range []string{"Citroën", "CITROEN", "citroen"} {
+		vehicle := newTestVehicle(0, fmt.Sprintf("CITROËN-%d", i))
+		vehicle.Brand, vehicle.Model, vehicle.FuelType, vehicle.Transmission = brand, "Berlingo", "diesel", "automatic"
+		vehicle.MaxSpeed, vehicle.Capacity = float64(150+10*i), 2+2*i
+		if err := sv.Save(&vehicle); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	list := func(t *testing.T, target string) {
+		t.Helper()
+		res := serveTest(rt, "GET", target, "")
+		if res.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200: %s", target, res.Code, res.Body)
+		}
+		var body struct {
+			Data []VehicleJSON `json:"data"`
+		}
+		decodeTest(t, res, &body)
+		brands := make(map[string]bool)
+		for _, v := range body.Data {
+			brands[v.Brand] = true
+		}
+		if len(body.Data) != 3 || !brands["Citroën"] || !brands["CITROEN"] || !brands["citroen"] {
+			t.Fatalf("%s: %d vehicles of brands %v, want the 3 spellings", target, len(body.Data), brands)
+		}
+	}
+	average := func(t *testing.T, target string, want float64) {
+		t.Helper()
+		res := serveTest(rt, "GET", target, "")
+		// - the average is the only number of the body
+		var body map[string]any
+		decodeTest(t, res, &body)
+		for _, value := range body {
+			if got, ok := value.(float64); ok {
+				if got != want {
+					t.Fatalf("%s: average %v, want %v", target, got, want)
+				}
+				return
+			}
+		}
+		t.Fatalf("%s: no average in %v", target, body)
+	}
+
+	for _, brand := range []string{"Citroën", "CITROEN", "citroen", "CITROËN"} {
+		t.Run(brand, func(t *testing.T) {
+			q := url.PathEscape(brand)
+			list(t, "/vehicles/brand/"+q+"/between/2015/2015")
+			list(t, "/vehicles?filter="+url.QueryEscape("eq(brand,"+brand+")"))
+			list(t, "/vehicles?filter="+url.QueryEscape("and(in(brand,Peugeot,'"+brand+"'),prefix(model,BERLIN))"))
+			list(t, "/vehicles?filter="+url.QueryEscape("contains(brand,"+brand[2:5]+")"))
+			average(t, "/vehicles/average_speed/brand/"+q, 160)
+			average(t, "/vehicles/average_capacity/brand/"+q, 4)
+		})
+	}
+	list(t, "/vehicles/fuel_type/DI%C3%89SEL")
+	list(t, "/vehicles/transmission/Automatic")
+
+	// - the registration is found in any case, its accents are part of the plate
+	for _, plate := range []string{"CITROËN-0", "citroën-0", "Citroën-0"} {
+		res := serveTest(rt, "GET", "/vehicles/registration/"+url.PathEscape(plate), "")
+		var body struct {
+			Data VehicleJSON `json:"data"`
+		}
+		if decodeTest(t, res, &body); res.Code != http.StatusOK || body.Data.Brand != "Citroën" {
+			t.Fatalf("registration %s: status %d and brand %q, want 200 and Citroën", plate, res.Code, body.Data.Brand)
+		}
+	}
+}
+
+// TestVehicleDefault_Update checks that PUT replaces every field of the vehicle, the fields that are not sent are
+// set to their zero value, and that the version and the deletion time of the body are ignored
+func TestVehicleDefault_Update(t *testing.T) {
+	rt, sv, _ := newTestRouter()
+	body := `{"brand":"Renault","model":"Clio","registration":"ZX-987-AB","country":"FR","color":"Blue","year":2020,"passengers":4,"max_speed":170,"fuel_type":"diesel","transmission":"automatic","height":1.4,"version":7,"deleted_at":"2020-01-01T00:00:00Z"}`
+	res := serveTest(rt, "PUT", "/vehicles/1", body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", res.Code, http.StatusOK, res.Body)
+	}
+	want := VehicleJSON{
+		ID: 1, Version: 2, Brand: "Renault", Model: "Clio", Registration: "ZX-987-AB", Country: "FR", Color: "Blue",
+		FabricationYear: 2020, Capacity: 4, MaxSpeed: 170, FuelType: "diesel", Transmission: "automatic", Height: 1.4,
+	}
+	var got struct {
+		Data VehicleJSON `json:"data"`
+	}
+	if decodeTest(t, res, &got); got.Data != want {
+		t.Fatalf("response %+v, want %+v", got.Data, want)
+	}
+	if etag := res.Header().Get("ETag"); etag != `"2"` {
+		t.Fatalf("etag %s, want \"2\"", etag)
+	}
+	stored, err := sv.GetByID(1)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stored.Deleted() || newVehicleJSON(stored) != want {
+		t.Fatalf("stored %+v, want %+v", newVehicleJSON(stored), want)
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootcamp-go/web/response"
+	"github.com/go-chi/chi/v5"
+)
+
+// Trash is a method that returns a handler for the route GET /vehicles/trash
+// it accepts the page query params of GET /vehicles
+func (h *VehicleDefault) Trash() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		page, err := parsePageRequest(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+		// process
+		result, err := h.sv.FindTrash(page)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+		// response
+		response.JSON(w, http.StatusOK, newPageJSON("success", result, page))
+	}
+}
+
+// Restore is a method that returns a handler for the route POST /vehicles/{id}/restore
+func (h *VehicleDefault) Restore() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problemDetail(w, r, errBadRequest, "invalid vehicle id")
+			return
+		}
+		// process
+		vehicle, err := h.service(r).Restore(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, internal.ErrNotFound):
+				problemDetail(w, r, err, "vehicle not found in the trash")
+			default:
+				problem(w, r, err)
+			}
+			return
+		}
+		// response
+		w.Header().Set("ETag", vehicleETag(vehicle))
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "Restored successfully",
+			"data":    newVehicleJSON(vehicle),
+		})
+	}
+}
+
+// Purge is a method that returns a handler for the route DELETE /vehicles/trash/{id}
+func (h *VehicleDefault) Purge() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problemDetail(w, r, errBadRequest, "invalid vehicle id")
+			return
+		}
+		// process
+		if err := h.service(r).Purge(id); err != nil {
+			switch {
+			case errors.Is(err, internal.ErrNotFound):
+				problemDetail(w, r, err, "vehicle not found in the trash")
+			default:
+				problem(w, r, err)
+			}
+			return
+		}
+		// response
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "Purged successfully",
+		})
+	}
+}
+
+// EmptyTrash is a method that returns a handler for the route DELETE /vehicles/trash
+// every vehicle in the trash is purged, or only the ones deleted before the optional query param before,
+// a RFC 3339 time
+func (h *VehicleDefault) EmptyTrash() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		before := time.Now()
+		if query := r.URL.Query().Get("before"); query != "" {
+			var err error
+			if before, err = time.Parse(time.RFC3339, query); err != nil {
+				problemDetail(w, r, errBadRequest, "invalid before, expected a RFC 3339 time")
+				return
+			}
+		}
+		// process
+		purged, err := h.service(r).PurgeTrash(before)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+		// response
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "Purged successfully",
+			"data": map[string]any{
+				"purged": purged,
+			},
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package loader
+
+import (
+	"app/internal"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// NewValidationRulesJSONFile is a function that returns a new instance of ValidationRulesJSONFile
+func NewValidationRulesJSONFile(path string) *ValidationRulesJSONFile {
+	return &ValidationRulesJSONFile{
+		path: path,
+	}
+}
+
+// ValidationRulesJSONFile is a struct that implements the ValidationRulesLoader interface
+// the file has the constraints of each field and the rules between fields, the filters of the rules have the
+// JSON form of internal.Filter. The bounds of a field are not checked when it is 0, a field that is not set, unless
+// it is required, see internal.FieldRule, for example
+//
+//	{
+//	  "fields": {
+//	    "year": {"required": true, "min": 1900, "max": 2100},
+//	    "transmission": {"required": true, "enum": ["manual", "automatic", "semi-automatic"]},
+//	    "registration": {"pattern": "^[A-Z0-9 -]*$"}
+//	  },
+//	  "rules": [{
+//	    "name": "electric_transmission",
+//	    "field": "transmission",
+//	    "when": {"op": "eq", "field": "fuel_type", "values": ["electric"]},
+//	    "assert": {"op": "ne", "field": "transmission", "values": ["manual"]},
+//	    "message": "electric vehicles can not have a manual transmission"
+//	  }]
+//	}
+type ValidationRulesJSONFile struct {
+	// path is the path to the file that contains the rules in JSON format
+	path string
+}
+
+// FieldRuleJSON is a struct that represents the constraints of a field in JSON format
+type FieldRuleJSON struct {
+	Required bool     `json:"required"`
+	Min      *float64 `json:"min"`
+	Max      *float64 `json:"max"`
+	Enum     []string `json:"enum"`
+	Pattern  string   `json:"pattern"`
+}
+
+// FilterJSON is a struct that represents a filter in JSON format
+type FilterJSON struct {
+	Op      string       `json:"op"`
+	Field   string       `json:"field"`
+	Values  []any        `json:"values"`
+	Filters []FilterJSON `json:"filters"`
+}
+
+// filter is a method that serializes FilterJSON to a filter
+func (f FilterJSON) filter() internal.Filter {
+	filter := internal.Filter{Op: internal.FilterOp(f.Op), Field: f.Field, Values: f.Values}
+	for _, child := range f.Filters {
+		filter.Filters = append(filter.Filters, child.filter())
+	}
+	return filter
+}
+
+// CrossFieldRuleJSON is a struct that represents a rule between fields in JSON format
+type CrossFieldRuleJSON struct {
+	Name    string     `json:"name"`
+	Field   string     `json:"field"`
+	When    FilterJSON `json:"when"`
+	Assert  FilterJSON `json:"assert"`
+	Message string     `json:"message"`
+}
+
+// ValidationRulesJSON is a struct that represents the validation rules in JSON format
+type ValidationRulesJSON struct {
+	Fields map[string]FieldRuleJSON `json:"fields"`
+	Rules  []CrossFieldRuleJSON     `json:"rules"`
+}
+
+// Load is a method that loads the rules
+func (l *ValidationRulesJSONFile) Load() (rules *internal.ValidationRules, err error) {
+	// open file
+	file, err := os.Open(l.path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	// decode file
+	var rulesJSON ValidationRulesJSON
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&rulesJSON); err != nil {
+		return nil, fmt.Errorf("%w: %w", internal.ErrInvalidRules, err)
+	}
+
+	// serialize rules
+	rules = &internal.ValidationRules{Fields: make(map[string]internal.FieldRule, len(rulesJSON.Fields))}
+	for name, rl := range rulesJSON.Fields {
+		rule := internal.FieldRule{Required: rl.Required, Min: rl.Min, Max: rl.Max, Enum: rl.Enum}
+		if rl.Pattern != "" {
+			if rule.Pattern, err = regexp.Compile(rl.Pattern); err != nil {
+				return nil, fmt.Errorf("%w: pattern of %q: %w", internal.ErrInvalidRules, name, err)
+			}
+		}
+		rules.Fields[name] = rule
+	}
+	for _, rl := range rulesJSON.Rules {
+		rules.Rules = append(rules.Rules, internal.CrossFieldRule{
+			Name:    rl.Name,
+			Field:   rl.Field,
+			When:    rl.When.filter(),
+			Assert:  rl.Assert.filter(),
+			Message: rl.Message,
+		})
+	}
+	return
+}
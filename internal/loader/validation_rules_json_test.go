@@ -0,0 +1,134 @@
+package loader
+
+import (
+	"app/internal"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testValidationRules are valid rules in JSON format
+const testValidationRules = `{
+	"fields": {
+		"year": {"required": true, "min": 1900, "max": 2100},
+		"transmission": {"enum": ["manual", "automatic"]},
+		"registration": {"pattern": "^[A-Z0-9 -]*$"}
+	},
+	"rules": [{
+		"name": "electric_transmission",
+		"field": "transmission",
+		"when": {"op": "eq", "field": "fuel_type", "values": ["electric"]},
+		"assert": {"op": "and", "filters": [{"op": "ne", "field": "transmission", "values": ["manual"]}]},
+		"message": "electric vehicles can not have a manual transmission"
+	}]
+}`
+
+// writeTestRules is a function that writes the rules file of a loader
+func writeTestRules(t *testing.T, path, rules string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+// TestValidationRulesJSONFile_Load checks that the file is read into the rules it describes
+func TestValidationRulesJSONFile_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeTestRules(t, path, testValidationRules)
+
+	rules, err := NewValidationRulesJSONFile(path).Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err = rules.Check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	year := rules.Fields["year"]
+	if !year.Required || year.Min == nil || *year.Min != 1900 || year.Max == nil || *year.Max != 2100 {
+		t.Fatalf("year rule %+v, want required between 1900 and 2100", year)
+	}
+	if got := rules.Fields["transmission"].Enum; !reflect.DeepEqual(got, []string{"manual", "automatic"}) {
+		t.Fatalf("transmission enum %v", got)
+	}
+	if pattern := rules.Fields["registration"].Pattern; pattern == nil || !pattern.MatchString("AB 123") || pattern.MatchString("ab") {
+		t.Fatalf("registration pattern %v", pattern)
+	}
+	want := internal.CrossFieldRule{
+		Name:    "electric_transmission",
+		Field:   "transmission",
+		When:    internal.Filter{Op: internal.FilterEq, Field: "fuel_type", Values: []any{"electric"}},
+		Assert:  internal.Filter{Op: internal.FilterAnd, Filters: []internal.Filter{{Op: internal.FilterNe, Field: "transmission", Values: []any{"manual"}}}},
+		Message: "electric vehicles can not have a manual transmission",
+	}
+	if len(rules.Rules) != 1 || !reflect.DeepEqual(rules.Rules[0], want) {
+		t.Fatalf("rules %+v, want %+v", rules.Rules, want)
+	}
+}
+
+// TestValidationRulesJSONFile_LoadInvalid checks that the files that can not be read into rules are rejected
+func TestValidationRulesJSONFile_LoadInvalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		rules string
+	}{
+		{name: "malformed", rules: `{"fields": `},
+		{name: "unknown key", rules: `{"fields": {"year": {"minimum": 1900}}}`},
+		{name: "invalid pattern", rules: `{"fields": {"registration": {"pattern": "["}}}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			writeTestRules(t, path, c.rules)
+			if _, err := NewValidationRulesJSONFile(path).Load(); !errors.Is(err, internal.ErrInvalidRules) {
+				t.Fatalf("got %v, want %v", err, internal.ErrInvalidRules)
+			}
+		})
+	}
+}
+
+// TestVehicleValidator_Reload checks that a reload replaces the rules with the ones of the file and keeps the last
+// good rules while the file is missing, malformed or not well formed
+func TestVehicleValidator_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	rl := NewValidationRulesJSONFile(path)
+	vr := internal.NewVehicleValidator(internal.DefaultValidationRules)
+	old := internal.Vehicle{VehicleAttributes: internal.VehicleAttributes{FabricationYear: 1850}}
+
+	writeTestRules(t, path, `{"fields": {"year": {"min": 1900}}}`)
+	if err := vr.Reload(rl); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	good := vr.Rules()
+	if got := vr.Validate(old); !reflect.DeepEqual(got, map[string][]string{"year": {"must be at least 1900"}}) {
+		t.Fatalf("violations %v with the rules of the file", got)
+	}
+
+	invalid := []struct {
+		name  string
+		write func()
+		want  error
+	}{
+		{name: "min greater than max", write: func() { writeTestRules(t, path, `{"fields": {"year": {"min": 2100, "max": 1900}}}`) }, want: internal.ErrInvalidRules},
+		{name: "malformed", write: func() { writeTestRules(t, path, `{"fields": {"year": `) }, want: internal.ErrInvalidRules},
+		{name: "missing", write: func() { os.Remove(path) }, want: os.ErrNotExist},
+	}
+	for _, c := range invalid {
+		c.write()
+		if err := vr.Reload(rl); !errors.Is(err, c.want) {
+			t.Fatalf("reload of a %s file: got %v, want %v", c.name, err, c.want)
+		}
+		if vr.Rules() != good {
+			t.Fatalf("the rules were replaced by a %s file", c.name)
+		}
+	}
+
+	writeTestRules(t, path, `{"fields": {"year": {"min": 1800}}}`)
+	if err := vr.Reload(rl); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := vr.Validate(old); got != nil {
+		t.Fatalf("violations %v with the fixed file, want none", got)
+	}
+}
@@ -2,8 +2,12 @@ package loader
 
 import (
 	"app/internal"
+	"bytes"
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"sort"
+	"time"
 )
 
 // NewVehicleJSONFile is a function that returns a new instance of VehicleJSONFile
@@ -21,20 +25,95 @@ type VehicleJSONFile struct {
 
 // VehicleJSON is a struct that represents a vehicle in JSON format
 type VehicleJSON struct {
-	Id              int     `json:"id"`
-	Brand           string  `json:"brand"`
-	Model           string  `json:"model"`
-	Registration    string  `json:"registration"`
-	Color           string  `json:"color"`
-	FabricationYear int     `json:"year"`
-	Capacity        int     `json:"passengers"`
-	MaxSpeed        float64 `json:"max_speed"`
-	FuelType        string  `json:"fuel_type"`
-	Transmission    string  `json:"transmission"`
-	Weight          float64 `json:"weight"`
-	Height          float64 `json:"height"`
-	Length          float64 `json:"length"`
-	Width           float64 `json:"width"`
+	Id              int        `json:"id"`
+	Version         int        `json:"version"`
+	Brand           string     `json:"brand"`
+	Model           string     `json:"model"`
+	Registration    string     `json:"registration"`
+	Country         string     `json:"country,omitempty"`
+	Color           string     `json:"color"`
+	FabricationYear int        `json:"year"`
+	Capacity        int        `json:"passengers"`
+	MaxSpeed        float64    `json:"max_speed"`
+	FuelType        string     `json:"fuel_type"`
+	Transmission    string     `json:"transmission"`
+	Weight          float64    `json:"weight"`
+	Height          float64    `json:"height"`
+	Length          float64    `json:"length"`
+	Width           float64    `json:"width"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+}
+
+// newVehicleJSON is a function that deserializes a vehicle to VehicleJSON
+func newVehicleJSON(vh internal.Vehicle) (v VehicleJSON) {
+	v = VehicleJSON{
+		Id:              vh.Id,
+		Version:         vh.Version,
+		Brand:           vh.Brand,
+		Model:           vh.Model,
+		Registration:    vh.Registration,
+		Country:         vh.Country,
+		Color:           vh.Color,
+		FabricationYear: vh.FabricationYear,
+		Capacity:        vh.Capacity,
+		MaxSpeed:        vh.MaxSpeed,
+		FuelType:        vh.FuelType,
+		Transmission:    vh.Transmission,
+		Weight:          vh.Weight,
+		Height:          vh.Height,
+		Length:          vh.Length,
+		Width:           vh.Width,
+	}
+	if !vh.UpdatedAt.IsZero() {
+		updatedAt := vh.UpdatedAt
+		v.UpdatedAt = &updatedAt
+	}
+	if !vh.DeletedAt.IsZero() {
+		deletedAt := vh.DeletedAt
+		v.DeletedAt = &deletedAt
+	}
+	return v
+}
+
+// vehicle is a method that serializes VehicleJSON to a vehicle
+// files written before vehicles had a version are read as the first version
+func (vh VehicleJSON) vehicle() internal.Vehicle {
+	if vh.Version == 0 {
+		vh.Version = 1
+	}
+	var updatedAt time.Time
+	if vh.UpdatedAt != nil {
+		updatedAt = *vh.UpdatedAt
+	}
+	var deletedAt time.Time
+	if vh.DeletedAt != nil {
+		deletedAt = *vh.DeletedAt
+	}
+	return internal.Vehicle{
+		Id:        vh.Id,
+		Version:   vh.Version,
+		UpdatedAt: updatedAt,
+		DeletedAt: deletedAt,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           vh.Brand,
+			Model:           vh.Model,
+			Registration:    vh.Registration,
+			Country:         vh.Country,
+			Color:           vh.Color,
+			FabricationYear: vh.FabricationYear,
+			Capacity:        vh.Capacity,
+			MaxSpeed:        vh.MaxSpeed,
+			FuelType:        vh.FuelType,
+			Transmission:    vh.Transmission,
+			Weight:          vh.Weight,
+			Dimensions: internal.Dimensions{
+				Height: vh.Height,
+				Length: vh.Length,
+				Width:  vh.Width,
+			},
+		},
+	}
 }
 
 // Load is a method that loads the vehicles
@@ -56,27 +135,88 @@ func (l *VehicleJSONFile) Load() (v map[int]internal.Vehicle, err error) {
 	// serialize vehicles
 	v = make(map[int]internal.Vehicle)
 	for _, vh := range vehiclesJSON {
-		v[vh.Id] = internal.Vehicle{
-			Id: vh.Id,
-			VehicleAttributes: internal.VehicleAttributes{
-				Brand:           vh.Brand,
-				Model:           vh.Model,
-				Registration:    vh.Registration,
-				Color:           vh.Color,
-				FabricationYear: vh.FabricationYear,
-				Capacity:        vh.Capacity,
-				MaxSpeed:        vh.MaxSpeed,
-				FuelType:        vh.FuelType,
-				Transmission:    vh.Transmission,
-				Weight:          vh.Weight,
-				Dimensions: internal.Dimensions{
-					Height: vh.Height,
-					Length: vh.Length,
-					Width:  vh.Width,
-				},
-			},
+		v[vh.Id] = vh.vehicle()
+	}
+
+	return
+}
+
+// Write is a method that writes the vehicles back to the file, readers never see a partially written file
+func (l *VehicleJSONFile) Write(v map[int]internal.Vehicle) (err error) {
+	// deserialize vehicles ordered by id
+	ids := make([]int, 0, len(v))
+	for id := range v {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	// encode vehicles, one per line like the original data file
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, id := range ids {
+		b, err := json.Marshal(newVehicleJSON(v[id]))
+		if err != nil {
+			return err
 		}
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		buf.Write(b)
 	}
+	buf.WriteString("]\n")
 
+	err = writeFile(l.path, buf.Bytes())
+	return
+}
+
+// writeFile is a function that replaces the file at path with data
+// data is written to a temporary file in the same directory which is then renamed over the original,
+// so readers never see a partially written file
+func writeFile(path string, data []byte) (err error) {
+	// write to a temporary file
+	dir := filepath.Dir(path)
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return
+	}
+	tmpPath := file.Name()
+	defer func() {
+		// remove the temporary file if something went wrong
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+	// keep the permissions of the original file
+	if info, statErr := os.Stat(path); statErr == nil {
+		if err = file.Chmod(info.Mode().Perm()); err != nil {
+			file.Close()
+			return
+		}
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return
+	}
+	// flush to disk before the rename so the new file is complete
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+
+	// replace the original file
+	if err = os.Rename(tmpPath, path); err != nil {
+		return
+	}
+
+	// sync the directory so the rename survives a crash
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	err = d.Sync()
 	return
 }
@@ -0,0 +1,290 @@
+package loader
+
+import (
+	"app/internal"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// NewVehicleJSONLog is a function that returns a new instance of VehicleJSONLog
+func NewVehicleJSONLog(path string) *VehicleJSONLog {
+	return &VehicleJSONLog{
+		path: path,
+	}
+}
+
+// VehicleJSONLog is a struct that implements the VehicleJournal and the VehicleHistory interfaces
+// every line is the crc32 of the payload in hex, a space and the payload in JSON format, the payload is a record or
+// the array of the records appended together, so they are read all or none,
+// a last line that is incomplete or does not match its checksum was torn by a crash and is discarded, any other
+// line that can not be read makes the log corrupted
+type VehicleJSONLog struct {
+	// path is the path to the log file
+	path string
+	// file is the log file opened for appending
+	file *os.File
+	// mu guards file
+	mu sync.Mutex
+}
+
+// VehicleRecordJSON is a struct that represents a record of the log in JSON format
+type VehicleRecordJSON struct {
+	Op      string      `json:"op"`
+	Vehicle VehicleJSON `json:"vehicle"`
+}
+
+var (
+	// errRecordCorrupted is an error that occurs when a record can not be read
+	errRecordCorrupted = errors.New("loader: record corrupted")
+)
+
+// Append is a method that durably appends records to the log
+// all the records are written in a single line and flushed to disk before returning, so a crash in the middle of
+// the write loses all of them, the records of a transaction are never replayed in part
+func (l *VehicleJSONLog) Append(records ...internal.VehicleRecord) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(records) == 0 {
+		return
+	}
+	// encode records
+	buf, err := encodeBatch(records)
+	if err != nil {
+		return
+	}
+
+	// write records
+	if err = l.open(); err != nil {
+		return
+	}
+	end, err := l.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	_, err = l.file.Write(buf.Bytes())
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		// drop a partial write so the next records are not appended after it
+		l.file.Truncate(end)
+		l.file.Seek(end, io.SeekStart)
+		return
+	}
+	return
+}
+
+// Replay is a method that calls fn for every record in the log, in order
+// the log is truncated after the last valid line, so the records torn by a crash are discarded, a line that can
+// not be read before the last one is an error that wraps errRecordCorrupted and the log is left as it is, so the
+// records after it are not lost
+func (l *VehicleJSONLog) Replay(fn func(record internal.VehicleRecord)) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err = l.open(); err != nil {
+		return
+	}
+	if _, err = l.file.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	// read records until the end of the log or a torn last one
+	var offset int64
+	rd := bufio.NewReader(l.file)
+	for n := 1; ; n++ {
+		line, readErr := rd.ReadBytes('\n')
+		if readErr != nil {
+			// an incomplete last line is a record torn by a crash
+			if readErr != io.EOF {
+				return readErr
+			}
+			break
+		}
+		records, decodeErr := decodeRecords(line)
+		if decodeErr != nil {
+			// only the last line can be torn by a crash, a line in the middle was damaged afterwards
+			if _, peekErr := rd.Peek(1); peekErr != io.EOF {
+				return fmt.Errorf("%w: line %d of %s", errRecordCorrupted, n, l.path)
+			}
+			break
+		}
+		for _, record := range records {
+			fn(record)
+		}
+		offset += int64(len(line))
+	}
+
+	// discard anything after the last valid record
+	if err = l.file.Truncate(offset); err != nil {
+		return
+	}
+	if _, err = l.file.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+	err = l.file.Sync()
+	return
+}
+
+// Reset is a method that discards every record in the log
+func (l *VehicleJSONLog) Reset() (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err = l.open(); err != nil {
+		return
+	}
+	if err = l.file.Truncate(0); err != nil {
+		return
+	}
+	if _, err = l.file.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	err = l.file.Sync()
+	return
+}
+
+// Rewrite is a method that replaces every record in the log at once
+// the records are written to a new file that is renamed over the log, so a crash leaves the old or the new records
+func (l *VehicleJSONLog) Rewrite(records []internal.VehicleRecord) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buf, err := encodeRecords(records)
+	if err != nil {
+		return
+	}
+	if err = writeFile(l.path, buf.Bytes()); err != nil {
+		return
+	}
+	// the open file is the replaced one, the next write opens the new one
+	if l.file != nil {
+		err = l.file.Close()
+		l.file = nil
+	}
+	return
+}
+
+// Close is a method that closes the log file
+func (l *VehicleJSONLog) Close() (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return
+	}
+	err = l.file.Close()
+	l.file = nil
+	return
+}
+
+// open is a method that opens the log file if it is not open yet, the caller must hold the lock
+func (l *VehicleJSONLog) open() (err error) {
+	if l.file != nil {
+		return
+	}
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	// writes always go to the end of the log
+	if _, err = file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return
+	}
+	l.file = file
+	return
+}
+
+// encodeRecords is a function that encodes records into lines of the log, one line per record
+func encodeRecords(records []internal.VehicleRecord) (buf bytes.Buffer, err error) {
+	for _, record := range records {
+		if err = encodeLine(&buf, newVehicleRecordJSON(record)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// encodeBatch is a function that encodes records into a single line of the log, an array unless there is only one
+func encodeBatch(records []internal.VehicleRecord) (buf bytes.Buffer, err error) {
+	if len(records) == 1 {
+		return encodeRecords(records)
+	}
+	rcs := make([]VehicleRecordJSON, len(records))
+	for i, record := range records {
+		rcs[i] = newVehicleRecordJSON(record)
+	}
+	err = encodeLine(&buf, rcs)
+	return
+}
+
+// encodeLine is a function that writes a payload in JSON format as a line of the log, after its checksum
+func encodeLine(buf *bytes.Buffer, v any) (err error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(buf, "%08x %s\n", crc32.ChecksumIEEE(payload), payload)
+	return
+}
+
+// newVehicleRecordJSON is a function that returns a record in JSON format
+func newVehicleRecordJSON(record internal.VehicleRecord) VehicleRecordJSON {
+	return VehicleRecordJSON{
+		Op:      string(record.Op),
+		Vehicle: newVehicleJSON(record.Vehicle),
+	}
+}
+
+// decodeRecords is a function that decodes a line of the log into its records
+func decodeRecords(line []byte) (records []internal.VehicleRecord, err error) {
+	// split checksum and payload
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	sum, payload, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		err = errRecordCorrupted
+		return
+	}
+	expected, err := strconv.ParseUint(string(sum), 16, 32)
+	if err != nil || uint32(expected) != crc32.ChecksumIEEE(payload) {
+		err = errRecordCorrupted
+		return
+	}
+
+	// decode payload, a record or an array of them
+	var rcs []VehicleRecordJSON
+	if bytes.HasPrefix(payload, []byte("[")) {
+		err = json.Unmarshal(payload, &rcs)
+	} else {
+		rcs = make([]VehicleRecordJSON, 1)
+		err = json.Unmarshal(payload, &rcs[0])
+	}
+	if err != nil || len(rcs) == 0 {
+		err = errRecordCorrupted
+		return
+	}
+	records = make([]internal.VehicleRecord, len(rcs))
+	for i, rc := range rcs {
+		switch internal.VehicleOp(rc.Op) {
+		case internal.VehicleOpCreate, internal.VehicleOpUpdate, internal.VehicleOpDelete, internal.VehicleOpPurge:
+		default:
+			err = errRecordCorrupted
+			return
+		}
+		records[i] = internal.VehicleRecord{
+			Op:      internal.VehicleOp(rc.Op),
+			Vehicle: rc.Vehicle.vehicle(),
+		}
+	}
+	return
+}
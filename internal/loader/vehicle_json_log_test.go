@@ -0,0 +1,184 @@
+package loader
+
+import (
+	"app/internal"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestLog is a function that returns a log in a temporary directory with a record for each vehicle id
+func newTestLog(t *testing.T, ids ...int) (l *VehicleJSONLog, path string) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "vehicles.log")
+	l = NewVehicleJSONLog(path)
+	t.Cleanup(func() { l.Close() })
+	for _, id := range ids {
+		record := internal.VehicleRecord{Op: internal.VehicleOpCreate, Vehicle: internal.Vehicle{Id: id, Version: 1}}
+		if err := l.Append(record); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	return
+}
+
+// replayIds is a function that replays a log and returns the ids of its records
+func replayIds(l *VehicleJSONLog) (ids []int, err error) {
+	err = l.Replay(func(record internal.VehicleRecord) {
+		ids = append(ids, record.Vehicle.Id)
+	})
+	return
+}
+
+// lineOffsets is a function that returns the offset where each line of a file starts
+func lineOffsets(t *testing.T, path string) (offsets []int64, b []byte) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var offset int64
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(line) == 0 {
+			break
+		}
+		offsets = append(offsets, offset)
+		offset += int64(len(line))
+	}
+	return
+}
+
+func equalIds(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestVehicleJSONLog_ReplayTornLastRecord checks that a last record cut by a crash is discarded and the log can
+// be appended to afterwards
+func TestVehicleJSONLog_ReplayTornLastRecord(t *testing.T) {
+	l, path := newTestLog(t, 1, 2, 3)
+	l.Close()
+
+	// - cut the last record in the middle
+	offsets, b := lineOffsets(t, path)
+	cut := offsets[2] + (int64(len(b))-offsets[2])/2
+	if err := os.Truncate(path, cut); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	l = NewVehicleJSONLog(path)
+	defer l.Close()
+	ids, err := replayIds(l)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if !equalIds(ids, []int{1, 2}) {
+		t.Fatalf("replayed %v, want [1 2]", ids)
+	}
+	// - the torn record was removed from the file
+	if info, _ := os.Stat(path); info.Size() != offsets[2] {
+		t.Fatalf("the log has %d bytes, want %d", info.Size(), offsets[2])
+	}
+	// - the next records follow the last valid one
+	if err = l.Append(internal.VehicleRecord{Op: internal.VehicleOpCreate, Vehicle: internal.Vehicle{Id: 4}}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if ids, err = replayIds(l); err != nil || !equalIds(ids, []int{1, 2, 4}) {
+		t.Fatalf("replayed %v, %v, want [1 2 4]", ids, err)
+	}
+}
+
+// TestVehicleJSONLog_ReplayBadChecksumLastRecord checks that a complete last record that does not match its
+// checksum is discarded
+func TestVehicleJSONLog_ReplayBadChecksumLastRecord(t *testing.T) {
+	l, path := newTestLog(t, 1, 2)
+	l.Close()
+
+	offsets, b := lineOffsets(t, path)
+	b[offsets[1]] ^= 0x01
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	l = NewVehicleJSONLog(path)
+	defer l.Close()
+	ids, err := replayIds(l)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if !equalIds(ids, []int{1}) {
+		t.Fatalf("replayed %v, want [1]", ids)
+	}
+}
+
+// TestVehicleJSONLog_ReplayCorruptedMiddleRecord checks that a damaged record before the last one is an error and
+// the records after it are kept in the file
+func TestVehicleJSONLog_ReplayCorruptedMiddleRecord(t *testing.T) {
+	l, path := newTestLog(t, 1, 2, 3)
+	l.Close()
+
+	offsets, b := lineOffsets(t, path)
+	b[offsets[1]+12] ^= 0x01
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	l = NewVehicleJSONLog(path)
+	defer l.Close()
+	if _, err := replayIds(l); !errors.Is(err, errRecordCorrupted) {
+		t.Fatalf("replay: got %v, want %v", err, errRecordCorrupted)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(after, b) {
+		t.Fatalf("the log was changed by a failed replay")
+	}
+}
+
+// TestVehicleJSONLog_ReplayTornBatch checks that the records appended together are discarded together when the
+// end of their line was torn by a crash
+func TestVehicleJSONLog_ReplayTornBatch(t *testing.T) {
+	l, path := newTestLog(t, 1)
+	batch := []internal.VehicleRecord{
+		{Op: internal.VehicleOpCreate, Vehicle: internal.Vehicle{Id: 2, Version: 1}},
+		{Op: internal.VehicleOpCreate, Vehicle: internal.Vehicle{Id: 3, Version: 1}},
+		{Op: internal.VehicleOpCreate, Vehicle: internal.Vehicle{Id: 4, Version: 1}},
+	}
+	if err := l.Append(batch...); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if ids, err := replayIds(l); err != nil || !equalIds(ids, []int{1, 2, 3, 4}) {
+		t.Fatalf("replayed %v, %v, want [1 2 3 4]", ids, err)
+	}
+	l.Close()
+
+	// - cut the end of the batch, the records before the cut are complete
+	offsets, b := lineOffsets(t, path)
+	if len(offsets) != 2 {
+		t.Fatalf("the log has %d lines, want 2", len(offsets))
+	}
+	if err := os.Truncate(path, int64(len(b))-20); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	l = NewVehicleJSONLog(path)
+	defer l.Close()
+	ids, err := replayIds(l)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if !equalIds(ids, []int{1}) {
+		t.Fatalf("replayed %v, want [1]", ids)
+	}
+}
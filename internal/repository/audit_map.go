@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"app/internal"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NewAuditMap is a function that returns a new instance of AuditMap
+func NewAuditMap() *AuditMap {
+	return &AuditMap{
+		byVehicle: make(map[int][]int),
+	}
+}
+
+// AuditMap is a struct that represents an audit store kept in memory
+// it is safe for concurrent use by multiple goroutines
+type AuditMap struct {
+	// mu guards entries and byVehicle
+	mu sync.RWMutex
+	// entries is the audit trail in the order it was appended
+	entries []internal.AuditEntry
+	// byVehicle are the positions in entries of the entries of each vehicle
+	byVehicle map[int][]int
+}
+
+// Append is a method that adds entries at the end of the audit trail, their Seq is set
+func (a *AuditMap) Append(entries ...*internal.AuditEntry) (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, entry := range entries {
+		entry.Seq = len(a.entries) + 1
+		a.byVehicle[entry.VehicleId] = append(a.byVehicle[entry.VehicleId], len(a.entries))
+		a.entries = append(a.entries, *entry)
+	}
+	return
+}
+
+// FindByVehicle is a method that returns the entries of a vehicle, oldest first
+func (a *AuditMap) FindByVehicle(id int) (entries []internal.AuditEntry, err error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	entries = make([]internal.AuditEntry, 0, len(a.byVehicle[id]))
+	for _, i := range a.byVehicle[id] {
+		entries = append(entries, a.entries[i])
+	}
+	return
+}
+
+// FindSince is a method that returns the entries made at or after a time, oldest first
+func (a *AuditMap) FindSince(since time.Time) (entries []internal.AuditEntry, err error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	// entries are appended in time order
+	i := sort.Search(len(a.entries), func(i int) bool { return !a.entries[i].Time.Before(since) })
+	entries = make([]internal.AuditEntry, len(a.entries)-i)
+	copy(entries, a.entries[i:])
+	return
+}
@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"app/internal"
+	"sort"
+)
+
+var (
+	// hashIndexFields are the categorical fields indexed by value
+	hashIndexFields = []string{"brand", "color", "fuel_type", "transmission"}
+	// sortedIndexFields are the numeric fields indexed in order, for ranges
+	sortedIndexFields = []string{"year", "weight", "max_speed", "height", "length", "width", "volume", "footprint"}
+)
+
+// newVehicleIndexes is a function that returns the secondary indexes of the vehicles
+func newVehicleIndexes(db map[int]internal.Vehicle) *vehicleIndexes {
+	ix := &vehicleIndexes{
+		hash:   make(map[string]hashIndex, len(hashIndexFields)),
+		sorted: make(map[string]*sortedIndex, len(sortedIndexFields)),
+		unique: make(map[internal.UniqueKey]hashIndex, len(internal.UniqueKeys)),
+	}
+	for _, field := range hashIndexFields {
+		ix.hash[field] = make(hashIndex)
+	}
+	for _, key := range internal.UniqueKeys {
+		ix.unique[key] = make(hashIndex)
+	}
+	for _, field := range sortedIndexFields {
+		ix.sorted[field] = &sortedIndex{}
+	}
+
+	// sorted indexes are built at once instead of inserting one by one
+	for _, vehicle := range db {
+		for field, index := range ix.hash {
+			index.add(hashKey(field, vehicle), vehicle.Id)
+		}
+		ix.addUnique(vehicle)
+		for field, index := range ix.sorted {
+			index.entries = append(index.entries, indexEntry{value: internal.VehicleFields[field].Value(vehicle).(float64), id: vehicle.Id})
+		}
+	}
+	for _, index := range ix.sorted {
+		sort.Slice(index.entries, func(i, j int) bool { return index.entries[i].less(index.entries[j]) })
+	}
+	return ix
+}
+
+// vehicleIndexes is a struct that represents the secondary indexes of the vehicles
+// hash indexes map categorical values to ids and sorted indexes keep numeric values in order,
+// the caller must keep them consistent with the db by calling add and remove on every change
+type vehicleIndexes struct {
+	// hash are the indexes of the categorical fields
+	hash map[string]hashIndex
+	// sorted are the indexes of the numeric fields
+	sorted map[string]*sortedIndex
+	// unique are the indexes of the unique keys, every key is indexed whether the policy enforces it or not,
+	// vehicles without a value for a key are left out of its index
+	unique map[internal.UniqueKey]hashIndex
+}
+
+// add is a method that indexes a vehicle
+func (ix *vehicleIndexes) add(vehicle internal.Vehicle) {
+	for field, index := range ix.hash {
+		index.add(hashKey(field, vehicle), vehicle.Id)
+	}
+	for field, index := range ix.sorted {
+		index.add(indexEntry{value: internal.VehicleFields[field].Value(vehicle).(float64), id: vehicle.Id})
+	}
+	ix.addUnique(vehicle)
+}
+
+// addUnique is a method that indexes the unique keys of a vehicle
+func (ix *vehicleIndexes) addUnique(vehicle internal.Vehicle) {
+	for key, index := range ix.unique {
+		if value := key.Value(vehicle); value != "" {
+			index.add(value, vehicle.Id)
+		}
+	}
+}
+
+// remove is a method that removes a vehicle from the indexes
+func (ix *vehicleIndexes) remove(vehicle internal.Vehicle) {
+	for field, index := range ix.hash {
+		index.remove(hashKey(field, vehicle), vehicle.Id)
+	}
+	for field, index := range ix.sorted {
+		index.remove(indexEntry{value: internal.VehicleFields[field].Value(vehicle).(float64), id: vehicle.Id})
+	}
+	for key, index := range ix.unique {
+		if value := key.Value(vehicle); value != "" {
+			index.remove(value, vehicle.Id)
+		}
+	}
+}
+
+// candidates is a method that returns the ids of the vehicles that may match the filter
+// ok is false when no index applies and every vehicle must be checked, the candidates must still be matched
+func (ix *vehicleIndexes) candidates(filter internal.Filter) (ids map[int]struct{}, ok bool) {
+	switch filter.Op {
+	case internal.FilterAnd:
+		// the smallest set of the children that can use an index
+		for _, child := range filter.Filters {
+			childIds, childOk := ix.candidates(child)
+			if childOk && (!ok || len(childIds) < len(ids)) {
+				ids, ok = childIds, true
+			}
+		}
+		return
+	case internal.FilterOr:
+		// the union of the children, only if every child can use an index
+		ids = make(map[int]struct{})
+		for _, child := range filter.Filters {
+			childIds, childOk := ix.candidates(child)
+			if !childOk {
+				return nil, false
+			}
+			for id := range childIds {
+				ids[id] = struct{}{}
+			}
+		}
+		return ids, true
+	}
+
+	if index, found := ix.hash[filter.Field]; found {
+		switch filter.Op {
+		case internal.FilterEq, internal.FilterIn:
+			ids = make(map[int]struct{})
+			for _, value := range filter.Values {
+				for id := range index[internal.VehicleFields[filter.Field].Normalize(value)] {
+					ids[id] = struct{}{}
+				}
+			}
+			return ids, true
+		}
+		return nil, false
+	}
+
+	if index, found := ix.sorted[filter.Field]; found {
+		switch filter.Op {
+		case internal.FilterEq:
+			return index.between(filter.Values[0].(float64), true, filter.Values[0].(float64), true), true
+		case internal.FilterLt, internal.FilterLte:
+			return index.below(filter.Values[0].(float64), filter.Op == internal.FilterLte), true
+		case internal.FilterGt, internal.FilterGte:
+			return index.above(filter.Values[0].(float64), filter.Op == internal.FilterGte), true
+		case internal.FilterBetween:
+			return index.between(filter.Values[0].(float64), true, filter.Values[1].(float64), true), true
+		}
+	}
+	return nil, false
+}
+
+// hashKey is a function that returns the key of a vehicle in the hash index of a field, its normalized value
+// so the index finds the same vehicles a filter matches
+func hashKey(field string, vehicle internal.Vehicle) any {
+	f := internal.VehicleFields[field]
+	return f.Normalize(f.Value(vehicle))
+}
+
+// hashIndex is a map from the value of a field to the ids of the vehicles with that value
+type hashIndex map[any]map[int]struct{}
+
+// add is a method that adds an id to a value
+func (h hashIndex) add(value any, id int) {
+	ids, ok := h[value]
+	if !ok {
+		ids = make(map[int]struct{})
+		h[value] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+// remove is a method that removes an id from a value
+func (h hashIndex) remove(value any, id int) {
+	delete(h[value], id)
+	if len(h[value]) == 0 {
+		delete(h, value)
+	}
+}
+
+// indexEntry is a struct that represents the value of a field of a vehicle in a sorted index
+type indexEntry struct {
+	value float64
+	id    int
+}
+
+// less is a method that orders entries by value and then by id
+func (e indexEntry) less(other indexEntry) bool {
+	if e.value != other.value {
+		return e.value < other.value
+	}
+	return e.id < other.id
+}
+
+// sortedIndex is a struct that keeps the values of a field ordered
+type sortedIndex struct {
+	entries []indexEntry
+}
+
+// add is a method that inserts an entry keeping the order
+func (s *sortedIndex) add(entry indexEntry) {
+	i := sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].less(entry) })
+	s.entries = append(s.entries, indexEntry{})
+	copy(s.entries[i+1:], s.entries[i:])
+	s.entries[i] = entry
+}
+
+// remove is a method that removes an entry keeping the order
+func (s *sortedIndex) remove(entry indexEntry) {
+	i := sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].less(entry) })
+	if i < len(s.entries) && s.entries[i] == entry {
+		s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	}
+}
+
+// between is a method that returns the ids with a value between min and max
+func (s *sortedIndex) between(min float64, minIncluded bool, max float64, maxIncluded bool) map[int]struct{} {
+	start := sort.Search(len(s.entries), func(i int) bool {
+		if minIncluded {
+			return s.entries[i].value >= min
+		}
+		return s.entries[i].value > min
+	})
+	end := sort.Search(len(s.entries), func(i int) bool {
+		if maxIncluded {
+			return s.entries[i].value > max
+		}
+		return s.entries[i].value >= max
+	})
+	ids := make(map[int]struct{})
+	for i := start; i < end; i++ {
+		ids[s.entries[i].id] = struct{}{}
+	}
+	return ids
+}
+
+// below is a method that returns the ids with a value less than max
+func (s *sortedIndex) below(max float64, included bool) map[int]struct{} {
+	if len(s.entries) == 0 {
+		return map[int]struct{}{}
+	}
+	return s.between(s.entries[0].value, true, max, included)
+}
+
+// above is a method that returns the ids with a value greater than min
+func (s *sortedIndex) above(min float64, included bool) map[int]struct{} {
+	if len(s.entries) == 0 {
+		return map[int]struct{}{}
+	}
+	return s.between(min, included, s.entries[len(s.entries)-1].value, true)
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// indexTestFilters are the filters compared with and without the indexes, by name
+var indexTestFilters = []struct {
+	name   string
+	filter internal.Filter
+}{
+	{"brand", internal.Filter{Op: internal.FilterEq, Field: "brand", Values: []any{"Brand 7"}}},
+	{"color_in", internal.Filter{Op: internal.FilterIn, Field: "color", Values: []any{"Teal", "Puce"}}},
+	{"year_range", internal.Filter{Op: internal.FilterBetween, Field: "year", Values: []any{2000.0, 2001.0}}},
+	{"brand_and_speed", internal.Filter{Op: internal.FilterAnd, Filters: []internal.Filter{
+		{Op: internal.FilterEq, Field: "brand", Values: []any{"Brand 7"}},
+		{Op: internal.FilterGte, Field: "max_speed", Values: []any{200.0}},
+	}}},
+}
+
+// newIndexTestMap is a function that returns a repository of n vehicles spread over 1000 brands,
+// 20 colors and 75 years
+func newIndexTestMap(n int) *VehicleMap {
+	colors := []string{"Aquamarine", "Blue", "Crimson", "Fuchsia", "Goldenrod", "Gray", "Green", "Indigo", "Khaki",
+		"Maroon", "Mauve", "Orange", "Pink", "Puce", "Purple", "Red", "Teal", "Turquoise", "Violet", "Yellow"}
+	db := make(map[int]internal.Vehicle, n)
+	for id := 1; id <= n; id++ {
+		db[id] = internal.Vehicle{Id: id, Version: 1, VehicleAttributes: internal.VehicleAttributes{
+			Brand:           fmt.Sprintf("Brand %d", id%1000),
+			Model:           fmt.Sprintf("Model %d", id%37),
+			Registration:    fmt.Sprintf("REG-%d", id),
+			Color:           colors[id%len(colors)],
+			FabricationYear: 1950 + id%75,
+			Capacity:        1 + id%7,
+			MaxSpeed:        float64(80 + id%220),
+			FuelType:        "gasoline",
+			Transmission:    "manual",
+			Weight:          float64(800 + id%2000),
+			Dimensions:      internal.Dimensions{Height: 1 + float64(id%10)/10, Length: 3 + float64(id%30)/10, Width: 2},
+		}}
+	}
+	return NewVehicleMap(db, n, nil)
+}
+
+// searchScan is a method that returns the page of the vehicles that match the filter checking every vehicle,
+// it is Search without the indexes
+func (r *VehicleMap) searchScan(filter internal.Filter, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	r.mu.RLock()
+	vehicles := make([]internal.Vehicle, 0)
+	for _, value := range r.db {
+		if filter.Match(value) {
+			vehicles = append(vehicles, value)
+		}
+	}
+	r.mu.RUnlock()
+
+	result, err = page.Apply(vehicles)
+	return
+}
+
+// TestVehicleMap_SearchIndex checks that a search that uses the indexes finds the same vehicles as a full scan
+func TestVehicleMap_SearchIndex(t *testing.T) {
+	r := newIndexTestMap(10_000)
+	for _, tc := range indexTestFilters {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := r.ix.candidates(tc.filter); !ok {
+				t.Fatalf("no index applies to the filter")
+			}
+			indexed, err := r.Search(tc.filter, internal.PageRequest{})
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			scanned, _ := r.searchScan(tc.filter, internal.PageRequest{})
+			if indexed.Total == 0 || indexed.Total != scanned.Total {
+				t.Fatalf("the index found %d vehicles, the scan %d", indexed.Total, scanned.Total)
+			}
+			for i := range indexed.Vehicles {
+				if indexed.Vehicles[i].Id != scanned.Vehicles[i].Id {
+					t.Fatalf("vehicle %d is %d with the index and %d with the scan", i, indexed.Vehicles[i].Id, scanned.Vehicles[i].Id)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkVehicleMap_Search compares the searches that use the indexes with full scans at 100k and 1M vehicles
+func BenchmarkVehicleMap_Search(b *testing.B) {
+	page := internal.PageRequest{Limit: 20}
+	for _, n := range []int{100_000, 1_000_000} {
+		r := newIndexTestMap(n)
+		for _, tc := range indexTestFilters {
+			b.Run(fmt.Sprintf("%d/%s/index", n, tc.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := r.Search(tc.filter, page); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run(fmt.Sprintf("%d/%s/scan", n, tc.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := r.searchScan(tc.filter, page); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestVehicleMap_SearchNonFinite checks that NaN and the infinities are rejected, the indexes and the scans would
+// not agree on the vehicles they match
+func TestVehicleMap_SearchNonFinite(t *testing.T) {
+	r := newIndexTestMap(100)
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		for _, field := range []string{"year", "passengers"} {
+			filter := internal.Filter{Op: internal.FilterEq, Field: field, Values: []any{value}}
+			if _, err := r.Search(filter, internal.PageRequest{}); !errors.Is(err, internal.ErrInvalidFilter) {
+				t.Fatalf("search %s = %v: got %v, want %v", field, value, err, internal.ErrInvalidFilter)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"app/internal"
+	"sync"
+)
+
+// NewVehicleJournalMemory is a function that returns a new instance of VehicleJournalMemory
+func NewVehicleJournalMemory() *VehicleJournalMemory {
+	return &VehicleJournalMemory{}
+}
+
+// VehicleJournalMemory is a struct that represents a journal kept in memory
+// the records are lost when the process stops, so it only stands in for a durable journal, e.g. in tests,
+// while an error is set with Fail every append fails with it and writes nothing
+// it is safe for concurrent use by multiple goroutines
+type VehicleJournalMemory struct {
+	// mu guards records and err
+	mu sync.Mutex
+	// records are the records appended since the last reset, in order
+	records []internal.VehicleRecord
+	// err is the error of the appends, nil when they succeed
+	err error
+}
+
+// Fail is a method that makes the next appends fail with err, until it is called again with nil
+func (j *VehicleJournalMemory) Fail(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.err = err
+}
+
+// Append is a method that appends records to the journal, all of them or none
+func (j *VehicleJournalMemory) Append(records ...internal.VehicleRecord) (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.err != nil {
+		return j.err
+	}
+	j.records = append(j.records, records...)
+	return
+}
+
+// Replay is a method that calls fn for every record in the journal, in order
+func (j *VehicleJournalMemory) Replay(fn func(record internal.VehicleRecord)) (err error) {
+	j.mu.Lock()
+	records := j.records
+	j.mu.Unlock()
+
+	for _, record := range records {
+		fn(record)
+	}
+	return
+}
+
+// Reset is a method that discards every record in the journal
+func (j *VehicleJournalMemory) Reset() (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.records = nil
+	return
+}
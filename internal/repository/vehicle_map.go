@@ -3,31 +3,277 @@ package repository
 import (
 	"app/internal"
 	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 )
 
 // NewVehicleMap is a function that returns a new instance of VehicleMap
-func NewVehicleMap(db map[int]internal.Vehicle, lastId int) *VehicleMap {
+// the vehicles of db that were deleted are moved to the trash, the versions of the vehicles before they
+// were loaded are not known, a vehicle is read as it was loaded from its UpdatedAt on, the vehicles with no
+// UpdatedAt are stamped with the time they were loaded, so they are not read as of an earlier time.
+// unique are the keys enforced on every change, internal.DefaultUniquenessPolicy when nil, the vehicles of db
+// are not checked, the ones that share a key were saved before it was enforced and are kept, see Duplicates
+func NewVehicleMap(db map[int]internal.Vehicle, lastId int, unique internal.UniquenessPolicy) *VehicleMap {
 	// default db
 	defaultDb := make(map[int]internal.Vehicle)
 	if db != nil {
 		defaultDb = db
 	}
+	// trash and versions
+	now := time.Now()
+	trash := make(map[int]internal.Vehicle)
+	versions := make(vehicleVersions)
+	for id, vehicle := range defaultDb {
+		// a deleted vehicle with no UpdatedAt is only known from its deletion on
+		if vehicle.UpdatedAt.IsZero() {
+			if vehicle.Deleted() {
+				versions.add(id, vehicle.DeletedAt, nil)
+				trash[id] = vehicle
+				delete(defaultDb, id)
+				continue
+			}
+			vehicle.UpdatedAt = now.UTC()
+			defaultDb[id] = vehicle
+		}
+		live := vehicle
+		live.DeletedAt = time.Time{}
+		versions.add(id, vehicle.UpdatedAt, &live)
+		if vehicle.Deleted() {
+			versions.add(id, vehicle.DeletedAt, nil)
+			trash[id] = vehicle
+			delete(defaultDb, id)
+		}
+	}
+	// default policy
+	if unique == nil {
+		unique = internal.DefaultUniquenessPolicy
+	}
+	// vehicles loaded with the same unique keys, including the ones in the trash
+	duplicates := make(map[internal.UniqueKey]map[string][]int)
+	for _, key := range unique {
+		ids := make(map[string][]int)
+		for _, vehicles := range []map[int]internal.Vehicle{defaultDb, trash} {
+			for id, vehicle := range vehicles {
+				if value := key.Value(vehicle); value != "" {
+					ids[value] = append(ids[value], id)
+				}
+			}
+		}
+		for value := range ids {
+			if len(ids[value]) < 2 {
+				delete(ids, value)
+				continue
+			}
+			sort.Ints(ids[value])
+		}
+		if len(ids) > 0 {
+			duplicates[key] = ids
+		}
+	}
+	// the counter starts at the current time so it is greater than any counter of a previous run
 	return &VehicleMap{
-		db:     defaultDb,
-		lastId: lastId,
+		db:         defaultDb,
+		trash:      trash,
+		versions:   versions,
+		ix:         newVehicleIndexes(defaultDb),
+		lastId:     lastId,
+		unique:     unique,
+		duplicates: duplicates,
+		revision:   internal.VehicleRevision{Counter: uint64(now.UnixNano()), ModifiedAt: now},
 	}
 }
 
 // VehicleMap is a struct that represents a vehicle repository
+// it is safe for concurrent use by multiple goroutines
 type VehicleMap struct {
+	// txMu serializes the changes, it is held by a transaction from Begin until Commit or Rollback
+	txMu sync.Mutex
+	// mu guards db, trash, versions, ix and lastId, readers share the lock and writers hold it exclusively
+	mu sync.RWMutex
 	// db is a map of vehicles
 	db map[int]internal.Vehicle
+	// trash is a map of the deleted vehicles until they are purged, they are not indexed
+	trash map[int]internal.Vehicle
+	// versions are the states of every vehicle over time, including the deleted and purged ones
+	versions vehicleVersions
+	// horizon is the time before which the versions were pruned, the vehicles can not be read as of an earlier time
+	horizon time.Time
+	// ix are the secondary indexes of db, every change to db goes through put and remove to keep them consistent
+	ix *vehicleIndexes
 	//I'm add a lastId to save the last id used in the db
 	lastId int
+	// unique are the keys that no two vehicles can share
+	unique internal.UniquenessPolicy
+	// duplicates are the ids of the vehicles loaded with the same value of a unique key, by key and value,
+	// they never change
+	duplicates map[internal.UniqueKey]map[string][]int
+	// revision changes with every change of db or trash, it is used to validate the responses cached by the clients
+	revision internal.VehicleRevision
+}
+
+// Revision is a method that returns the current revision of the vehicles
+func (r *VehicleMap) Revision() (revision internal.VehicleRevision) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revision = r.revision
+	return
+}
+
+// changed is a method that moves the revision forward, the caller must hold the write lock
+func (r *VehicleMap) changed() {
+	r.revision.Counter++
+	r.revision.ModifiedAt = time.Now()
+}
+
+// Begin is a method that starts a transaction, other changes wait until it is committed or rolled back
+func (r *VehicleMap) Begin() (tx internal.VehicleTx, err error) {
+	tx = r.begin(nil)
+	return
+}
+
+// begin is a method that starts a transaction whose changes are stored by persist when committed
+func (r *VehicleMap) begin(persist func(records []internal.VehicleRecord) error) *vehicleMapTx {
+	r.txMu.Lock()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &vehicleMapTx{
+		r:       r,
+		persist: persist,
+		changes: make(map[int]*internal.Vehicle),
+		lastId:  r.lastId,
+	}
+}
+
+// run is a method that runs a change in a transaction, committed if the change succeeds and rolled back otherwise
+func (r *VehicleMap) run(persist func(records []internal.VehicleRecord) error, change func(tx *vehicleMapTx) error) (err error) {
+	tx := r.begin(persist)
+	// rolling back a committed transaction does nothing
+	defer tx.Rollback()
+
+	if err = change(tx); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// put is a method that stores a vehicle and indexes it, the caller must hold the write lock
+func (r *VehicleMap) put(vehicle internal.Vehicle) {
+	if previous, ok := r.db[vehicle.Id]; ok {
+		r.ix.remove(previous)
+	}
+	r.db[vehicle.Id] = vehicle
+	r.ix.add(vehicle)
+}
+
+// remove is a method that removes a vehicle and its index entries, the caller must hold the write lock
+func (r *VehicleMap) remove(id int) {
+	if previous, ok := r.db[id]; ok {
+		r.ix.remove(previous)
+		delete(r.db, id)
+	}
+}
+
+// match is a method that returns the vehicles that match a valid filter, the caller must hold the read lock
+// the candidates are taken from an index when one applies to the filter
+func (r *VehicleMap) match(filter internal.Filter) (vehicles []internal.Vehicle) {
+	vehicles = make([]internal.Vehicle, 0)
+	if ids, ok := r.ix.candidates(filter); ok {
+		for id := range ids {
+			if value := r.db[id]; filter.Match(value) {
+				vehicles = append(vehicles, value)
+			}
+		}
+		return
+	}
+	for _, value := range r.db {
+		if filter.Match(value) {
+			vehicles = append(vehicles, value)
+		}
+	}
+	return
+}
+
+// apply is a method that applies records to the db without any check
+// it is used to replay a journal, so applying a record twice has the same effect as once
+func (r *VehicleMap) apply(records ...internal.VehicleRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.write(records)
+	if len(records) > 0 {
+		r.changed()
+	}
+}
+
+// write is a method that applies records to the db and the trash, the caller must hold the write lock
+func (r *VehicleMap) write(records []internal.VehicleRecord) {
+	for _, record := range records {
+		id := record.Vehicle.Id
+		switch record.Op {
+		case internal.VehicleOpCreate, internal.VehicleOpUpdate:
+			vehicle := record.Vehicle
+			delete(r.trash, id)
+			r.put(vehicle)
+			r.versions.add(id, vehicle.UpdatedAt, &vehicle)
+		case internal.VehicleOpDelete:
+			r.remove(id)
+			// records written before the trash existed remove the vehicle and its versions
+			if !record.Vehicle.Deleted() {
+				r.versions.forget(id)
+				break
+			}
+			r.trash[id] = record.Vehicle
+			r.versions.add(id, record.Vehicle.DeletedAt, nil)
+		case internal.VehicleOpPurge:
+			// the versions of a purged vehicle are kept, only the undo of a create purges a vehicle
+			// that is not in the trash and that vehicle never existed
+			if _, trashed := r.trash[id]; !trashed {
+				r.versions.forget(id)
+			}
+			r.remove(id)
+			delete(r.trash, id)
+		}
+		// never hand out an id that was already used
+		if id > r.lastId {
+			r.lastId = id
+		}
+	}
+}
+
+// stored is a method that returns a vehicle by id, from the db or the trash, the caller must hold the read lock
+func (r *VehicleMap) stored(id int) (vehicle internal.Vehicle, ok bool) {
+	if vehicle, ok = r.db[id]; ok {
+		return
+	}
+	vehicle, ok = r.trash[id]
+	return
+}
+
+// snapshot is a method that returns a copy of every vehicle, including the ones in the trash
+func (r *VehicleMap) snapshot() (v map[int]internal.Vehicle) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v = make(map[int]internal.Vehicle, len(r.db)+len(r.trash))
+	for key, value := range r.db {
+		v[key] = value
+	}
+	for key, value := range r.trash {
+		v[key] = value
+	}
+	return
 }
 
 // FindAll is a method that returns a map of all vehicles
 func (r *VehicleMap) FindAll() (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	v = make(map[int]internal.Vehicle)
 
 	// copy db
@@ -40,10 +286,12 @@ func (r *VehicleMap) FindAll() (v map[int]internal.Vehicle, err error) {
 
 // GetbyID is a method that returns a vehicle by id
 func (r *VehicleMap) GetbyID(id int) (vehicle internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	vehicle, ok := r.db[id]
 	if !ok {
-		err = internal.ErrorNotFound
+		err = internal.ErrNotFound
 		return
 	}
 	return
@@ -51,80 +299,108 @@ func (r *VehicleMap) GetbyID(id int) (vehicle internal.Vehicle, err error) {
 
 // Save is a method that saves a vehicle
 func (r *VehicleMap) Save(vehicule *internal.Vehicle) (err error) {
-	for _, vehicles := range (*r).db {
-		if vehicles.Model == vehicule.Model && vehicles.Brand == vehicule.Brand && vehicles.FabricationYear == vehicule.FabricationYear {
-			return internal.ErrAlreadyExists
-		}
-	}
-	//I'm incrementing the lastId and then I'm assing it to the vehicle id
-	(*r).lastId++
-	//assing the lastId to the vehicle id
-	vehicule.Id = (*r).lastId
-	//id is the key and the value is the vehicle
-	(*r).db[vehicule.Id] = *vehicule
+	err = r.save(nil, vehicule)
 	return
 }
 
-func (r *VehicleMap) FindByColorAndYear(color string, year int) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle = make(map[int]internal.Vehicle)
-	//I'm iterating over the db map and I'm comparing the color and the year with the parameters
-	for key, value := range (*r).db {
-		if value.FabricationYear == year && value.Color == color {
-			//if the color and the year are the same, I'm assing the vehicle to the map
-			vehicle[key] = value
-		}
+// save is a method that saves a vehicle in a transaction
+func (r *VehicleMap) save(persist func(records []internal.VehicleRecord) error, vehicule *internal.Vehicle) (err error) {
+	err = r.run(persist, func(tx *vehicleMapTx) error {
+		return tx.Save(vehicule)
+	})
+	return
+}
+
+// Search is a method that returns the requested page of the vehicles that match the filter
+func (r *VehicleMap) Search(filter internal.Filter, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	if err = filter.Validate(); err != nil {
+		return
 	}
-	//if the vehicle is empty, return an error
-	if len(vehicle) == 0 {
-		err = internal.ErrorNotFound
+
+	r.mu.RLock()
+	vehicles := r.match(filter)
+	r.mu.RUnlock()
+
+	// order and window outside of the lock, vehicles is a copy
+	result, err = page.Apply(vehicles)
+	return
+}
+
+// Stats is a method that returns the table of the groups and metrics of the vehicles that match the filter
+// of the query
+func (r *VehicleMap) Stats(query internal.StatsQuery) (result internal.StatsResult, err error) {
+	if err = query.Validate(); err != nil {
+		return
 	}
+
+	r.mu.RLock()
+	vehicles := r.match(query.Filter)
+	r.mu.RUnlock()
+
+	// aggregate outside of the lock, vehicles is a copy
+	result, err = query.Apply(vehicles)
 	return
 }
 
-func (r *VehicleMap) FindByBrandAndYearRange(brand string, yearRange [2]int) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle = make(map[int]internal.Vehicle)
-	//I'm iterating over the db map and I'm comparing the brand and the year range with the parameters
-	for key, value := range (*r).db {
-		if value.FabricationYear >= yearRange[0] && value.FabricationYear <= yearRange[1] && value.Brand == brand {
-			//if the brand and the year range are the same, I'm assing the vehicle to the map
-			vehicle[key] = value
-		}
+// averageByBrand is a method that returns the average of a numeric field of the vehicles of a brand,
+// ignoring case and accents, the error is internal.ErrNotFound when the brand has no vehicle
+func (r *VehicleMap) averageByBrand(brand string, field string) (average float64, err error) {
+	result, err := r.Stats(internal.StatsQuery{
+		Metrics: []internal.Metric{{Aggregate: internal.AggregateCount}, {Aggregate: internal.AggregateAvg, Field: field}},
+		Filter:  internal.Filter{Op: internal.FilterEq, Field: "brand", Values: []any{brand}},
+	})
+	if err != nil {
+		return
 	}
-	//if the vehicle is empty, return an error
-	if len(vehicle) == 0 {
-		err = internal.ErrorNotFound
+	// a single group of the count and the average, nil when the brand has no vehicle
+	if len(result.Rows) != 1 || len(result.Rows[0]) != 2 {
+		err = fmt.Errorf("repository: unexpected stats of the brand: %v", result.Rows)
+		return
+	}
+	count, ok := result.Rows[0][0].(int)
+	if !ok {
+		err = fmt.Errorf("repository: unexpected count of the brand: %v", result.Rows[0][0])
+		return
+	}
+	//if there is no vehicle, return an error
+	if count == 0 {
+		err = internal.ErrNotFound
+		return
+	}
+	if average, ok = result.Rows[0][1].(float64); !ok {
+		err = fmt.Errorf("repository: unexpected average of the brand: %v", result.Rows[0][1])
 	}
 	return
 }
 
 // VelocityAverageByBrand is a method that returns the average velocity of a vehicle by brand
 func (r *VehicleMap) VelocityAveragebyBrand(brand string) (average float64, err error) {
-	//I'm iterating over the db map and I'm comparing the brand with the parameter
-	vehicle := make(map[int]internal.Vehicle)
-	velocity := 0.0
-	for key, value := range (*r).db {
-		if value.Brand == brand {
-			vehicle[key] = value
-			//I'm calculating the average velocity
-			velocity += value.MaxSpeed
-			average = velocity / float64(len(vehicle))
-		}
-	}
-	//if the vehicle is empty, return an error
-	if len(vehicle) == 0 {
-		err = internal.ErrorNotFound
-	}
+	average, err = r.averageByBrand(brand, "max_speed")
 	return
 }
 
-// SaveMany is a method that saves many vehicles
+// SaveMany is a method that saves many vehicles, all or nothing
+// the assigned ids are set on the slice, if a vehicle can not be saved none is, their ids are set back to zero
+// and the error is a *internal.VehicleBatchError with its position
 func (r *VehicleMap) SaveMany(vehicles []internal.Vehicle) (err error) {
-	//I'm iterating over the vehicles slice and I'm saving each vehicle
-	for _, vehicle := range vehicles {
-		//I'm calling the Save method to save each vehicle
-		err = r.Save(&vehicle)
-		if err != nil {
-			return err
+	err = r.saveMany(nil, vehicles)
+	return
+}
+
+// saveMany is a method that saves many vehicles in a transaction
+func (r *VehicleMap) saveMany(persist func(records []internal.VehicleRecord) error, vehicles []internal.Vehicle) (err error) {
+	err = r.run(persist, func(tx *vehicleMapTx) error {
+		//I'm iterating over the vehicles slice and I'm saving each vehicle
+		for i := range vehicles {
+			if err := tx.Save(&vehicles[i]); err != nil {
+				return &internal.VehicleBatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range vehicles {
+			vehicles[i].Id = 0
 		}
 	}
 	return
@@ -132,194 +408,178 @@ func (r *VehicleMap) SaveMany(vehicles []internal.Vehicle) (err error) {
 
 // UpdateVehicle is a method that updates a vehicle
 func (r *VehicleMap) UpdateVehicle(vehicle *internal.Vehicle) (err error) {
-	//I'm checking if the vehicle exists in the db
-	_, ok := (*r).db[vehicle.Id]
-	if !ok {
-		return internal.ErrorNotFound
-	}
-	//I'm updating the vehicle
-	(*r).db[vehicle.Id] = *vehicle
+	err = r.updateVehicle(nil, vehicle)
 	return
 }
 
-// FindByFuelType is a method that returns a map of vehicles by fuel type
-func (r *VehicleMap) FindByFuelType(fuelType string) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle = make(map[int]internal.Vehicle)
-	//I'm iterating over the db map and I'm comparing the fuel type with the parameter
-	for key, value := range (*r).db {
-		if value.FuelType == fuelType {
-			//if the fuel type is the same, I'm assing the vehicle to the map
-			vehicle[key] = value
-		}
+// updateVehicle is a method that updates a vehicle in a transaction
+func (r *VehicleMap) updateVehicle(persist func(records []internal.VehicleRecord) error, vehicle *internal.Vehicle) (err error) {
+	err = r.run(persist, func(tx *vehicleMapTx) error {
+		return tx.UpdateVehicle(vehicle)
+	})
+	return
+}
+
+// DeleteVehicle is a method that moves a vehicle to the trash
+func (r *VehicleMap) Delete(id int) (err error) {
+	err = r.delete(nil, id)
+	return
+}
+
+// delete is a method that moves a vehicle to the trash in a transaction
+func (r *VehicleMap) delete(persist func(records []internal.VehicleRecord) error, id int) (err error) {
+	err = r.run(persist, func(tx *vehicleMapTx) error {
+		return tx.Delete(id)
+	})
+	return
+}
+
+// GetByRegistration is a method that returns a vehicle by its registration plate, compared once normalized
+// if the policy does not make the registration unique and many vehicles have it, the one with the lowest id is returned
+func (r *VehicleMap) GetByRegistration(plate string) (vehicle internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := r.ix.unique[internal.UniqueRegistration][internal.NormalizeRegistration(plate)]
+	if len(ids) == 0 {
+		err = internal.ErrNotFound
+		return
 	}
-	//if the vehicle is empty, return an error
-	if len(vehicle) == 0 {
-		err = internal.ErrorNotFound
+	id := -1
+	for candidate := range ids {
+		if id == -1 || candidate < id {
+			id = candidate
+		}
 	}
+	vehicle = r.db[id]
 	return
 }
 
-// DeleteVehicle is a method that deletes a vehicle
-func (r *VehicleMap) Delete(id int) (err error) {
-	//I'm checking if the vehicle exists in the db
-	_, ok := (*r).db[id]
+// GetAsOf is a method that returns a vehicle by id as it was at a time, it may have been deleted since
+func (r *VehicleMap) GetAsOf(id int, at time.Time) (vehicle internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if at.Before(r.horizon) {
+		err = internal.ErrAsOfExpired
+		return
+	}
+	vehicle, ok := r.versions.at(id, at)
 	if !ok {
-		return internal.ErrorNotFound
+		err = internal.ErrNotFound
+		return
 	}
-	//I'm deleting the vehicle
-	delete((*r).db, id)
 	return
 }
 
-// FindByTransmission is a method that returns a map of vehicles by transmission
-func (r *VehicleMap) FindByTransmission(transmission string) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle = make(map[int]internal.Vehicle)
-	//I'm iterating over the db map and I'm comparing the transmission with the parameter
-	for key, value := range (*r).db {
-		if value.Transmission == transmission {
-			//if the transmission is the same, I'm assing the vehicle to the map
-			vehicle[key] = value
-		}
+// SearchAsOf is a method that returns the requested page of the vehicles that matched the filter at a time
+// the indexes only hold the current vehicles, so every version is checked
+func (r *VehicleMap) SearchAsOf(filter internal.Filter, page internal.PageRequest, at time.Time) (result internal.VehiclePage, err error) {
+	if err = filter.Validate(); err != nil {
+		return
+	}
+
+	r.mu.RLock()
+	if at.Before(r.horizon) {
+		r.mu.RUnlock()
+		err = internal.ErrAsOfExpired
+		return
 	}
-	//if the vehicle is empty, return an error
-	if len(vehicle) == 0 {
-		err = internal.ErrorNotFound
+	vehicles := make([]internal.Vehicle, 0)
+	for id := range r.versions {
+		if vehicle, ok := r.versions.at(id, at); ok && filter.Match(vehicle) {
+			vehicles = append(vehicles, vehicle)
+		}
 	}
+	r.mu.RUnlock()
+
+	// order and window outside of the lock, vehicles is a copy
+	result, err = page.Apply(vehicles)
 	return
 }
 
-// CapacityAverageByBrand is a method that returns the average capacity of a vehicle by brand
-func (r *VehicleMap) CapacityAveragebyBrand(brand string) (average float64, err error) {
-	//I'm iterating over the db map and I'm comparing the brand with the parameter
-	vehicle := make(map[int]internal.Vehicle)
-	capacity := 0.0
-	for key, value := range (*r).db {
-		if value.Brand == brand {
-			vehicle[key] = value
-			//I'm calculating the average velocity
-			capacity += float64(value.Capacity)
-			average = capacity / float64(len(vehicle))
+// Duplicates is a method that returns the ids of the vehicles that were loaded with the same value of a unique key,
+// by key and value, they were saved before the key was enforced, so they are kept and can still be changed
+// and restored as long as they keep that value
+func (r *VehicleMap) Duplicates() (duplicates map[internal.UniqueKey]map[string][]int) {
+	duplicates = make(map[internal.UniqueKey]map[string][]int, len(r.duplicates))
+	for key, values := range r.duplicates {
+		duplicates[key] = make(map[string][]int, len(values))
+		for value, ids := range values {
+			duplicates[key][value] = append([]int(nil), ids...)
 		}
 	}
-	//if the vehicle is empty, return an error
-	if len(vehicle) == 0 {
-		err = internal.ErrorNotFound
+	return
+}
+
+// loadedTogether is a method that returns whether two vehicles were loaded with the same value of a unique key
+func (r *VehicleMap) loadedTogether(key internal.UniqueKey, value string, a, b int) bool {
+	ids := r.duplicates[key][value]
+	return slices.Contains(ids, a) && slices.Contains(ids, b)
+}
+
+// PruneVersions is a method that forgets the versions of the vehicles that ended before a time, so they do not grow
+// without limit, the vehicles can not be read as of an earlier time afterwards, n is the number of versions forgotten
+func (r *VehicleMap) PruneVersions(before time.Time) (n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n = r.versions.prune(before)
+	if before.After(r.horizon) {
+		r.horizon = before
 	}
 	return
 }
 
-// FindQuery is a method that returns a map of vehicles by query
-func (r *VehicleMap) FindQuery(query map[string]any) (vehicles map[int]internal.Vehicle, err error) {
-	// create map of vehicles
-	vehicles = make(map[int]internal.Vehicle)
-
-	// validate if query is set
-	querySet := len(query) > 0
-	// iterate over db map
-	for id, item := range r.db {
-		// if query is set, filter
-		if querySet {
-			//Search for the minLength in the query map
-			minLength, ok := query["min_length"]
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			//convert minLength to float64
-			minLengthFloat, ok := minLength.(float64)
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
+// history is a method that returns a record for every version of the vehicles, including the purged ones
+func (r *VehicleMap) history() (records []internal.VehicleRecord) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-			//maxlength
-			maxLength, ok := query["max_length"]
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			maxLengthFloat, ok := maxLength.(float64)
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
+	records = r.versions.records()
+	return
+}
 
-			//minwidth
-			minWidth, ok := query["min_width"]
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			minWidthFloat, ok := minWidth.(float64)
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			//maxwidth
-			maxWidth, ok := query["max_width"]
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			maxWidthFloat, ok := maxWidth.(float64)
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			// filter
-			if item.Height < minLengthFloat || item.Height > maxLengthFloat || item.Width < minWidthFloat || item.Width > maxWidthFloat {
-				continue
-			}
-		}
+// historyWith is a method that returns a record for every version of the vehicles with the versions written by
+// records, which are not applied yet
+func (r *VehicleMap) historyWith(records []internal.VehicleRecord) []internal.VehicleRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-		// by default add item
-		vehicles[id] = item
-		fmt.Println(vehicles)
+	versions := make(vehicleVersions, len(r.versions))
+	versions.merge(r.versions)
+	for _, record := range records {
+		versions.addRecord(record)
 	}
-	return
+	return versions.records()
 }
 
-// FilterByWeight is a method that returns a map of vehicles by weight
-func (r *VehicleMap) FilterByWeight(query map[string]any) (vehicles map[int]internal.Vehicle, err error) {
-	// create map of vehiclesx
-	vehicles = make(map[int]internal.Vehicle)
-
-	// filter by query
-	querySet := len(query) > 0
-	for id, item := range r.db {
-		// if query is set, filter
-		if querySet {
-			//search for the weight_min in the query map
-			weightMin, ok := query["weight_min"]
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			weightMinFloat, ok := weightMin.(float64)
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
+// restoreVersions is a method that puts the versions of a history before the ones of the vehicles loaded, which are
+// newer, versions is owned by the repository afterwards
+func (r *VehicleMap) restoreVersions(versions vehicleVersions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-			//maxlength
-			weightMax, ok := query["weight_max"]
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			weightMaxFloat, ok := weightMax.(float64)
-			if !ok {
-				err = internal.ErrInvalidQuery
-				return
-			}
-			// filter
-			if item.Weight < weightMinFloat || item.Weight > weightMaxFloat {
-				continue
-			}
-		}
+	versions.merge(r.versions)
+	r.versions = versions
+}
 
-		// by default add item
-		vehicles[id] = item
+// FindTrash is a method that returns the requested page of the vehicles in the trash
+func (r *VehicleMap) FindTrash(page internal.PageRequest) (result internal.VehiclePage, err error) {
+	r.mu.RLock()
+	vehicles := make([]internal.Vehicle, 0, len(r.trash))
+	for _, value := range r.trash {
+		vehicles = append(vehicles, value)
 	}
+	r.mu.RUnlock()
+
+	// order and window outside of the lock, vehicles is a copy
+	result, err = page.Apply(vehicles)
+	return
+}
+
+// CapacityAverageByBrand is a method that returns the average capacity of a vehicle by brand
+func (r *VehicleMap) CapacityAveragebyBrand(brand string) (average float64, err error) {
+	average, err = r.averageByBrand(brand, "passengers")
 	return
 }
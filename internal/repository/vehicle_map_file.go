@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"app/internal"
+	"log"
+)
+
+// NewVehicleMapFile is a function that returns a new instance of VehicleMapFile
+// hs is where the versions of the vehicles are kept, they are only kept in memory when it is nil
+func NewVehicleMapFile(rp *VehicleMap, wr internal.VehicleWriter, hs internal.VehicleHistory) *VehicleMapFile {
+	return &VehicleMapFile{
+		VehicleMap: rp,
+		wr:         wr,
+		hs:         hs,
+	}
+}
+
+// VehicleMapFile is a struct that represents a vehicle repository backed by a file
+// it decorates a VehicleMap, reads are served from memory and every committed change is written through to the file,
+// if the file can not be written the change is not applied, so both always hold the same vehicles,
+// the versions of the vehicles are written to the history after every change
+type VehicleMapFile struct {
+	// VehicleMap is the in-memory repository that serves the reads
+	*VehicleMap
+	// wr is the writer used to persist the vehicles
+	wr internal.VehicleWriter
+	// hs is the history where the versions are written, so they outlive the process
+	hs internal.VehicleHistory
+}
+
+// Recover is a method that reads the history before the versions of the vehicles loaded and writes both back, so the
+// vehicles stamped when they were loaded keep their time after a restart
+func (r *VehicleMapFile) Recover() (err error) {
+	if r.hs == nil {
+		return
+	}
+	// no change can be committed while the history is read
+	r.VehicleMap.txMu.Lock()
+	defer r.VehicleMap.txMu.Unlock()
+
+	versions := make(vehicleVersions)
+	if err = r.hs.Replay(versions.addRecord); err != nil {
+		return
+	}
+	r.VehicleMap.restoreVersions(versions)
+	err = r.hs.Rewrite(r.VehicleMap.history())
+	return
+}
+
+// Begin is a method that starts a transaction that persists its changes when committed
+func (r *VehicleMapFile) Begin() (tx internal.VehicleTx, err error) {
+	tx = r.VehicleMap.begin(r.persist)
+	return
+}
+
+// Save is a method that saves a vehicle and persists the change
+func (r *VehicleMapFile) Save(vehicle *internal.Vehicle) (err error) {
+	err = r.VehicleMap.save(r.persist, vehicle)
+	return
+}
+
+// SaveMany is a method that saves many vehicles and persists the change
+func (r *VehicleMapFile) SaveMany(vehicles []internal.Vehicle) (err error) {
+	err = r.VehicleMap.saveMany(r.persist, vehicles)
+	return
+}
+
+// UpdateVehicle is a method that updates a vehicle and persists the change
+func (r *VehicleMapFile) UpdateVehicle(vehicle *internal.Vehicle) (err error) {
+	err = r.VehicleMap.updateVehicle(r.persist, vehicle)
+	return
+}
+
+// Delete is a method that moves a vehicle to the trash and persists the change
+func (r *VehicleMapFile) Delete(id int) (err error) {
+	err = r.VehicleMap.delete(r.persist, id)
+	return
+}
+
+// persist is a method that writes every vehicle to the file, including the trash, and then the history, it is called
+// with the changes of a transaction before they are applied to the memory, so they are applied to a copy of the
+// vehicles, the transactions are committed one at a time so the files are written in order
+// once the vehicles are written the change is committed, a history that can not be written is logged and written
+// again with the next change, the current versions are in the file of the vehicles, so none of them is lost
+func (r *VehicleMapFile) persist(records []internal.VehicleRecord) (err error) {
+	v := r.VehicleMap.snapshot()
+	for _, record := range records {
+		// the vehicles deleted by a transaction are kept with their DeletedAt, only the purged ones are removed
+		if record.Op == internal.VehicleOpPurge {
+			delete(v, record.Vehicle.Id)
+			continue
+		}
+		v[record.Vehicle.Id] = record.Vehicle
+	}
+	if err = r.wr.Write(v); err != nil {
+		return
+	}
+	if r.hs != nil {
+		if historyErr := r.hs.Rewrite(r.VehicleMap.historyWith(records)); historyErr != nil {
+			log.Println("history:", historyErr)
+		}
+	}
+	return
+}
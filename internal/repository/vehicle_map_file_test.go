@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestFile is a function that opens the store of a file of vehicles the way the application does, the history is
+// read from the same directory
+func openTestFile(t *testing.T, path string) (r *VehicleMapFile) {
+	t.Helper()
+	ld := loader.NewVehicleJSONFile(path)
+	db, err := ld.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	lastId := 0
+	for id := range db {
+		lastId = max(lastId, id)
+	}
+	hs := loader.NewVehicleJSONLog(filepath.Join(filepath.Dir(path), "vehicles_history.log"))
+	t.Cleanup(func() { hs.Close() })
+	r = NewVehicleMapFile(NewVehicleMap(db, lastId, nil), ld, hs)
+	if err = r.Recover(); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	return
+}
+
+// writeTestFile is a function that writes a file with vehicles 1 and 2 in a temporary directory
+func writeTestFile(t *testing.T) (path string) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "vehicles.json")
+	seed := map[int]internal.Vehicle{1: newTestVehicle(1), 2: newTestVehicle(2)}
+	for id, vehicle := range seed {
+		vehicle.Id, vehicle.Version = id, 1
+		seed[id] = vehicle
+	}
+	if err := loader.NewVehicleJSONFile(path).Write(seed); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return
+}
+
+// TestVehicleMapFile_RecoverHistory checks that the versions of the vehicles written through to the file are
+// recovered after a restart, including the ones of the purged vehicles
+func TestVehicleMapFile_RecoverHistory(t *testing.T) {
+	path := writeTestFile(t)
+
+	// - vehicle 1 is updated, vehicle 2 is deleted and purged
+	r := openTestFile(t, path)
+	loaded, _ := r.GetbyID(1)
+	v1 := loaded
+	v1.Color = "Blue"
+	if err := r.UpdateVehicle(&v1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := r.Delete(2); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	tx, _ := r.Begin()
+	if err := tx.Purge(2); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	// - restart
+	r = openTestFile(t, path)
+	if _, err := r.GetAsOf(1, loaded.UpdatedAt.Add(-time.Second)); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("vehicle 1 before it was loaded: got %v, want %v", err, internal.ErrNotFound)
+	}
+	if v, err := r.GetAsOf(1, loaded.UpdatedAt); err != nil || v.Color != "Red" {
+		t.Fatalf("vehicle 1 as loaded: color %q, %v, want Red", v.Color, err)
+	}
+	if v, err := r.GetAsOf(1, v1.UpdatedAt); err != nil || v.Color != "Blue" {
+		t.Fatalf("vehicle 1 as updated: color %q, %v, want Blue", v.Color, err)
+	}
+	if _, err := r.GetAsOf(2, v1.UpdatedAt); err != nil {
+		t.Fatalf("purged vehicle 2 before it was deleted: %v", err)
+	}
+	if _, err := r.GetAsOf(2, time.Now()); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("purged vehicle 2 now: got %v, want %v", err, internal.ErrNotFound)
+	}
+}
+
+// TestVehicleMapFile_WriteThrough checks that every change is written through to the file by replacing it, and that a
+// change that can not be written leaves the file and the vehicles in memory as they were
+func TestVehicleMapFile_WriteThrough(t *testing.T) {
+	path := writeTestFile(t)
+	r := openTestFile(t, path)
+	load := func() map[int]internal.Vehicle {
+		t.Helper()
+		db, err := loader.NewVehicleJSONFile(path).Load()
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		return db
+	}
+	leftovers := func() {
+		t.Helper()
+		if tmp, _ := filepath.Glob(path + ".tmp-*"); len(tmp) > 0 {
+			t.Fatalf("temporary files left: %v", tmp)
+		}
+	}
+
+	// - the file is replaced, a reader of the old file keeps reading it whole
+	old, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer old.Close()
+	before, _ := old.Stat()
+	v3 := newTestVehicle(3)
+	if err = r.Save(&v3); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	v1, _ := r.GetbyID(1)
+	v1.Color = "Blue"
+	if err = r.UpdateVehicle(&v1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err = r.Delete(2); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if after, _ := os.Stat(path); os.SameFile(before, after) {
+		t.Fatalf("the file was written in place, want it replaced")
+	}
+	if b, _ := io.ReadAll(old); !json.Valid(b) || strings.Contains(string(b), "Blue") {
+		t.Fatalf("the old file was changed: %s", b)
+	}
+	leftovers()
+
+	// - every change is in the file, the vehicles in the trash too
+	db := load()
+	if len(db) != 3 || db[3].Registration != v3.Registration || db[1].Color != "Blue" || db[1].Version != 2 || !db[2].Deleted() {
+		t.Fatalf("file %+v, want vehicle 3 saved, vehicle 1 updated and vehicle 2 in the trash", db)
+	}
+
+	// - a change that can not be encoded is not written nor applied
+	file, _ := os.ReadFile(path)
+	revision := r.Revision()
+	v1.MaxSpeed = math.NaN()
+	if err = r.UpdateVehicle(&v1); err == nil {
+		t.Fatalf("update of a vehicle that can not be written: no error")
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, file) {
+		t.Fatalf("the failed write changed the file")
+	}
+	if v, _ := r.GetbyID(1); v.MaxSpeed != 101 || v.Version != 2 || r.Revision() != revision {
+		t.Fatalf("vehicle 1 with max speed %v and version %d after the failed write, want 101 and 2", v.MaxSpeed, v.Version)
+	}
+	leftovers()
+
+	// - a file that can not be replaced is left as it is, the temporary file is removed
+	blocked := filepath.Join(t.TempDir(), "vehicles.json")
+	if err = os.MkdirAll(filepath.Join(blocked, "keep"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	rb := NewVehicleMapFile(NewVehicleMap(nil, 0, nil), loader.NewVehicleJSONFile(blocked), nil)
+	v := newTestVehicle(1)
+	if err = rb.Save(&v); err == nil {
+		t.Fatalf("save to a file that can not be replaced: no error")
+	}
+	if all, _ := rb.FindAll(); len(all) != 0 {
+		t.Fatalf("%d vehicles in memory after the failed write, want none", len(all))
+	}
+	if tmp, _ := filepath.Glob(blocked + ".tmp-*"); len(tmp) > 0 {
+		t.Fatalf("temporary files left: %v", tmp)
+	}
+}
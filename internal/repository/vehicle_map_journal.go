@@ -0,0 +1,108 @@
+package repository
+
+import "app/internal"
+
+// NewVehicleMapJournal is a function that returns a new instance of VehicleMapJournal
+// hs is where the versions of the vehicles are kept, they are only kept in memory when it is nil
+func NewVehicleMapJournal(rp *VehicleMap, jr internal.VehicleJournal, hs internal.VehicleHistory, wr internal.VehicleWriter) *VehicleMapJournal {
+	return &VehicleMapJournal{
+		VehicleMap: rp,
+		jr:         jr,
+		hs:         hs,
+		wr:         wr,
+	}
+}
+
+// VehicleMapJournal is a struct that represents a vehicle repository backed by a journal
+// it decorates a VehicleMap, reads are served from memory and every committed change is appended to the journal,
+// Compact writes the versions to the history, a snapshot of the memory with wr and empties the journal
+type VehicleMapJournal struct {
+	// VehicleMap is the in-memory repository that serves the reads
+	*VehicleMap
+	// jr is the journal where the changes are appended
+	jr internal.VehicleJournal
+	// hs is the history where the versions are written by the compactions, so they outlive the journal
+	hs internal.VehicleHistory
+	// wr is the writer used to write the snapshots
+	wr internal.VehicleWriter
+}
+
+// Recover is a method that reads the history and replays the journal over the vehicles loaded from the latest snapshot
+func (r *VehicleMapJournal) Recover() (err error) {
+	// no change can be committed while the journal is replayed
+	r.VehicleMap.txMu.Lock()
+	defer r.VehicleMap.txMu.Unlock()
+
+	// the history was written with the snapshot, or before it if the process stopped in between,
+	// so the versions of the snapshot and the journal are newer
+	if r.hs != nil {
+		versions := make(vehicleVersions)
+		if err = r.hs.Replay(versions.addRecord); err != nil {
+			return
+		}
+		r.VehicleMap.restoreVersions(versions)
+	}
+	err = r.jr.Replay(func(record internal.VehicleRecord) {
+		r.VehicleMap.apply(record)
+	})
+	return
+}
+
+// Compact is a method that writes the versions of the vehicles to the history, a snapshot of the vehicles,
+// including the trash, and empties the journal
+// if the process stops between the steps the journal is replayed over the new snapshot, which is harmless
+func (r *VehicleMapJournal) Compact() (err error) {
+	// no change can be committed between the snapshot and the reset of the journal
+	r.VehicleMap.txMu.Lock()
+	defer r.VehicleMap.txMu.Unlock()
+
+	if r.hs != nil {
+		if err = r.hs.Rewrite(r.VehicleMap.history()); err != nil {
+			return
+		}
+	}
+	v := r.VehicleMap.snapshot()
+	if err = r.wr.Write(v); err != nil {
+		return
+	}
+	err = r.jr.Reset()
+	return
+}
+
+// Begin is a method that starts a transaction that appends its changes to the journal when committed
+func (r *VehicleMapJournal) Begin() (tx internal.VehicleTx, err error) {
+	tx = r.VehicleMap.begin(r.persist)
+	return
+}
+
+// Save is a method that saves a vehicle and appends the change to the journal
+func (r *VehicleMapJournal) Save(vehicle *internal.Vehicle) (err error) {
+	err = r.VehicleMap.save(r.persist, vehicle)
+	return
+}
+
+// SaveMany is a method that saves many vehicles and appends the changes to the journal in a single record, so a
+// crash keeps all of them or none
+func (r *VehicleMapJournal) SaveMany(vehicles []internal.Vehicle) (err error) {
+	err = r.VehicleMap.saveMany(r.persist, vehicles)
+	return
+}
+
+// UpdateVehicle is a method that updates a vehicle and appends the change to the journal
+func (r *VehicleMapJournal) UpdateVehicle(vehicle *internal.Vehicle) (err error) {
+	err = r.VehicleMap.updateVehicle(r.persist, vehicle)
+	return
+}
+
+// Delete is a method that moves a vehicle to the trash and appends the change to the journal
+func (r *VehicleMapJournal) Delete(id int) (err error) {
+	err = r.VehicleMap.delete(r.persist, id)
+	return
+}
+
+// persist is a method that appends the changes of a transaction to the journal before they are applied to the memory
+// if the journal can not be written they are not applied, so memory and journal always hold the same vehicles
+func (r *VehicleMapJournal) persist(records []internal.VehicleRecord) (err error) {
+	err = r.jr.Append(records...)
+	return
+}
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestJournal is a function that opens the store of a snapshot and a journal the way the application does,
+// the latest snapshot is loaded, the history is read from the directory of the journal and the journal is replayed
+func openTestJournal(t *testing.T, snapshotPath, journalPath string) (r *VehicleMapJournal, jr *loader.VehicleJSONLog) {
+	t.Helper()
+	ld := loader.NewVehicleJSONFile(snapshotPath)
+	db, err := ld.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	lastId := 0
+	for id := range db {
+		lastId = max(lastId, id)
+	}
+	jr = loader.NewVehicleJSONLog(journalPath)
+	t.Cleanup(func() { jr.Close() })
+	hs := loader.NewVehicleJSONLog(filepath.Join(filepath.Dir(journalPath), "vehicles_history.log"))
+	t.Cleanup(func() { hs.Close() })
+	r = NewVehicleMapJournal(NewVehicleMap(db, lastId, nil), jr, hs, ld)
+	if err = r.Recover(); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	return
+}
+
+// TestVehicleMapJournal_RecoverTornRecord checks that the store comes back consistent after a crash that tore the
+// last record of the journal, every change before it is recovered and the torn one is lost as a whole
+func TestVehicleMapJournal_RecoverTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath, journalPath := filepath.Join(dir, "vehicles.json"), filepath.Join(dir, "vehicles.log")
+	seed := map[int]internal.Vehicle{1: newTestVehicle(1), 2: newTestVehicle(2)}
+	for id, vehicle := range seed {
+		vehicle.Id, vehicle.Version = id, 1
+		seed[id] = vehicle
+	}
+	if err := loader.NewVehicleJSONFile(snapshotPath).Write(seed); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+
+	// - changes appended to the journal, the last one is torn
+	r, jr := openTestJournal(t, snapshotPath, journalPath)
+	v3, v4 := newTestVehicle(3), newTestVehicle(4)
+	if err := r.Save(&v3); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := r.Save(&v4); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	v1, _ := r.GetbyID(1)
+	v1.Color = "Blue"
+	if err := r.UpdateVehicle(&v1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := r.Delete(2); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	before, _ := os.Stat(journalPath)
+	v5 := newTestVehicle(5)
+	if err := r.Save(&v5); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	after, _ := os.Stat(journalPath)
+	jr.Close()
+	if err := os.Truncate(journalPath, before.Size()+(after.Size()-before.Size())/2); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	// - recover
+	r, _ = openTestJournal(t, snapshotPath, journalPath)
+	all, _ := r.FindAll()
+	if len(all) != 3 || all[1].Id != 1 || all[3].Id != 3 || all[4].Id != 4 {
+		t.Fatalf("recovered vehicles %v, want 1, 3 and 4", all)
+	}
+	if all[1].Color != "Blue" || all[1].Version != 2 {
+		t.Fatalf("recovered vehicle 1 with color %q and version %d, want Blue and 2", all[1].Color, all[1].Version)
+	}
+	trash, _ := r.FindTrash(internal.PageRequest{})
+	if trash.Total != 1 || trash.Vehicles[0].Id != 2 {
+		t.Fatalf("recovered trash %v, want vehicle 2", trash.Vehicles)
+	}
+	// - the indexes were rebuilt with the recovered vehicles
+	if page, _ := r.Search(internal.Filter{Op: internal.FilterEq, Field: "color", Values: []any{"Blue"}}, internal.PageRequest{}); page.Total != 1 {
+		t.Fatalf("the color index has %d blue vehicles, want 1", page.Total)
+	}
+	if _, err := r.GetByRegistration(v5.Registration); err == nil {
+		t.Fatalf("the torn vehicle was recovered")
+	}
+	// - the torn change can be made again, with the id it did not keep
+	if err := r.Save(&v5); err != nil || v5.Id != 5 {
+		t.Fatalf("save after recovery: id %d, %v, want id 5", v5.Id, err)
+	}
+
+	// - a compaction keeps the same vehicles
+	if err := r.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	r, _ = openTestJournal(t, snapshotPath, journalPath)
+	if all, _ = r.FindAll(); len(all) != 4 {
+		t.Fatalf("recovered %d vehicles after the compaction, want 4", len(all))
+	}
+}
+
+// TestVehicleMapJournal_RecoverHistory checks that the versions of the vehicles, including the purged ones, are
+// kept by the compactions and recovered, that nothing is known before a vehicle was loaded and that the pruned
+// versions are forgotten
+func TestVehicleMapJournal_RecoverHistory(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath, journalPath := filepath.Join(dir, "vehicles.json"), filepath.Join(dir, "vehicles.log")
+	seed := map[int]internal.Vehicle{1: newTestVehicle(1), 2: newTestVehicle(2)}
+	for id, vehicle := range seed {
+		vehicle.Id, vehicle.Version = id, 1
+		seed[id] = vehicle
+	}
+	if err := loader.NewVehicleJSONFile(snapshotPath).Write(seed); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+
+	// - the vehicles loaded with no UpdatedAt are not known before they were loaded
+	beforeLoad := time.Now()
+	r, _ := openTestJournal(t, snapshotPath, journalPath)
+	if _, err := r.GetAsOf(1, beforeLoad.Add(-time.Hour)); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("vehicle 1 before it was loaded: got %v, want %v", err, internal.ErrNotFound)
+	}
+	loaded, _ := r.GetbyID(1)
+	if loaded.UpdatedAt.Before(beforeLoad) {
+		t.Fatalf("vehicle 1 loaded at %v, want at least %v", loaded.UpdatedAt, beforeLoad)
+	}
+
+	// - vehicle 1 is updated, vehicle 2 is deleted and purged
+	v1 := loaded
+	v1.Color = "Blue"
+	if err := r.UpdateVehicle(&v1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := r.Delete(2); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	tx, _ := r.Begin()
+	if err := tx.Purge(2); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	// - the versions outlive a compaction and a restart
+	if err := r.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	r, _ = openTestJournal(t, snapshotPath, journalPath)
+	if v, err := r.GetAsOf(1, loaded.UpdatedAt); err != nil || v.Color != "Red" {
+		t.Fatalf("vehicle 1 as loaded: color %q, %v, want Red", v.Color, err)
+	}
+	if v, err := r.GetAsOf(1, v1.UpdatedAt); err != nil || v.Color != "Blue" {
+		t.Fatalf("vehicle 1 as updated: color %q, %v, want Blue", v.Color, err)
+	}
+	if _, err := r.GetAsOf(2, v1.UpdatedAt); err != nil {
+		t.Fatalf("purged vehicle 2 before it was deleted: %v", err)
+	}
+	if _, err := r.GetAsOf(2, time.Now()); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("purged vehicle 2 now: got %v, want %v", err, internal.ErrNotFound)
+	}
+	if page, _ := r.SearchAsOf(internal.Filter{}, internal.PageRequest{}, v1.UpdatedAt); page.Total != 2 {
+		t.Fatalf("%d vehicles as of the update, want 2", page.Total)
+	}
+
+	// - the pruned versions are forgotten, also after a restart
+	prunedAt := time.Now()
+	if n := r.PruneVersions(prunedAt); n != 3 {
+		t.Fatalf("pruned %d versions, want 3", n)
+	}
+	if _, err := r.GetAsOf(1, loaded.UpdatedAt); !errors.Is(err, internal.ErrAsOfExpired) {
+		t.Fatalf("vehicle 1 before the pruning: got %v, want %v", err, internal.ErrAsOfExpired)
+	}
+	if v, err := r.GetAsOf(1, prunedAt); err != nil || v.Color != "Blue" {
+		t.Fatalf("vehicle 1 after the pruning: color %q, %v, want Blue", v.Color, err)
+	}
+	if err := r.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	r, _ = openTestJournal(t, snapshotPath, journalPath)
+	if len(r.versions) != 1 || len(r.versions[1]) != 1 {
+		t.Fatalf("versions %v after the pruning, want the current version of vehicle 1", r.versions)
+	}
+}
+
+// TestVehicleMapJournal_RecoverTornBatch checks that a batch saved at once is recovered all or none after a crash
+// that tore the end of its write
+func TestVehicleMapJournal_RecoverTornBatch(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath, journalPath := filepath.Join(dir, "vehicles.json"), filepath.Join(dir, "vehicles.log")
+	if err := loader.NewVehicleJSONFile(snapshotPath).Write(map[int]internal.Vehicle{}); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+
+	// - a batch of 3 vehicles, the last 20 bytes of the journal are lost
+	r, jr := openTestJournal(t, snapshotPath, journalPath)
+	batch := []internal.Vehicle{newTestVehicle(1), newTestVehicle(2), newTestVehicle(3)}
+	if err := r.SaveMany(batch); err != nil {
+		t.Fatalf("save many: %v", err)
+	}
+	jr.Close()
+	info, _ := os.Stat(journalPath)
+	if err := os.Truncate(journalPath, info.Size()-20); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	// - recover
+	r, _ = openTestJournal(t, snapshotPath, journalPath)
+	if all, _ := r.FindAll(); len(all) != 0 {
+		t.Fatalf("recovered %d vehicles of the torn batch, want none", len(all))
+	}
+	// - the batch can be saved again
+	if err := r.SaveMany(batch); err != nil {
+		t.Fatalf("save many after recovery: %v", err)
+	}
+	r, _ = openTestJournal(t, snapshotPath, journalPath)
+	if all, _ := r.FindAll(); len(all) != 3 {
+		t.Fatalf("recovered %d vehicles, want 3", len(all))
+	}
+}
+
+// TestVehicleMapJournal_RecoverTornTx checks that a transaction torn by a crash while its changes were written is
+// not recovered in part, the changes committed before it are
+func TestVehicleMapJournal_RecoverTornTx(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath, journalPath := filepath.Join(dir, "vehicles.json"), filepath.Join(dir, "vehicles.log")
+	seed := map[int]internal.Vehicle{1: newTestVehicle(1), 2: newTestVehicle(2)}
+	for id, vehicle := range seed {
+		vehicle.Id, vehicle.Version = id, 1
+		seed[id] = vehicle
+	}
+	if err := loader.NewVehicleJSONFile(snapshotPath).Write(seed); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+
+	// - a committed change, then a transaction that updates, deletes and saves whose write is cut in the middle
+	r, jr := openTestJournal(t, snapshotPath, journalPath)
+	v1, _ := r.GetbyID(1)
+	v1.Color = "Blue"
+	if err := r.UpdateVehicle(&v1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	before, _ := os.Stat(journalPath)
+	tx, _ := r.Begin()
+	v1.Color = "Green"
+	if err := tx.UpdateVehicle(&v1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := tx.Delete(2); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	v3 := newTestVehicle(3)
+	if err := tx.Save(&v3); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	jr.Close()
+	b, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	size := int64(len(b))
+	for _, cut := range []int64{size - 1, before.Size() + (size-before.Size())*2/3, before.Size() + 1} {
+		if err := os.WriteFile(journalPath, b[:cut], 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+
+		// - recover, only the change committed before the transaction is kept
+		r, jr = openTestJournal(t, snapshotPath, journalPath)
+		all, _ := r.FindAll()
+		if len(all) != 2 || all[1].Color != "Blue" || all[1].Version != 2 || all[2].Deleted() {
+			t.Fatalf("cut at %d: recovered vehicles %v, want 1 blue and 2", cut, all)
+		}
+		if trash, _ := r.FindTrash(internal.PageRequest{}); trash.Total != 0 {
+			t.Fatalf("cut at %d: recovered trash %v, want none", cut, trash.Vehicles)
+		}
+		if info, _ := os.Stat(journalPath); info.Size() != before.Size() {
+			t.Fatalf("cut at %d: the journal has %d bytes, want %d", cut, info.Size(), before.Size())
+		}
+		jr.Close()
+	}
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// newTestVehicle is a function that returns a valid vehicle with a registration of its own
+func newTestVehicle(n int) internal.Vehicle {
+	return internal.Vehicle{VehicleAttributes: internal.VehicleAttributes{
+		Brand:           fmt.Sprintf("Brand %d", n%10),
+		Model:           fmt.Sprintf("Model %d", n),
+		Registration:    fmt.Sprintf("REG-%d", n),
+		Color:           "Red",
+		FabricationYear: 2000 + n%20,
+		Capacity:        1 + n%7,
+		MaxSpeed:        float64(100 + n%200),
+		FuelType:        "gasoline",
+		Transmission:    "manual",
+		Weight:          float64(1000 + n%500),
+		Dimensions:      internal.Dimensions{Height: 1.5, Length: 4, Width: 2},
+	}}
+}
+
+// TestVehicleMap_ConcurrentSave checks that every vehicle saved concurrently gets an id of its own
+func TestVehicleMap_ConcurrentSave(t *testing.T) {
+	const workers, perWorker = 16, 200
+	r := NewVehicleMap(nil, 0, nil)
+
+	ids := make([][]int, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				vehicle := newTestVehicle(w*perWorker + i)
+				if err := r.Save(&vehicle); err != nil {
+					t.Errorf("save: %v", err)
+					return
+				}
+				ids[w] = append(ids[w], vehicle.Id)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool, workers*perWorker)
+	for _, worker := range ids {
+		for _, id := range worker {
+			if seen[id] {
+				t.Fatalf("id %d was handed out twice", id)
+			}
+			seen[id] = true
+		}
+	}
+	if len(seen) != workers*perWorker {
+		t.Fatalf("saved %d vehicles, want %d", len(seen), workers*perWorker)
+	}
+	for id := 1; id <= workers*perWorker; id++ {
+		if !seen[id] {
+			t.Fatalf("id %d was skipped", id)
+		}
+	}
+	all, _ := r.FindAll()
+	if len(all) != workers*perWorker {
+		t.Fatalf("FindAll returned %d vehicles, want %d", len(all), workers*perWorker)
+	}
+}
+
+// TestVehicleMap_ConcurrentSaveSameRegistration checks that the duplicate check and the save are atomic,
+// only one of the vehicles with the same registration is saved
+func TestVehicleMap_ConcurrentSaveSameRegistration(t *testing.T) {
+	const workers = 64
+	r := NewVehicleMap(nil, 0, nil)
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			vehicle := newTestVehicle(w)
+			// - the same plate, written differently
+			vehicle.Registration = "ab 123"
+			if w%2 == 0 {
+				vehicle.Registration = "AB123"
+			}
+			errs[w] = r.Save(&vehicle)
+		}(w)
+	}
+	wg.Wait()
+
+	saved := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, internal.ErrAlreadyExists):
+			t.Fatalf("save: got %v, want %v", err, internal.ErrAlreadyExists)
+		}
+	}
+	if saved != 1 {
+		t.Fatalf("saved %d vehicles with the same registration, want 1", saved)
+	}
+	all, _ := r.FindAll()
+	if len(all) != 1 {
+		t.Fatalf("FindAll returned %d vehicles, want 1", len(all))
+	}
+}
+
+// TestVehicleMap_ConcurrentSaveDelete checks the repository under saves, deletes and reads at the same time
+func TestVehicleMap_ConcurrentSaveDelete(t *testing.T) {
+	const workers, perWorker = 8, 100
+	r := NewVehicleMap(nil, 0, nil)
+
+	var wg sync.WaitGroup
+	deleted := make([]int, workers)
+	// - writers save vehicles and delete every other one they saved
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				vehicle := newTestVehicle(w*perWorker + i)
+				if err := r.Save(&vehicle); err != nil {
+					t.Errorf("save: %v", err)
+					return
+				}
+				if i%2 == 0 {
+					continue
+				}
+				if err := r.Delete(vehicle.Id); err != nil {
+					t.Errorf("delete %d: %v", vehicle.Id, err)
+					return
+				}
+				deleted[w]++
+			}
+		}(w)
+	}
+	// - readers go through every read path while the writers change the vehicles
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			filter := internal.Filter{Op: internal.FilterEq, Field: "brand", Values: []any{"Brand 3"}}
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				r.FindAll()
+				r.GetbyID(1)
+				r.GetByRegistration("REG-1")
+				r.Search(filter, internal.PageRequest{Limit: 10})
+				r.FindTrash(internal.PageRequest{})
+				r.VelocityAveragebyBrand("Brand 3")
+				r.Revision()
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	total := 0
+	for _, n := range deleted {
+		total += n
+	}
+	all, _ := r.FindAll()
+	if len(all) != workers*perWorker-total {
+		t.Fatalf("FindAll returned %d vehicles, want %d", len(all), workers*perWorker-total)
+	}
+	trash, _ := r.FindTrash(internal.PageRequest{})
+	if trash.Total != total {
+		t.Fatalf("the trash has %d vehicles, want %d", trash.Total, total)
+	}
+	// - the indexes hold the same vehicles as the db
+	page, _ := r.Search(internal.Filter{Op: internal.FilterEq, Field: "brand", Values: []any{"Brand 3"}}, internal.PageRequest{})
+	want := 0
+	for _, vehicle := range all {
+		if vehicle.Brand == "Brand 3" {
+			want++
+		}
+	}
+	if page.Total != want {
+		t.Fatalf("the brand index has %d vehicles, want %d", page.Total, want)
+	}
+}
+
+// newStatsTestMap is a function that returns a repository with the brands Citroën and Ford, spelled in several
+// ways, and a Ford in the trash
+func newStatsTestMap(t *testing.T) *VehicleMap {
+	t.Helper()
+	r := NewVehicleMap(nil, 0, nil)
+	for i, v := range []struct {
+		brand      string
+		year       int
+		speed      float64
+		passengers int
+	}{{"Citroën", 2015, 150, 2}, {"Ford", 2015, 200, 5}, {"CITROEN", 2016, 170, 4}, {"citroen", 2015, 160, 6}, {"Ford", 2016, 180, 5}} {
+		vehicle := newTestVehicle(i + 1)
+		vehicle.Brand, vehicle.FabricationYear, vehicle.MaxSpeed, vehicle.Capacity = v.brand, v.year, v.speed, v.passengers
+		if err := r.Save(&vehicle); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	if err := r.Delete(5); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	return r
+}
+
+// TestVehicleMap_Stats checks the groups and the metrics of the stats of the vehicles, the brands are grouped
+// ignoring case and accents and shown as spelled by the vehicle with the lowest id
+func TestVehicleMap_Stats(t *testing.T) {
+	metrics, _ := internal.ParseMetrics("count,avg(max_speed),min(max_speed),max(max_speed),sum(passengers)")
+	ford := internal.Filter{Op: internal.FilterEq, Field: "brand", Values: []any{"FORD"}}
+	none := internal.Filter{Op: internal.FilterEq, Field: "brand", Values: []any{"Peugeot"}}
+	cases := []struct {
+		name  string
+		query internal.StatsQuery
+		rows  [][]any
+	}{
+		{name: "count", query: internal.StatsQuery{}, rows: [][]any{{4}}},
+		{name: "metrics", query: internal.StatsQuery{Metrics: metrics}, rows: [][]any{{4, 170.0, 150.0, 200.0, 17.0}}},
+		{name: "group by brand", query: internal.StatsQuery{GroupBy: []string{"brand"}, Metrics: metrics}, rows: [][]any{
+			{"Citroën", 3, 160.0, 150.0, 170.0, 12.0},
+			{"Ford", 1, 200.0, 200.0, 200.0, 5.0},
+		}},
+		{name: "group by year and brand", query: internal.StatsQuery{GroupBy: []string{"year", "brand"}}, rows: [][]any{
+			{2015.0, "Citroën", 2},
+			{2015.0, "Ford", 1},
+			{2016.0, "CITROEN", 1},
+		}},
+		{name: "filter", query: internal.StatsQuery{GroupBy: []string{"year"}, Filter: ford}, rows: [][]any{{2015.0, 1}}},
+		{name: "no vehicle", query: internal.StatsQuery{Metrics: metrics, Filter: none}, rows: [][]any{{0, nil, nil, nil, 0.0}}},
+		{name: "no group", query: internal.StatsQuery{GroupBy: []string{"brand"}, Filter: none}, rows: [][]any{}},
+	}
+	r := newStatsTestMap(t)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := r.Stats(c.query)
+			if err != nil {
+				t.Fatalf("stats: %v", err)
+			}
+			if !reflect.DeepEqual(result.Rows, c.rows) {
+				t.Fatalf("rows %v, want %v", result.Rows, c.rows)
+			}
+			if want := len(c.query.GroupBy) + max(len(c.query.Metrics), 1); len(result.Columns) != want {
+				t.Fatalf("%d columns, want %d", len(result.Columns), want)
+			}
+		})
+	}
+
+	// - the queries that are not valid
+	for _, query := range []internal.StatsQuery{
+		{GroupBy: []string{"price"}},
+		{GroupBy: []string{"brand", "brand"}},
+		{Metrics: []internal.Metric{{Aggregate: internal.AggregateAvg, Field: "brand"}}},
+		{Metrics: []internal.Metric{{Aggregate: "median", Field: "max_speed"}}},
+	} {
+		if _, err := r.Stats(query); !errors.Is(err, internal.ErrInvalidStats) {
+			t.Fatalf("stats %+v: got %v, want %v", query, err, internal.ErrInvalidStats)
+		}
+	}
+}
+
+// TestVehicleMap_AverageByBrand checks the averages of a brand ignoring case and accents, and that a brand without
+// vehicles is not found
+func TestVehicleMap_AverageByBrand(t *testing.T) {
+	r := newStatsTestMap(t)
+	for _, brand := range []string{"Citroën", "CITROËN", "citroen"} {
+		if average, err := r.VelocityAveragebyBrand(brand); err != nil || average != 160 {
+			t.Fatalf("velocity average of %s: %v, %v, want 160", brand, average, err)
+		}
+		if average, err := r.CapacityAveragebyBrand(brand); err != nil || average != 4 {
+			t.Fatalf("capacity average of %s: %v, %v, want 4", brand, average, err)
+		}
+	}
+	// - the vehicles in the trash are not counted
+	if average, err := r.VelocityAveragebyBrand("ford"); err != nil || average != 200 {
+		t.Fatalf("velocity average of ford: %v, %v, want 200", average, err)
+	}
+	if _, err := r.VelocityAveragebyBrand("Peugeot"); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("velocity average of a brand without vehicles: got %v, want %v", err, internal.ErrNotFound)
+	}
+}
@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"app/internal"
+	"time"
+)
+
+// vehicleMapTx is a struct that represents a transaction over a VehicleMap
+// the changes are kept in an overlay that only the transaction reads and are applied to the VehicleMap by Commit
+// once they are persisted, so readers never see part of a transaction nor one that fails to persist,
+// the transaction holds the writer lock of the VehicleMap until it ends
+type vehicleMapTx struct {
+	// r is the repository of the transaction
+	r *VehicleMap
+	// persist stores the changes before they are applied to r, all of them or none even if the process stops in
+	// the middle, if it fails they are not applied, it may be nil
+	persist func(records []internal.VehicleRecord) error
+	// changes are the vehicles changed by the transaction by id, with DeletedAt set for the ones in the trash
+	// and nil for the purged ones
+	changes map[int]*internal.Vehicle
+	// order are the ids of changes in the order they were first changed
+	order []int
+	// lastId is the last id used by the transaction
+	lastId int
+	// done is true once the transaction was committed or rolled back
+	done bool
+}
+
+// GetbyID is a method that returns a vehicle by id, including the changes of the transaction
+func (tx *vehicleMapTx) GetbyID(id int) (vehicle internal.Vehicle, err error) {
+	if tx.done {
+		err = internal.ErrTxDone
+		return
+	}
+	vehicle, ok := tx.get(id)
+	if !ok {
+		err = internal.ErrNotFound
+		return
+	}
+	return
+}
+
+// GetTrashed is a method that returns a vehicle of the trash by id, including the changes of the transaction
+func (tx *vehicleMapTx) GetTrashed(id int) (vehicle internal.Vehicle, err error) {
+	if tx.done {
+		err = internal.ErrTxDone
+		return
+	}
+	vehicle, ok := tx.getTrashed(id)
+	if !ok {
+		err = internal.ErrNotFound
+		return
+	}
+	return
+}
+
+// Save is a method that saves a vehicle, the id is assigned when it is saved
+func (tx *vehicleMapTx) Save(vehicle *internal.Vehicle) (err error) {
+	if tx.done {
+		return internal.ErrTxDone
+	}
+	if err = tx.conflict(*vehicle, 0, nil); err != nil {
+		return
+	}
+	tx.lastId++
+	vehicle.Id = tx.lastId
+	vehicle.Version = 1
+	vehicle.UpdatedAt = time.Now().UTC()
+	tx.set(*vehicle)
+	return
+}
+
+// UpdateVehicle is a method that updates a vehicle, its version is set to the next one
+func (tx *vehicleMapTx) UpdateVehicle(vehicle *internal.Vehicle) (err error) {
+	if tx.done {
+		return internal.ErrTxDone
+	}
+	current, ok := tx.get(vehicle.Id)
+	if !ok {
+		return internal.ErrNotFound
+	}
+	//no other vehicle can have the same unique keys, the ones that did not change are not checked
+	if err = tx.conflict(*vehicle, vehicle.Id, &current); err != nil {
+		return
+	}
+	vehicle.Version = current.Version + 1
+	vehicle.UpdatedAt = time.Now().UTC()
+	tx.set(*vehicle)
+	return
+}
+
+// UpdateTrashed is a method that updates a vehicle of the trash, its version is set to the next one
+// it keeps the time it was deleted, the unique keys are not checked because no vehicle in the trash has them
+func (tx *vehicleMapTx) UpdateTrashed(vehicle *internal.Vehicle) (err error) {
+	if tx.done {
+		return internal.ErrTxDone
+	}
+	current, ok := tx.getTrashed(vehicle.Id)
+	if !ok {
+		return internal.ErrNotFound
+	}
+	vehicle.Version = current.Version + 1
+	vehicle.UpdatedAt = time.Now().UTC()
+	vehicle.DeletedAt = current.DeletedAt
+	tx.set(*vehicle)
+	return
+}
+
+// Delete is a method that moves a vehicle to the trash by id
+func (tx *vehicleMapTx) Delete(id int) (err error) {
+	if tx.done {
+		return internal.ErrTxDone
+	}
+	vehicle, ok := tx.get(id)
+	if !ok {
+		return internal.ErrNotFound
+	}
+	vehicle.DeletedAt = time.Now().UTC()
+	tx.set(vehicle)
+	return
+}
+
+// Restore is a method that moves a vehicle back from the trash by id and returns it
+// the vehicle keeps its version and is updated now, it can not be restored while another vehicle has the same
+// unique keys, unless both were loaded with them
+func (tx *vehicleMapTx) Restore(id int) (vehicle internal.Vehicle, err error) {
+	if tx.done {
+		err = internal.ErrTxDone
+		return
+	}
+	vehicle, ok := tx.getTrashed(id)
+	if !ok {
+		err = internal.ErrNotFound
+		return
+	}
+	if err = tx.conflict(vehicle, id, nil); err != nil {
+		return
+	}
+	vehicle.DeletedAt = time.Time{}
+	vehicle.UpdatedAt = time.Now().UTC()
+	tx.set(vehicle)
+	return
+}
+
+// Purge is a method that removes a vehicle of the trash for good by id
+func (tx *vehicleMapTx) Purge(id int) (err error) {
+	if tx.done {
+		return internal.ErrTxDone
+	}
+	if _, ok := tx.getTrashed(id); !ok {
+		return internal.ErrNotFound
+	}
+	if _, found := tx.changes[id]; !found {
+		tx.order = append(tx.order, id)
+	}
+	tx.changes[id] = nil
+	return
+}
+
+// Commit is a method that persists the changes of the transaction at once and then applies them to the repository
+// at once, a crash while they are persisted loses all of them
+// if they can not be persisted the repository is left as it was, except for the ids used, which are not given back
+// so they are never reused
+func (tx *vehicleMapTx) Commit() (err error) {
+	if tx.done {
+		return internal.ErrTxDone
+	}
+	tx.done = true
+	defer tx.r.txMu.Unlock()
+
+	// records, the repository can not change while the transaction holds the writer lock
+	r := tx.r
+	var records []internal.VehicleRecord
+	r.mu.RLock()
+	for _, id := range tx.order {
+		_, existed := r.stored(id)
+		changed := tx.changes[id]
+		if changed == nil && !existed {
+			// saved and purged by the transaction
+			continue
+		}
+		records = append(records, txRecord(id, changed, existed))
+	}
+	r.mu.RUnlock()
+
+	// persist, readers keep seeing the vehicles as they were until the changes are stored
+	if tx.persist != nil && len(records) > 0 {
+		err = tx.persist(records)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tx.lastId > r.lastId {
+		r.lastId = tx.lastId
+	}
+	if err != nil || len(records) == 0 {
+		return
+	}
+	r.write(records)
+	r.changed()
+	return
+}
+
+// Rollback is a method that discards the changes of the transaction, the ids it used are given back
+func (tx *vehicleMapTx) Rollback() (err error) {
+	if tx.done {
+		return internal.ErrTxDone
+	}
+	tx.done = true
+	tx.changes, tx.order = nil, nil
+	tx.r.txMu.Unlock()
+	return
+}
+
+// txRecord is a function that returns the record that leaves a vehicle in a state
+// vehicle is nil when it is purged and existed is whether it was stored before the record
+func txRecord(id int, vehicle *internal.Vehicle, existed bool) internal.VehicleRecord {
+	switch {
+	case vehicle == nil:
+		return internal.VehicleRecord{Op: internal.VehicleOpPurge, Vehicle: internal.Vehicle{Id: id}}
+	case vehicle.Deleted():
+		return internal.VehicleRecord{Op: internal.VehicleOpDelete, Vehicle: *vehicle}
+	case existed:
+		return internal.VehicleRecord{Op: internal.VehicleOpUpdate, Vehicle: *vehicle}
+	}
+	return internal.VehicleRecord{Op: internal.VehicleOpCreate, Vehicle: *vehicle}
+}
+
+// get is a method that returns a vehicle that is not in the trash by id as seen by the transaction
+func (tx *vehicleMapTx) get(id int) (vehicle internal.Vehicle, ok bool) {
+	if changed, found := tx.changes[id]; found {
+		if changed == nil || changed.Deleted() {
+			return
+		}
+		return *changed, true
+	}
+	tx.r.mu.RLock()
+	defer tx.r.mu.RUnlock()
+
+	vehicle, ok = tx.r.db[id]
+	return
+}
+
+// getTrashed is a method that returns a vehicle of the trash by id as seen by the transaction
+func (tx *vehicleMapTx) getTrashed(id int) (vehicle internal.Vehicle, ok bool) {
+	if changed, found := tx.changes[id]; found {
+		if changed == nil || !changed.Deleted() {
+			return
+		}
+		return *changed, true
+	}
+	tx.r.mu.RLock()
+	defer tx.r.mu.RUnlock()
+
+	vehicle, ok = tx.r.trash[id]
+	return
+}
+
+// set is a method that stores a copy of a vehicle in the changes of the transaction
+func (tx *vehicleMapTx) set(vehicle internal.Vehicle) {
+	if _, found := tx.changes[vehicle.Id]; !found {
+		tx.order = append(tx.order, vehicle.Id)
+	}
+	tx.changes[vehicle.Id] = &vehicle
+}
+
+// conflict is a method that checks the unique keys of the policy of the repository against the other vehicles
+// as seen by the transaction, the vehicle with id except, the vehicles in the trash and the vehicles loaded with the
+// same value as the vehicle with id except are skipped, the keys with the same value as current are not checked,
+// current is nil when the vehicle is not stored
+// the error is a *internal.VehicleConflictError with the first vehicle found
+func (tx *vehicleMapTx) conflict(vehicle internal.Vehicle, except int, current *internal.Vehicle) (err error) {
+	for _, key := range tx.r.unique {
+		value := key.Value(vehicle)
+		if value == "" || (current != nil && key.Value(*current) == value) {
+			continue
+		}
+		for id, changed := range tx.changes {
+			if changed == nil || changed.Deleted() || id == except || key.Value(*changed) != value {
+				continue
+			}
+			if !tx.r.loadedTogether(key, value, id, except) {
+				return &internal.VehicleConflictError{Key: key, Id: id}
+			}
+		}
+		if id, found := tx.indexed(key, value, except); found {
+			return &internal.VehicleConflictError{Key: key, Id: id}
+		}
+	}
+	return
+}
+
+// indexed is a method that returns the id of a stored vehicle with a value of a unique key
+// the vehicle with id except, the vehicles loaded with the same value and the vehicles changed by the transaction
+// are skipped
+func (tx *vehicleMapTx) indexed(key internal.UniqueKey, value string, except int) (id int, found bool) {
+	tx.r.mu.RLock()
+	defer tx.r.mu.RUnlock()
+
+	for id := range tx.r.ix.unique[key][value] {
+		// the changes of the transaction replace the vehicle
+		if _, changed := tx.changes[id]; changed || id == except || tx.r.loadedTogether(key, value, id, except) {
+			continue
+		}
+		return id, true
+	}
+	return
+}
@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"app/internal"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// txTestState is a struct that represents everything a transaction may change in a VehicleMap
+type txTestState struct {
+	db       map[int]internal.Vehicle
+	trash    map[int]internal.Vehicle
+	lastId   int
+	revision internal.VehicleRevision
+}
+
+// newTxTestMap is a function that returns a repository with vehicles 1 to 4 and vehicle 5 in the trash
+func newTxTestMap(t *testing.T) *VehicleMap {
+	t.Helper()
+	r := NewVehicleMap(nil, 0, nil)
+	for n := 1; n <= 5; n++ {
+		vehicle := newTestVehicle(n)
+		if err := r.Save(&vehicle); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	if err := r.Delete(5); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	return r
+}
+
+// txTestStateOf is a function that returns a copy of the state of a repository
+func txTestStateOf(r *VehicleMap) (s txTestState) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s = txTestState{db: make(map[int]internal.Vehicle), trash: make(map[int]internal.Vehicle), lastId: r.lastId, revision: r.revision}
+	for id, vehicle := range r.db {
+		s.db[id] = vehicle
+	}
+	for id, vehicle := range r.trash {
+		s.trash[id] = vehicle
+	}
+	return
+}
+
+// checkTxTestIndexes is a function that checks that the indexes of a repository are the ones of its vehicles
+func checkTxTestIndexes(t *testing.T, r *VehicleMap) {
+	t.Helper()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if want := newVehicleIndexes(r.db); !reflect.DeepEqual(r.ix, want) {
+		t.Fatalf("the indexes do not match the vehicles")
+	}
+}
+
+// changeTxTestMap is a function that makes every kind of change in a transaction: vehicle 6 is saved, 1 is updated
+// with a new registration, 2 is deleted, 5 is restored and 3 is deleted and purged
+func changeTxTestMap(t *testing.T, tx internal.VehicleTx) {
+	t.Helper()
+	v6 := newTestVehicle(6)
+	if err := tx.Save(&v6); err != nil || v6.Id != 6 {
+		t.Fatalf("save: id %d, %v, want id 6", v6.Id, err)
+	}
+	v1, _ := tx.GetbyID(1)
+	v1.Color, v1.Registration = "Blue", "NEW-1"
+	if err := tx.UpdateVehicle(&v1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := tx.Delete(2); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := tx.Restore(5); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if err := tx.Delete(3); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := tx.Purge(3); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+}
+
+// TestVehicleMapTx_Rollback checks that a rolled back transaction leaves the vehicles, the trash, the indexes and
+// the ids exactly as they were
+func TestVehicleMapTx_Rollback(t *testing.T) {
+	r := newTxTestMap(t)
+	before := txTestStateOf(r)
+
+	tx, _ := r.Begin()
+	changeTxTestMap(t, tx)
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+
+	if after := txTestStateOf(r); !reflect.DeepEqual(after, before) {
+		t.Fatalf("the rollback changed the repository")
+	}
+	checkTxTestIndexes(t, r)
+	if _, err := r.GetByRegistration("NEW-1"); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("the registration of a rolled back update is indexed: %v", err)
+	}
+	// - the ids used by the transaction are given back
+	v := newTestVehicle(7)
+	if err := r.Save(&v); err != nil || v.Id != 6 {
+		t.Fatalf("save after the rollback: id %d, %v, want id 6", v.Id, err)
+	}
+	// - a transaction can not be used once it ended
+	if err := tx.Commit(); !errors.Is(err, internal.ErrTxDone) {
+		t.Fatalf("commit after the rollback: got %v, want %v", err, internal.ErrTxDone)
+	}
+}
+
+// TestVehicleMapTx_CommitPersistFails checks that the changes of a transaction that can not be persisted are never
+// seen by the readers and leave the vehicles, the trash and the indexes as they were, only the ids used are kept
+func TestVehicleMapTx_CommitPersistFails(t *testing.T) {
+	r := newTxTestMap(t)
+	before := txTestStateOf(r)
+
+	errPersist := errors.New("disk full")
+	persisted := 0
+	tx := r.begin(func(records []internal.VehicleRecord) error {
+		persisted = len(records)
+		// - the readers do not see the changes while they are persisted
+		if during := txTestStateOf(r); !reflect.DeepEqual(during, before) {
+			t.Errorf("the changes were seen before they were persisted")
+		}
+		if v1, _ := r.GetbyID(1); v1.Color != "Red" {
+			t.Errorf("vehicle 1 was read with color %q before it was persisted", v1.Color)
+		}
+		return errPersist
+	})
+	changeTxTestMap(t, tx)
+	if err := tx.Commit(); !errors.Is(err, errPersist) {
+		t.Fatalf("commit: got %v, want %v", err, errPersist)
+	}
+	if persisted != 5 {
+		t.Fatalf("persisted %d records, want 5", persisted)
+	}
+
+	after := txTestStateOf(r)
+	if !reflect.DeepEqual(after.db, before.db) || !reflect.DeepEqual(after.trash, before.trash) || after.revision != before.revision {
+		t.Fatalf("the failed commit changed the repository")
+	}
+	checkTxTestIndexes(t, r)
+	// - the ids used are not given back, they may be in a partly written journal
+	if after.lastId != 6 {
+		t.Fatalf("last id %d after the failed commit, want 6", after.lastId)
+	}
+	v := newTestVehicle(7)
+	if err := r.Save(&v); err != nil || v.Id != 7 {
+		t.Fatalf("save after the failed commit: id %d, %v, want id 7", v.Id, err)
+	}
+}
+
+// TestVehicleMapTx_Commit checks that the changes of a transaction are applied at once and indexed
+func TestVehicleMapTx_Commit(t *testing.T) {
+	r := newTxTestMap(t)
+	before := txTestStateOf(r)
+
+	tx, _ := r.Begin()
+	changeTxTestMap(t, tx)
+	// - nothing is seen until the commit
+	if during := txTestStateOf(r); !reflect.DeepEqual(during, before) {
+		t.Fatalf("the changes were seen before the commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	after := txTestStateOf(r)
+	ids := func(m map[int]internal.Vehicle) (ids []int) {
+		for id := range [7]int{} {
+			if _, ok := m[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		return
+	}
+	if got := ids(after.db); !reflect.DeepEqual(got, []int{1, 4, 5, 6}) {
+		t.Fatalf("vehicles %v after the commit, want [1 4 5 6]", got)
+	}
+	if got := ids(after.trash); !reflect.DeepEqual(got, []int{2}) {
+		t.Fatalf("trash %v after the commit, want [2]", got)
+	}
+	if after.lastId != 6 || after.revision.Counter != before.revision.Counter+1 {
+		t.Fatalf("last id %d and revision %d after the commit, want 6 and %d", after.lastId, after.revision.Counter, before.revision.Counter+1)
+	}
+	if after.db[1].Color != "Blue" || after.db[1].Version != 2 {
+		t.Fatalf("vehicle 1 with color %q and version %d after the commit, want Blue and 2", after.db[1].Color, after.db[1].Version)
+	}
+	checkTxTestIndexes(t, r)
+	if v, err := r.GetByRegistration("new-1"); err != nil || v.Id != 1 {
+		t.Fatalf("registration NEW-1 is vehicle %d, %v, want 1", v.Id, err)
+	}
+}
+
+// TestVehicleMapTx_LoadedDuplicates checks that the vehicles loaded with the same registration are kept and can
+// still be changed and restored, while no change makes a new duplicate
+func TestVehicleMapTx_LoadedDuplicates(t *testing.T) {
+	db := make(map[int]internal.Vehicle)
+	for id, plate := range map[int]string{1: "DUP", 2: "dup ", 3: "DUP", 4: "OTHER", 5: "FREE"} {
+		vehicle := newTestVehicle(id)
+		vehicle.Id, vehicle.Version, vehicle.Registration = id, 1, plate
+		db[id] = vehicle
+	}
+	for _, id := range []int{3, 5} {
+		vehicle := db[id]
+		vehicle.DeletedAt = time.Now()
+		db[id] = vehicle
+	}
+	r := NewVehicleMap(db, 5, nil)
+	want := map[internal.UniqueKey]map[string][]int{internal.UniqueRegistration: {"DUP": {1, 2, 3}}}
+	if got := r.Duplicates(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("duplicates %v, want %v", got, want)
+	}
+
+	// - a duplicate is updated without changing its registration
+	v1, _ := r.GetbyID(1)
+	v1.MaxSpeed = 150
+	if err := r.UpdateVehicle(&v1); err != nil {
+		t.Fatalf("update of a duplicate: %v", err)
+	}
+	// - a duplicate is restored next to the vehicles it was loaded with
+	tx, _ := r.Begin()
+	if _, err := tx.Restore(3); err != nil {
+		t.Fatalf("restore of a duplicate: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	// - no new duplicate is made, the conflict is with any of the vehicles with the registration
+	conflicts := []struct {
+		name   string
+		change func() error
+		ids    []int
+	}{
+		{"update to a duplicated registration", func() error {
+			v4, _ := r.GetbyID(4)
+			v4.Registration = "DUP"
+			return r.UpdateVehicle(&v4)
+		}, []int{1, 2, 3}},
+		{"update of a duplicate to another registration", func() error {
+			v2, _ := r.GetbyID(2)
+			v2.Registration = "other"
+			return r.UpdateVehicle(&v2)
+		}, []int{4}},
+		{"save of a duplicated registration", func() error {
+			v := newTestVehicle(6)
+			v.Registration = "DUP"
+			return r.Save(&v)
+		}, []int{1, 2, 3}},
+		{"restore of a registration saved since", func() error {
+			v := newTestVehicle(7)
+			v.Registration = "FREE"
+			if err := r.Save(&v); err != nil {
+				return err
+			}
+			tx, _ := r.Begin()
+			defer tx.Rollback()
+			_, err := tx.Restore(5)
+			return err
+		}, []int{6}},
+	}
+	for _, c := range conflicts {
+		var conflict *internal.VehicleConflictError
+		if err := c.change(); !errors.As(err, &conflict) || !slices.Contains(c.ids, conflict.Id) {
+			t.Fatalf("%s: got %v, want a conflict with vehicle %v", c.name, err, c.ids)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"app/internal"
+	"sort"
+	"time"
+)
+
+// vehicleVersion is a struct that represents the state of a vehicle from a time until the next version
+type vehicleVersion struct {
+	// from is the time the state started
+	from time.Time
+	// vehicle is the state of the vehicle, nil while it was deleted
+	vehicle *internal.Vehicle
+}
+
+// vehicleVersions is a map from the id of a vehicle to its versions, oldest first
+// the versions are kept after the vehicle is deleted or purged, so the vehicles can be read as they were at any time
+type vehicleVersions map[int][]vehicleVersion
+
+// add is a method that adds the state of a vehicle from a time, vehicle is nil when it was deleted
+// the versions at or after that time are replaced, so adding a version twice has the same effect as once
+// and adding an older version undoes the newer ones
+func (vs vehicleVersions) add(id int, from time.Time, vehicle *internal.Vehicle) {
+	versions := vs[id]
+	i := sort.Search(len(versions), func(i int) bool { return !versions[i].from.Before(from) })
+	vs[id] = append(versions[:i], vehicleVersion{from: from, vehicle: vehicle})
+}
+
+// forget is a method that removes every version of a vehicle
+func (vs vehicleVersions) forget(id int) {
+	delete(vs, id)
+}
+
+// at is a method that returns the state of a vehicle at a time, ok is false if it did not exist or was deleted
+func (vs vehicleVersions) at(id int, t time.Time) (vehicle internal.Vehicle, ok bool) {
+	versions := vs[id]
+	// the last version that started at or before t
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].from.After(t) }) - 1
+	if i < 0 || versions[i].vehicle == nil {
+		return
+	}
+	return *versions[i].vehicle, true
+}
+
+// prune is a method that removes the versions that ended at or before a time, the version a vehicle had at that time
+// is kept, the vehicles that were already deleted at that time are removed, n is the number of versions removed
+func (vs vehicleVersions) prune(before time.Time) (n int) {
+	for id, versions := range vs {
+		// the last version that started at or before the time
+		i := sort.Search(len(versions), func(i int) bool { return versions[i].from.After(before) }) - 1
+		if i < 0 {
+			continue
+		}
+		if versions[i].vehicle == nil {
+			i++
+		}
+		n += i
+		if i == len(versions) {
+			delete(vs, id)
+			continue
+		}
+		vs[id] = append([]vehicleVersion(nil), versions[i:]...)
+	}
+	return
+}
+
+// merge is a method that adds every version of other, the versions of other replace the ones of vs from their time on
+func (vs vehicleVersions) merge(other vehicleVersions) {
+	for id, versions := range other {
+		for _, version := range versions {
+			vs.add(id, version.from, version.vehicle)
+		}
+	}
+}
+
+// addRecord is a method that adds the version written by a record of the history
+func (vs vehicleVersions) addRecord(record internal.VehicleRecord) {
+	vehicle := record.Vehicle
+	switch record.Op {
+	case internal.VehicleOpCreate, internal.VehicleOpUpdate:
+		vs.add(vehicle.Id, vehicle.UpdatedAt, &vehicle)
+	case internal.VehicleOpDelete:
+		vs.add(vehicle.Id, vehicle.DeletedAt, nil)
+	}
+}
+
+// records is a method that returns a record for every version, ordered by id and time, the deletions only have
+// the id and the deletion time
+func (vs vehicleVersions) records() (records []internal.VehicleRecord) {
+	ids := make([]int, 0, len(vs))
+	for id := range vs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		for _, version := range vs[id] {
+			if version.vehicle == nil {
+				records = append(records, internal.VehicleRecord{Op: internal.VehicleOpDelete, Vehicle: internal.Vehicle{Id: id, DeletedAt: version.from}})
+				continue
+			}
+			vehicle := *version.vehicle
+			vehicle.UpdatedAt = version.from
+			records = append(records, internal.VehicleRecord{Op: internal.VehicleOpUpdate, Vehicle: vehicle})
+		}
+	}
+	return
+}
@@ -2,18 +2,90 @@ package service
 
 import (
 	"app/internal"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ActorAnonymous is the actor of the changes made without one
+	ActorAnonymous = "anonymous"
 )
 
 // NewVehicleDefault is a function that returns a new instance of VehicleDefault
-func NewVehicleDefault(rp internal.VehicleRepository) *VehicleDefault {
-	return &VehicleDefault{rp: rp}
+// every change is recorded in the audit store as made by ActorAnonymous, use As to set who makes them,
+// the vehicles saved or updated are checked with the rules of vr and their registration plates
+// with the formats of pl, and their fuel type, transmission and color are set to their canonical values in vc
+func NewVehicleDefault(rp internal.VehicleRepository, au internal.AuditStore, pl *internal.PlateRegistry, vr *internal.VehicleValidator, vc internal.Vocabularies) *VehicleDefault {
+	return &VehicleDefault{rp: rp, au: au, pl: pl, vr: vr, vc: vc, actor: ActorAnonymous, mu: &sync.Mutex{}}
 }
 
 // VehicleDefault is a struct that represents the default service for vehicles
 type VehicleDefault struct {
 	// rp is the repository that will be used by the service
 	rp internal.VehicleRepository
+	// au is the audit store where the changes are recorded
+	au internal.AuditStore
+	// pl are the formats of the registration plates by country
+	pl *internal.PlateRegistry
+	// vr are the validation rules of the vehicles
+	vr *internal.VehicleValidator
+	// vc are the vocabularies of the text fields of the vehicles
+	vc internal.Vocabularies
+	// actor is who makes the changes
+	actor string
+	// mu serializes the transactions with the recording of their audit entries, so the entries are recorded in
+	// the order of the changes, it is shared by the services returned by As
+	mu *sync.Mutex
+}
+
+// As is a method that returns the service for the changes made by an actor
+func (s *VehicleDefault) As(actor string) internal.VehicleService {
+	if actor == "" {
+		actor = ActorAnonymous
+	}
+	return &VehicleDefault{rp: s.rp, au: s.au, pl: s.pl, vr: s.vr, vc: s.vc, actor: actor, mu: s.mu}
+}
+
+// auditFunc is a type that represents a function that records a change of a vehicle in the audit trail
+type auditFunc func(op internal.AuditOp, before, after *internal.Vehicle)
+
+// auditEntry is a method that returns the audit entry of a change of a vehicle made by the actor of the service
+func (s *VehicleDefault) auditEntry(op internal.AuditOp, before, after *internal.Vehicle) (entry *internal.AuditEntry) {
+	entry = &internal.AuditEntry{
+		Time:    time.Now().UTC(),
+		Actor:   s.actor,
+		Op:      op,
+		Changes: internal.DiffVehicles(before, after),
+	}
+	switch {
+	case after != nil:
+		entry.VehicleId, entry.Version = after.Id, after.Version
+	case before != nil:
+		entry.VehicleId, entry.Version = before.Id, before.Version
+	}
+	return
+}
+
+// History is a method that returns the audit entries of a vehicle, oldest first
+// the vehicle may have been deleted, the error is ErrNotFound when it has no entries and does not exist
+func (s *VehicleDefault) History(id int) (entries []internal.AuditEntry, err error) {
+	entries, err = s.au.FindByVehicle(id)
+	if err != nil || len(entries) > 0 {
+		return
+	}
+	_, err = s.GetByID(id)
+	return
+}
+
+// Audit is a method that returns the audit entries of every vehicle made at or after a time, oldest first
+func (s *VehicleDefault) Audit(since time.Time) (entries []internal.AuditEntry, err error) {
+	entries, err = s.au.FindSince(since)
+	return
 }
 
 // FindAll is a method that returns a map of all vehicles
@@ -22,214 +94,541 @@ func (s *VehicleDefault) FindAll() (v map[int]internal.Vehicle, err error) {
 	return
 }
 
-func ValidateVehicle(vehicle *internal.Vehicle) (err error) {
-	// - validate required fields
-	switch {
-	case (*vehicle).Brand == "":
-		return fmt.Errorf("%w: Brand", internal.ErrFieldRequired)
-	case (*vehicle).Model == "":
-		return fmt.Errorf("%w: Model", internal.ErrFieldRequired)
-	case (*vehicle).Color == "":
-		return fmt.Errorf("%w: color", internal.ErrFieldRequired)
-	case (*vehicle).FabricationYear == 0:
-		return fmt.Errorf("%w: Year", internal.ErrFieldRequired)
-	case (*vehicle).Capacity == 0:
-		return fmt.Errorf("%w: Passengers", internal.ErrFieldRequired)
-	case (*vehicle).Transmission == "":
-		return fmt.Errorf("%w: Transmission", internal.ErrFieldRequired)
-	case (*vehicle).MaxSpeed == 0:
-		return fmt.Errorf("%w: Max Speed", internal.ErrVelocityOutOfRange)
-	default:
-		return nil
-
+// validate is a method that checks the rules of a vehicle and the format of its registration plate
+// the country code of the vehicle is set in upper case and the fields with a vocabulary to their canonical values,
+// before is the stored vehicle, nil for a new one, the plate is only checked when it or its country changed, so the
+// vehicles saved before a format was enforced can still be updated,
+// the error is a *internal.ValidationError with every violation
+func (s *VehicleDefault) validate(vehicle *internal.Vehicle, before *internal.Vehicle) (err error) {
+	vehicle.Country = strings.ToUpper(strings.TrimSpace(vehicle.Country))
+	violations := s.vc.Canonicalize(vehicle)
+	for field, messages := range s.vr.Validate(*vehicle) {
+		if violations == nil {
+			violations = make(map[string][]string)
+		}
+		violations[field] = append(violations[field], messages...)
 	}
-
+	var causes []error
+	plateChanged := before == nil || before.Country != vehicle.Country ||
+		internal.NormalizeRegistration(before.Registration) != internal.NormalizeRegistration(vehicle.Registration)
+	if plateChanged {
+		if err := s.pl.Validate(vehicle.Country, vehicle.Registration); err != nil {
+			if violations == nil {
+				violations = make(map[string][]string)
+			}
+			violations["registration"] = append(violations["registration"], err.Error())
+			causes = append(causes, err)
+		}
+	}
+	if violations != nil {
+		err = &internal.ValidationError{Fields: violations, Causes: causes}
+	}
+	return
 }
 
 func (s *VehicleDefault) Save(vehicle *internal.Vehicle) (err error) {
 	//validate business rules
-	if err = ValidateVehicle(vehicle); err != nil {
+	if err = s.validate(vehicle, nil); err != nil {
 		return
 	}
 
 	// save vehicle
-	err = s.rp.Save(vehicle)
-	if err != nil {
-		switch err {
-		case internal.ErrAlreadyExists:
-			return fmt.Errorf("%w: %s", internal.ErrVehicleAlreadyExists, err.Error())
+	err = s.transaction(func(tx internal.VehicleTx, audit auditFunc) error {
+		if err := tx.Save(vehicle); err != nil {
+			return err
 		}
-		return
-	}
+		audit(internal.AuditOpCreate, nil, vehicle)
+		return nil
+	})
 	return
 }
 
 // GetByID is a method that returns a vehicle by id
 func (s *VehicleDefault) GetByID(id int) (vehicle internal.Vehicle, err error) {
 	vehicle, err = s.rp.GetbyID(id)
-	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrorNotFound:
-			err = fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
-		}
-		return
-	}
 	return
 }
 
-// FindByColorAndYear is a method that returns a map of vehicles by color and year
-func (s *VehicleDefault) FindByColorAndYear(color string, year int) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle, err = s.rp.FindByColorAndYear(color, year)
+// GetByRegistration is a method that returns a vehicle by its registration plate, ignoring case and spaces
+func (s *VehicleDefault) GetByRegistration(plate string) (vehicle internal.Vehicle, err error) {
+	vehicle, err = s.rp.GetByRegistration(plate)
+	return
+}
+
+// GetByIDAsOf is a method that returns a vehicle by id as it was at a time, it may have been deleted since
+func (s *VehicleDefault) GetByIDAsOf(id int, at time.Time) (vehicle internal.Vehicle, err error) {
+	vehicle, err = s.rp.GetAsOf(id, at)
+	return
+}
+
+// SearchAsOf is a method that returns the requested page of the vehicles that matched the filter at a time
+func (s *VehicleDefault) SearchAsOf(filter internal.Filter, page internal.PageRequest, at time.Time) (result internal.VehiclePage, err error) {
+	result, err = s.rp.SearchAsOf(filter, page, at)
+	return
+}
+
+// Search is a method that returns the requested page of the vehicles that match the filter
+func (s *VehicleDefault) Search(filter internal.Filter, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	result, err = s.rp.Search(filter, page)
+	return
+}
+
+// searchOrNotFound is a method that returns the vehicles that match the filter or an error if there is none
+func (s *VehicleDefault) searchOrNotFound(filter internal.Filter, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	result, err = s.rp.Search(filter, page)
 	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrorNotFound:
-			err = fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
-		}
 		return
 	}
+	//if there is no vehicle, return an error
+	if result.Total == 0 {
+		err = internal.ErrNotFound
+	}
 	return
 }
 
-func (s *VehicleDefault) FindByBrandAndYearRange(brand string, yearRange [2]int) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle, err = s.rp.FindByBrandAndYearRange(brand, yearRange)
+// transaction is a method that runs a change in a repository transaction
+// the transaction is committed if the change succeeds and rolled back otherwise, the changes recorded with audit
+// are appended to the audit trail once the transaction is committed, so a change that fails is never recorded,
+// an audit trail that can not be appended to does not fail a change that was already committed, it is logged
+func (s *VehicleDefault) transaction(change func(tx internal.VehicleTx, audit auditFunc) error) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.rp.Begin()
 	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrorNotFound:
-			err = fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
-		}
 		return
 	}
+	// rolling back a committed transaction does nothing
+	defer tx.Rollback()
+
+	var entries []*internal.AuditEntry
+	audit := func(op internal.AuditOp, before, after *internal.Vehicle) {
+		entries = append(entries, s.auditEntry(op, before, after))
+	}
+	if err = change(tx, audit); err != nil {
+		return
+	}
+	if err = tx.Commit(); err != nil || len(entries) == 0 {
+		return
+	}
+	if auditErr := s.au.Append(entries...); auditErr != nil {
+		log.Printf("audit: %d entries of a committed change were not recorded: %v", len(entries), auditErr)
+	}
+	return
+}
+
+// FindByColorAndYear is a method that returns a page of vehicles by color and year
+func (s *VehicleDefault) FindByColorAndYear(color string, year int, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	result, err = s.searchOrNotFound(internal.Filter{Op: internal.FilterAnd, Filters: []internal.Filter{
+		{Op: internal.FilterEq, Field: "color", Values: []any{color}},
+		{Op: internal.FilterEq, Field: "year", Values: []any{float64(year)}},
+	}}, page)
+	return
+}
+
+// FindByBrandAndYearRange is a method that returns a page of vehicles by brand and year range
+func (s *VehicleDefault) FindByBrandAndYearRange(brand string, yearRange [2]int, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	result, err = s.searchOrNotFound(internal.Filter{Op: internal.FilterAnd, Filters: []internal.Filter{
+		{Op: internal.FilterEq, Field: "brand", Values: []any{brand}},
+		{Op: internal.FilterBetween, Field: "year", Values: []any{float64(yearRange[0]), float64(yearRange[1])}},
+	}}, page)
 	return
 }
 
 // VelocityAveragebyBrand is a method that returns the average velocity by brand
 func (s *VehicleDefault) VelocityAveragebyBrand(brand string) (average float64, err error) {
 	average, err = s.rp.VelocityAveragebyBrand(brand)
+	return
+}
+
+// SaveMany is a method that saves many vehicles, all or nothing
+// every vehicle is validated before any is saved, the error of the first vehicle that fails is a *internal.VehicleBatchError
+func (s *VehicleDefault) SaveMany(vehicles []internal.Vehicle) (err error) {
+	//validate business rules
+	for i := range vehicles {
+		if err = s.validate(&vehicles[i], nil); err != nil {
+			return &internal.VehicleBatchError{Index: i, Err: err}
+		}
+	}
+
+	// save vehicles in a transaction, so none is saved if one fails
+	err = s.transaction(func(tx internal.VehicleTx, audit auditFunc) error {
+		for i := range vehicles {
+			if err := tx.Save(&vehicles[i]); err != nil {
+				// a conflict names the vehicle of the batch it is with, if any
+				return &internal.VehicleBatchError{Index: i, Err: batchConflict(vehicles[:i], err)}
+			}
+			audit(internal.AuditOpCreate, nil, &vehicles[i])
+		}
+		return nil
+	})
 	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrorNotFound:
-			err = fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
+		// the ids assigned by the transaction were not kept
+		for i := range vehicles {
+			vehicles[i].Id = 0
+			vehicles[i].Version = 0
 		}
 		return
 	}
 	return
 }
 
-// SaveMany is a method that saves many vehicles
-func (s *VehicleDefault) SaveMany(vehicles []internal.Vehicle) (err error) {
-	err = s.rp.SaveMany(vehicles)
-	if err != nil {
-		switch err {
-		case internal.ErrAlreadyExists:
-			return fmt.Errorf("%w: %s", internal.ErrVehicleAlreadyExists, err.Error())
+// batchConflict is a function that names the position of the vehicle of a batch that a vehicle conflicts with
+// the ids assigned to the batch are not kept when it fails, so they are not reported
+func batchConflict(saved []internal.Vehicle, err error) error {
+	var conflict *internal.VehicleConflictError
+	if !errors.As(err, &conflict) {
+		return err
+	}
+	for i := range saved {
+		if saved[i].Id == conflict.Id {
+			return internal.ErrAlreadyExists.Errorf(string(conflict.Key), "vehicle %d of the batch has the same %s", i, conflict.Key)
 		}
-		return
+	}
+	return err
+}
+
+// SaveEach is a method that saves every vehicle on its own, a vehicle that fails does not stop the others
+// errs has the error of each vehicle in the same position, nil for the vehicles that were saved
+func (s *VehicleDefault) SaveEach(vehicles []internal.Vehicle) (errs []error) {
+	errs = make([]error, len(vehicles))
+	for i := range vehicles {
+		errs[i] = s.Save(&vehicles[i])
 	}
 	return
 }
 
 // UpdateVehicle is a method that updates a vehicle
+// if the version of the vehicle is not zero it must be the current one, on success it is set to the new version
 func (s *VehicleDefault) UpdateVehicle(vehicle *internal.Vehicle) (err error) {
-	//validate business rules
-	//velocity must be between 0 and 300
-	if err = ValidateVehicle(vehicle); err != nil {
-		return
-	}
-	// update vehicle
-	err = s.rp.UpdateVehicle(vehicle)
-	if err != nil {
-		switch err {
-		case internal.ErrorNotFound:
-			return fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
+	// update vehicle, the version is checked in the same transaction so no other change can happen in between
+	err = s.transaction(func(tx internal.VehicleTx, audit auditFunc) error {
+		before, err := checkVersion(tx, vehicle.Id, vehicle.Version)
+		if err != nil {
+			return err
 		}
-		return
-	}
+		//validate business rules
+		//velocity must be between 0 and 300
+		if err := s.validate(vehicle, &before); err != nil {
+			return err
+		}
+		if err := tx.UpdateVehicle(vehicle); err != nil {
+			return err
+		}
+		audit(internal.AuditOpUpdate, &before, vehicle)
+		return nil
+	})
 	return
 }
 
-// FindByFuelType is a method that returns a map of vehicles by fuel type
-func (s *VehicleDefault) FindByFuelType(fueltype string) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle, err = s.rp.FindByFuelType(fueltype)
-	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrorNotFound:
-			err = fmt.Errorf("%w:FuelType%s", internal.ErrNotFound, err.Error())
+// PatchVehicle is a method that applies a patch to a vehicle and returns the updated vehicle
+// if version is not zero it must be the current version of the vehicle, the patched vehicle is validated again
+// and the whole change is done in a transaction, so the patch is always applied to the latest version
+func (s *VehicleDefault) PatchVehicle(id int, version int, patch internal.VehiclePatch) (vehicle internal.Vehicle, err error) {
+	err = s.transaction(func(tx internal.VehicleTx, audit auditFunc) (err error) {
+		// get current vehicle
+		before, err := checkVersion(tx, id, version)
+		if err != nil {
+			return
 		}
-		return
-	}
+		vehicle = before
+
+		// apply patch
+		if err = patch(&vehicle); err != nil {
+			// the patch is invalid unless its error is of another kind, like a test that failed
+			if internal.KindOf(err) == internal.KindInternal {
+				err = fmt.Errorf("%w: %w", internal.ErrInvalidPatch, err)
+			}
+			return
+		}
+		// - the id is not part of the patch
+		vehicle.Id = id
+
+		//validate business rules
+		if err = s.validate(&vehicle, &before); err != nil {
+			return
+		}
+		// update vehicle
+		if err = tx.UpdateVehicle(&vehicle); err != nil {
+			return
+		}
+		audit(internal.AuditOpUpdate, &before, &vehicle)
+		return nil
+	})
+	return
+}
+
+// FindByFuelType is a method that returns a page of vehicles by fuel type
+func (s *VehicleDefault) FindByFuelType(fueltype string, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	result, err = s.searchOrNotFound(internal.Filter{Op: internal.FilterEq, Field: "fuel_type", Values: []any{fueltype}}, page)
+	return
+}
+
+// Delete is a method that moves a vehicle to the trash, it can be restored until it is purged
+// if version is not zero it must be the current version of the vehicle
+func (s *VehicleDefault) Delete(id int, version int) (err error) {
+	err = s.transaction(func(tx internal.VehicleTx, audit auditFunc) error {
+		before, err := checkVersion(tx, id, version)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(id); err != nil {
+			return err
+		}
+		audit(internal.AuditOpDelete, &before, nil)
+		return nil
+	})
 	return
 }
 
-// Delete is a method that deletes a vehicle
-func (s *VehicleDefault) Delete(id int) (err error) {
-	err = s.rp.Delete(id)
+// FindTrash is a method that returns the requested page of the vehicles in the trash
+func (s *VehicleDefault) FindTrash(page internal.PageRequest) (result internal.VehiclePage, err error) {
+	result, err = s.rp.FindTrash(page)
+	return
+}
+
+// Restore is a method that moves a vehicle back from the trash and returns it
+func (s *VehicleDefault) Restore(id int) (vehicle internal.Vehicle, err error) {
+	err = s.transaction(func(tx internal.VehicleTx, audit auditFunc) (err error) {
+		if vehicle, err = tx.Restore(id); err != nil {
+			return
+		}
+		audit(internal.AuditOpRestore, nil, &vehicle)
+		return nil
+	})
+	return
+}
+
+// Purge is a method that removes a vehicle of the trash for good
+func (s *VehicleDefault) Purge(id int) (err error) {
+	err = s.transaction(func(tx internal.VehicleTx, audit auditFunc) error {
+		vehicle, err := tx.GetTrashed(id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Purge(id); err != nil {
+			return err
+		}
+		// the fields were recorded as removed when the vehicle was deleted, the entry has no changes
+		audit(internal.AuditOpPurge, &vehicle, &vehicle)
+		return nil
+	})
+	return
+}
+
+// PurgeTrash is a method that purges the vehicles moved to the trash before a time and returns how many were purged
+// all of them are purged in a single transaction
+func (s *VehicleDefault) PurgeTrash(before time.Time) (purged int, err error) {
+	trash, err := s.rp.FindTrash(internal.PageRequest{})
 	if err != nil {
-		switch err {
-		case internal.ErrorNotFound:
-			return fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
+		return
+	}
+	err = s.transaction(func(tx internal.VehicleTx, audit auditFunc) error {
+		for _, listed := range trash.Vehicles {
+			// the vehicle may have been restored or purged since the trash was read
+			vehicle, err := tx.GetTrashed(listed.Id)
+			if errors.Is(err, internal.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !vehicle.DeletedAt.Before(before) {
+				continue
+			}
+			if err := tx.Purge(vehicle.Id); err != nil {
+				return err
+			}
+			audit(internal.AuditOpPurge, &vehicle, &vehicle)
+			purged++
 		}
+		return nil
+	})
+	if err != nil {
+		purged = 0
 		return
 	}
 	return
 }
 
-// Findbytransmission is a method that returns a map of vehicles by transmission
-func (s *VehicleDefault) FindByTransmission(transmission string) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle, err = s.rp.FindByTransmission(transmission)
+// checkVersion is a function that returns the current vehicle of a transaction
+// if version is not zero and the vehicle has another version the error wraps internal.ErrVersionMismatch
+func checkVersion(tx internal.VehicleTx, id int, version int) (vehicle internal.Vehicle, err error) {
+	vehicle, err = tx.GetbyID(id)
 	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrorNotFound:
-			err = fmt.Errorf("%w:Transmission%s", internal.ErrNotFound, err.Error())
-		}
+		return
+	}
+	if version != 0 && version != vehicle.Version {
+		err = fmt.Errorf("%w: the current version is %d", internal.ErrVersionMismatch, vehicle.Version)
 		return
 	}
 	return
 }
 
+// FindByTransmission is a method that returns a page of vehicles by transmission
+func (s *VehicleDefault) FindByTransmission(transmission string, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	result, err = s.searchOrNotFound(internal.Filter{Op: internal.FilterEq, Field: "transmission", Values: []any{transmission}}, page)
+	return
+}
+
 // CapacityAverageByBrand is a method that returns the average capacity of a vehicle by brand
 func (s *VehicleDefault) CapacityAveragebyBrand(brand string) (average float64, err error) {
 	average, err = s.rp.CapacityAveragebyBrand(brand)
-	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrorNotFound:
-			err = fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
+	return
+}
+
+// FindByDimensions is a method that returns a page of vehicles by ranges of their dimensions
+// the query keys are min_<field> and max_<field> for every field of internal.DimensionFields, all of them optional,
+// both bounds are included and every vehicle is returned when none is set, any other key is an error
+func (s *VehicleDefault) FindByDimensions(query map[string]any, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	// - every key must be a numeric bound of a dimension
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := query[key].(float64); !ok {
+			err = internal.ErrInvalidRange.Errorf(key, "%s is not a number", key)
+			return
 		}
-		return
+		if !isDimensionBound(key) {
+			err = internal.ErrInvalidRange.Errorf(key, "unknown bound %s, expected min_<field> or max_<field> with a field of %s",
+				key, strings.Join(internal.DimensionFields, ", "))
+			return
+		}
+	}
+
+	filter := internal.Filter{Op: internal.FilterAnd, Filters: []internal.Filter{}}
+	for _, field := range internal.DimensionFields {
+		min, hasMin := query["min_"+field].(float64)
+		max, hasMax := query["max_"+field].(float64)
+		switch {
+		case hasMin && hasMax:
+			if min > max {
+				err = internal.ErrInvalidRange.Errorf("min_"+field, "min_%s is greater than max_%s", field, field)
+				return
+			}
+			filter.Filters = append(filter.Filters, internal.Filter{Op: internal.FilterBetween, Field: field, Values: []any{min, max}})
+		case hasMin:
+			filter.Filters = append(filter.Filters, internal.Filter{Op: internal.FilterGte, Field: field, Values: []any{min}})
+		case hasMax:
+			filter.Filters = append(filter.Filters, internal.Filter{Op: internal.FilterLte, Field: field, Values: []any{max}})
+		}
+	}
+	if len(filter.Filters) == 0 {
+		filter = internal.Filter{}
 	}
+	result, err = s.rp.Search(filter, page)
 	return
 }
 
-// FindQuery is a method that returns a map of vehicles by query
-func (s *VehicleDefault) FindQuery(query map[string]any) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle, err = s.rp.FindQuery(query)
-	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrInvalidQuery:
-			err = fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
+// isDimensionBound is a function that returns whether a key is min_<field> or max_<field> for a field of
+// internal.DimensionFields
+func isDimensionBound(key string) bool {
+	for _, field := range internal.DimensionFields {
+		if key == "min_"+field || key == "max_"+field {
+			return true
 		}
-		return
 	}
+	return false
+}
+
+// FilterByWeight is a method that returns a page of vehicles by weight
+// weight_min and weight_max are optional, every vehicle is returned when none is set
+func (s *VehicleDefault) FilterByWeight(query map[string]any, page internal.PageRequest) (result internal.VehiclePage, err error) {
+	filter := internal.Filter{Op: internal.FilterAnd, Filters: []internal.Filter{}}
+	if weightMin, ok := query["weight_min"]; ok {
+		filter.Filters = append(filter.Filters, internal.Filter{Op: internal.FilterGte, Field: "weight", Values: []any{weightMin}})
+	}
+	if weightMax, ok := query["weight_max"]; ok {
+		filter.Filters = append(filter.Filters, internal.Filter{Op: internal.FilterLte, Field: "weight", Values: []any{weightMax}})
+	}
+	if len(filter.Filters) == 0 {
+		filter = internal.Filter{}
+	}
+	result, err = s.rp.Search(filter, page)
 	return
 }
 
-// FilterByWeight is a method that returns a map of vehicles by weight
-func (s *VehicleDefault) FilterByWeight(query map[string]any) (vehicle map[int]internal.Vehicle, err error) {
-	vehicle, err = s.rp.FilterByWeight(query)
+// Stats is a method that returns the table of the groups and metrics of the vehicles that match the filter
+// of the query
+func (s *VehicleDefault) Stats(query internal.StatsQuery) (result internal.StatsResult, err error) {
+	result, err = s.rp.Stats(query)
+	return
+}
+
+// Vocabularies is a method that returns the vocabularies of the text fields of the vehicles
+func (s *VehicleDefault) Vocabularies() (vocabularies internal.Vocabularies) {
+	vocabularies = s.vc
+	return
+}
+
+// Canonicalize is a method that sets the fields of the stored vehicles, including the ones in the trash, to their
+// canonical values and returns how many vehicles were changed
+// the values that are not part of a vocabulary are kept as they are, so it can be run again and only changes
+// what is new, every vehicle is changed in its own transaction, the ones that can not be changed are kept as they
+// are and err joins their errors, the unique keys are never changed, so the uniqueness policy never rejects one
+func (s *VehicleDefault) Canonicalize() (changed int, err error) {
+	vehicles, err := s.rp.FindAll()
 	if err != nil {
-		switch err {
-		//if the error is not found, return an error
-		case internal.ErrInvalidQuery:
-			err = fmt.Errorf("%w: %s", internal.ErrNotFound, err.Error())
-		}
 		return
 	}
+	// the vehicles in the trash are canonicalized too, so they are restored with the canonical values
+	trash, err := s.rp.FindTrash(internal.PageRequest{})
+	if err != nil {
+		return
+	}
+	ids := make([]int, 0, len(vehicles)+len(trash.Vehicles))
+	for id := range vehicles {
+		ids = append(ids, id)
+	}
+	for _, vehicle := range trash.Vehicles {
+		ids = append(ids, vehicle.Id)
+	}
+	sort.Ints(ids)
+	var errs []error
+	for _, id := range ids {
+		var updated bool
+		err := s.transaction(func(tx internal.VehicleTx, audit auditFunc) error {
+			// the vehicle may have been deleted, restored or purged since they were read
+			before, err := tx.GetbyID(id)
+			update := tx.UpdateVehicle
+			if errors.Is(err, internal.ErrNotFound) {
+				before, err = tx.GetTrashed(id)
+				update = tx.UpdateTrashed
+			}
+			if errors.Is(err, internal.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			vehicle := before
+			s.vc.Canonicalize(&vehicle)
+			if vehicle.VehicleAttributes == before.VehicleAttributes {
+				return nil
+			}
+			if err := update(&vehicle); err != nil {
+				return err
+			}
+			updated = true
+			audit(internal.AuditOpUpdate, &before, &vehicle)
+			return nil
+		})
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("vehicle %d: %w", id, err))
+		case updated:
+			changed++
+		}
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+// Revision is a method that returns the current revision of the vehicles
+func (s *VehicleDefault) Revision() (revision internal.VehicleRevision) {
+	revision = s.rp.Revision()
 	return
 }
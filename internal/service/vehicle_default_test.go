@@ -0,0 +1,330 @@
+package service
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"app/internal/repository"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newDimensionsTestService is a function that returns a service over vehicles 1 to 5, vehicle n is n meters high,
+// 2n meters long and 3 meters wide
+func newDimensionsTestService() *VehicleDefault {
+	db := make(map[int]internal.Vehicle)
+	for id := 1; id <= 5; id++ {
+		db[id] = internal.Vehicle{Id: id, VehicleAttributes: internal.VehicleAttributes{
+			Dimensions: internal.Dimensions{Height: float64(id), Length: float64(2 * id), Width: 3},
+		}}
+	}
+	return NewVehicleDefault(repository.NewVehicleMap(db, 5, nil), nil, nil, nil, nil)
+}
+
+// TestVehicleDefault_FindByDimensions checks that every subset of the bounds filters its own dimensions only
+func TestVehicleDefault_FindByDimensions(t *testing.T) {
+	sv := newDimensionsTestService()
+	cases := []struct {
+		name  string
+		query map[string]any
+		ids   []int
+	}{
+		{"none", map[string]any{}, []int{1, 2, 3, 4, 5}},
+		{"min_height", map[string]any{"min_height": 3.0}, []int{3, 4, 5}},
+		{"max_height", map[string]any{"max_height": 2.0}, []int{1, 2}},
+		{"min_length", map[string]any{"min_length": 6.0}, []int{3, 4, 5}},
+		{"max_length", map[string]any{"max_length": 4.0}, []int{1, 2}},
+		{"height_range", map[string]any{"min_height": 2.0, "max_height": 4.0}, []int{2, 3, 4}},
+		{"min_height_max_length", map[string]any{"min_height": 2.0, "max_length": 8.0}, []int{2, 3, 4}},
+		{"width", map[string]any{"min_width": 3.0, "max_width": 3.0}, []int{1, 2, 3, 4, 5}},
+		{"max_width", map[string]any{"max_width": 2.9}, nil},
+		{"min_volume", map[string]any{"min_volume": 54.0}, []int{3, 4, 5}},
+		{"max_footprint", map[string]any{"max_footprint": 12.0}, []int{1, 2}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := sv.FindByDimensions(tc.query, internal.PageRequest{})
+			if err != nil {
+				t.Fatalf("find: %v", err)
+			}
+			if len(result.Vehicles) != len(tc.ids) {
+				t.Fatalf("found %d vehicles, want %v", len(result.Vehicles), tc.ids)
+			}
+			for i, vehicle := range result.Vehicles {
+				if vehicle.Id != tc.ids[i] {
+					t.Fatalf("vehicle %d is %d, want %v", i, vehicle.Id, tc.ids)
+				}
+			}
+		})
+	}
+}
+
+// TestVehicleDefault_FindByDimensionsInvalid checks that the unknown bounds, the non numeric ones and the empty
+// ranges are rejected
+func TestVehicleDefault_FindByDimensionsInvalid(t *testing.T) {
+	sv := newDimensionsTestService()
+	queries := []map[string]any{
+		{"min_foo": 1.0},
+		{"max_weight": 1.0},
+		{"height": 1.0},
+		{"min_height": "1"},
+		{"min_height": 3.0, "max_height": 2.0},
+	}
+	for _, query := range queries {
+		if _, err := sv.FindByDimensions(query, internal.PageRequest{}); !errors.Is(err, internal.ErrInvalidRange) {
+			t.Fatalf("find %v: got %v, want %v", query, err, internal.ErrInvalidRange)
+		}
+	}
+}
+
+// TestVehicleDefault_AuditFailedCommit checks that only the changes that were committed are in the audit trail
+func TestVehicleDefault_AuditFailedCommit(t *testing.T) {
+	jr := repository.NewVehicleJournalMemory()
+	au := repository.NewAuditMap()
+	rp := repository.NewVehicleMapJournal(repository.NewVehicleMap(nil, 0, nil), jr, nil, nil)
+	sv := NewVehicleDefault(rp, au, internal.NewPlateRegistry(), internal.NewVehicleValidator(internal.DefaultValidationRules), internal.DefaultVocabularies)
+
+	vehicle := internal.Vehicle{VehicleAttributes: internal.VehicleAttributes{
+		Brand: "Ford", Model: "Focus", Registration: "AB-123", Color: "Red", FabricationYear: 2015, Capacity: 5,
+		MaxSpeed: 190, FuelType: "gasoline", Transmission: "manual", Weight: 1300,
+	}}
+	if err := sv.Save(&vehicle); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// - the journal fails, so the update is not committed
+	errDisk := errors.New("disk full")
+	jr.Fail(errDisk)
+	updated := vehicle
+	updated.Model = "Fiesta"
+	if err := sv.UpdateVehicle(&updated); !errors.Is(err, errDisk) {
+		t.Fatalf("update: got %v, want %v", err, errDisk)
+	}
+	if err := sv.Delete(vehicle.Id, 0); !errors.Is(err, errDisk) {
+		t.Fatalf("delete: got %v, want %v", err, errDisk)
+	}
+
+	entries, _ := sv.History(vehicle.Id)
+	if len(entries) != 1 || entries[0].Op != internal.AuditOpCreate {
+		t.Fatalf("history %+v, want the create only", entries)
+	}
+	if current, _ := sv.GetByID(vehicle.Id); current.Model != "Focus" || current.Version != 1 {
+		t.Fatalf("vehicle %q version %d, want Focus version 1", current.Model, current.Version)
+	}
+}
+
+// failingAudit is a struct that represents an audit store that can not be appended to
+type failingAudit struct {
+	*repository.AuditMap
+}
+
+func (a failingAudit) Append(entries ...*internal.AuditEntry) error { return errors.New("audit unavailable") }
+
+// TestVehicleDefault_AuditFailedAppend checks that a change that was committed succeeds even if its audit entries can
+// not be appended
+func TestVehicleDefault_AuditFailedAppend(t *testing.T) {
+	rp := repository.NewVehicleMap(nil, 0, nil)
+	sv := NewVehicleDefault(rp, failingAudit{repository.NewAuditMap()}, internal.NewPlateRegistry(), internal.NewVehicleValidator(internal.DefaultValidationRules), internal.DefaultVocabularies)
+
+	vehicle := internal.Vehicle{VehicleAttributes: internal.VehicleAttributes{
+		Brand: "Ford", Model: "Focus", Registration: "AB-123", Color: "Red", FabricationYear: 2015, Capacity: 5,
+		MaxSpeed: 190, FuelType: "gasoline", Transmission: "manual", Weight: 1300,
+	}}
+	if err := sv.Save(&vehicle); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := sv.Delete(vehicle.Id, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := sv.GetByID(vehicle.Id); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("get of the deleted vehicle: got %v, want %v", err, internal.ErrNotFound)
+	}
+}
+
+// TestVehicleDefault_PlateWithoutCountry checks that a new plate without country needs the minimum format while the
+// vehicles loaded with a shorter one can still be updated as long as their plate does not change
+func TestVehicleDefault_PlateWithoutCountry(t *testing.T) {
+	loaded := internal.Vehicle{Id: 1, Version: 1, VehicleAttributes: internal.VehicleAttributes{
+		Brand: "Ford", Model: "Focus", Registration: "0", Color: "Red", FabricationYear: 2015, Capacity: 5,
+		MaxSpeed: 190, FuelType: "gasoline", Transmission: "manual", Weight: 1300,
+	}}
+	rp := repository.NewVehicleMap(map[int]internal.Vehicle{1: loaded}, 1, nil)
+	sv := NewVehicleDefault(rp, repository.NewAuditMap(), internal.NewPlateRegistry(), internal.NewVehicleValidator(internal.DefaultValidationRules), internal.DefaultVocabularies)
+
+	// - a new vehicle
+	for plate, valid := range map[string]bool{"0": false, "A": false, "-1": false, "1-": false, "09": true, "AB-123": true} {
+		vehicle := loaded
+		vehicle.Id, vehicle.Registration = 0, plate
+		if err := sv.Save(&vehicle); (err == nil) != valid {
+			t.Fatalf("save of plate %q: got %v, valid %t", plate, err, valid)
+		}
+	}
+
+	// - the loaded vehicle keeps its plate
+	updated := loaded
+	updated.MaxSpeed = 150
+	if err := sv.UpdateVehicle(&updated); err != nil {
+		t.Fatalf("update keeping the plate: %v", err)
+	}
+	// - or changes it to a valid one
+	updated.Registration = "7"
+	if err := sv.UpdateVehicle(&updated); !errors.Is(err, internal.ErrInvalidRegistration) {
+		t.Fatalf("update to plate 7: got %v, want %v", err, internal.ErrInvalidRegistration)
+	}
+}
+
+// TestVehicleDefault_CanonicalizeShippedData checks that the vehicles of the data file shipped with the application,
+// some of which share a registration, are all canonicalized and are no longer split by their old spellings
+func TestVehicleDefault_CanonicalizeShippedData(t *testing.T) {
+	db, err := loader.NewVehicleJSONFile("../../docs/db/vehicles_100.json").Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	lastId := 0
+	for id := range db {
+		lastId = max(lastId, id)
+	}
+	rp := repository.NewVehicleMap(db, lastId, nil)
+	if len(rp.Duplicates()) == 0 {
+		t.Fatalf("the data file has no duplicated registration, the test no longer checks them")
+	}
+	sv := NewVehicleDefault(rp, repository.NewAuditMap(), internal.NewPlateRegistry(), internal.NewVehicleValidator(internal.DefaultValidationRules), internal.DefaultVocabularies)
+
+	changed, err := sv.Canonicalize()
+	if err != nil {
+		t.Fatalf("canonicalize: %v", err)
+	}
+	if changed == 0 {
+		t.Fatalf("no vehicle was canonicalized")
+	}
+	// - every value is canonical, so nothing changes the second time
+	if changed, err = sv.Canonicalize(); changed != 0 || err != nil {
+		t.Fatalf("canonicalize again: %d changed, %v, want none", changed, err)
+	}
+	all, _ := sv.FindAll()
+	for id, vehicle := range all {
+		canonical := vehicle
+		internal.DefaultVocabularies.Canonicalize(&canonical)
+		if canonical.VehicleAttributes != vehicle.VehicleAttributes {
+			t.Fatalf("vehicle %d is not canonical: %+v", id, vehicle.VehicleAttributes)
+		}
+	}
+	// - the stats have a group per canonical fuel type
+	result, err := sv.Stats(internal.StatsQuery{GroupBy: []string{"fuel_type"}})
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	for _, row := range result.Rows {
+		fuelType, _ := row[0].(string)
+		if canonical, ok := internal.DefaultVocabularies["fuel_type"].Canonical(fuelType); !ok || canonical != fuelType {
+			t.Fatalf("stats group %q is not a canonical fuel type", fuelType)
+		}
+	}
+}
+
+// newTrashTestService is a function that returns a service over vehicle 1 and vehicles 2 and 3 in the trash,
+// deleted 2 days and 1 hour ago, vehicle 2 has a fuel type that is not canonical
+func newTrashTestService() *VehicleDefault {
+	db := make(map[int]internal.Vehicle)
+	for id, plate := range map[int]string{1: "AB-123", 2: "CD-456", 3: "EF-789"} {
+		db[id] = internal.Vehicle{Id: id, Version: 1, VehicleAttributes: internal.VehicleAttributes{
+			Brand: "Ford", Model: "Focus", Registration: plate, Color: "Red", FabricationYear: 2015, Capacity: 5,
+			MaxSpeed: 190, FuelType: "gasoline", Transmission: "manual", Weight: 1300,
+		}}
+	}
+	v2, v3 := db[2], db[3]
+	v2.FuelType, v2.DeletedAt = "Gas", time.Now().Add(-48*time.Hour)
+	v3.DeletedAt = time.Now().Add(-time.Hour)
+	db[2], db[3] = v2, v3
+	rp := repository.NewVehicleMap(db, 3, nil)
+	return NewVehicleDefault(rp, repository.NewAuditMap(), internal.NewPlateRegistry(), internal.NewVehicleValidator(internal.DefaultValidationRules), internal.DefaultVocabularies)
+}
+
+// TestVehicleDefault_Trash checks that the trash is listed, canonicalized, restored, also when the registration was
+// taken since, and purged
+func TestVehicleDefault_Trash(t *testing.T) {
+	sv := newTrashTestService()
+
+	// - list
+	trash, err := sv.FindTrash(internal.PageRequest{})
+	if err != nil || trash.Total != 2 || trash.Vehicles[0].Id != 2 || trash.Vehicles[1].Id != 3 || !trash.Vehicles[0].Deleted() {
+		t.Fatalf("trash %v, %v, want vehicles 2 and 3", trash.Vehicles, err)
+	}
+
+	// - the enum migration canonicalizes the trash, the vehicle stays in it
+	if changed, err := sv.Canonicalize(); err != nil || changed != 1 {
+		t.Fatalf("canonicalized %d vehicles, %v, want 1", changed, err)
+	}
+	trash, _ = sv.FindTrash(internal.PageRequest{})
+	if v2 := trash.Vehicles[0]; trash.Total != 2 || v2.FuelType != "gasoline" || v2.Version != 2 || !v2.Deleted() {
+		t.Fatalf("trashed vehicle 2 is %+v, want it canonical with version 2 in the trash", v2)
+	}
+
+	// - restore
+	restored, err := sv.Restore(2)
+	if err != nil || restored.Deleted() || restored.FuelType != "gasoline" {
+		t.Fatalf("restored %+v, %v, want vehicle 2 canonical and out of the trash", restored, err)
+	}
+	if _, err := sv.GetByID(2); err != nil {
+		t.Fatalf("get of the restored vehicle: %v", err)
+	}
+	if _, err := sv.Restore(1); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("restore of a vehicle not in the trash: got %v, want %v", err, internal.ErrNotFound)
+	}
+	// - a vehicle whose registration was taken since stays in the trash
+	taken := restored
+	taken.Id, taken.Registration = 0, "ef-789"
+	if err := sv.Save(&taken); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	var conflict *internal.VehicleConflictError
+	if _, err := sv.Restore(3); !errors.As(err, &conflict) || conflict.Id != taken.Id {
+		t.Fatalf("restore of a taken registration: got %v, want a conflict with vehicle %d", err, taken.Id)
+	}
+	if trash, _ = sv.FindTrash(internal.PageRequest{}); trash.Total != 1 || trash.Vehicles[0].Id != 3 {
+		t.Fatalf("trash %v, want vehicle 3", trash.Vehicles)
+	}
+
+	// - purge
+	if err := sv.Purge(3); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if err := sv.Purge(3); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("purge of a purged vehicle: got %v, want %v", err, internal.ErrNotFound)
+	}
+	if err := sv.Purge(1); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("purge of a vehicle not in the trash: got %v, want %v", err, internal.ErrNotFound)
+	}
+	if _, err := sv.Restore(3); !errors.Is(err, internal.ErrNotFound) {
+		t.Fatalf("restore of a purged vehicle: got %v, want %v", err, internal.ErrNotFound)
+	}
+	if trash, _ = sv.FindTrash(internal.PageRequest{}); trash.Total != 0 {
+		t.Fatalf("trash %v, want none", trash.Vehicles)
+	}
+	if entries, _ := sv.History(3); len(entries) != 1 || entries[0].Op != internal.AuditOpPurge {
+		t.Fatalf("history of vehicle 3 %+v, want the purge", entries)
+	}
+}
+
+// TestVehicleDefault_PurgeTrash checks that the retention purges only the vehicles deleted before its time
+func TestVehicleDefault_PurgeTrash(t *testing.T) {
+	sv := newTrashTestService()
+
+	if purged, err := sv.PurgeTrash(time.Now().Add(-72 * time.Hour)); err != nil || purged != 0 {
+		t.Fatalf("purged %d, %v, want none", purged, err)
+	}
+	if purged, err := sv.PurgeTrash(time.Now().Add(-24 * time.Hour)); err != nil || purged != 1 {
+		t.Fatalf("purged %d, %v, want vehicle 2", purged, err)
+	}
+	trash, _ := sv.FindTrash(internal.PageRequest{})
+	if trash.Total != 1 || trash.Vehicles[0].Id != 3 {
+		t.Fatalf("trash %v, want vehicle 3", trash.Vehicles)
+	}
+	// - the live vehicles are never purged
+	if purged, err := sv.PurgeTrash(time.Now()); err != nil || purged != 1 {
+		t.Fatalf("purged %d, %v, want vehicle 3", purged, err)
+	}
+	if _, err := sv.GetByID(1); err != nil {
+		t.Fatalf("get of the live vehicle: %v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package internal
 
+import "time"
+
 // Dimensions is a struct that represents a dimension in 3d
 type Dimensions struct {
 	// Height is the height of the dimension
@@ -10,6 +12,16 @@ type Dimensions struct {
 	Width float64
 }
 
+// Volume is a method that returns the volume of the dimension
+func (d Dimensions) Volume() float64 {
+	return d.Height * d.Length * d.Width
+}
+
+// Footprint is a method that returns the area of the dimension on the ground
+func (d Dimensions) Footprint() float64 {
+	return d.Length * d.Width
+}
+
 // VehicleAttributes is a struct that represents the attributes of a vehicle
 type VehicleAttributes struct {
 	// Brand is the brand of the vehicle
@@ -18,6 +30,8 @@ type VehicleAttributes struct {
 	Model string
 	// Registration is the registration of the vehicle
 	Registration string
+	// Country is the ISO 3166-1 alpha-2 code of the country of the registration, empty if it is not known
+	Country string
 	// Color is the color of the vehicle
 	Color string
 	// FabricationYear is the fabrication year of the vehicle
@@ -40,7 +54,18 @@ type VehicleAttributes struct {
 type Vehicle struct {
 	// Id is the unique identifier of the vehicle
 	Id int
+	// Version is the number of times the vehicle was saved or updated, it starts at 1
+	Version int
+	// UpdatedAt is the time the vehicle was last saved or updated, zero if it is not known
+	UpdatedAt time.Time
+	// DeletedAt is the time the vehicle was moved to the trash, zero while it is not deleted
+	DeletedAt time.Time
 
 	// VehicleAttribue is the attributes of a vehicle
 	VehicleAttributes
 }
+
+// Deleted is a method that returns whether the vehicle is in the trash
+func (v Vehicle) Deleted() bool {
+	return !v.DeletedAt.IsZero()
+}
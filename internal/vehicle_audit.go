@@ -0,0 +1,81 @@
+package internal
+
+import "time"
+
+// AuditOp is a type that represents the operation of an audit entry
+type AuditOp string
+
+const (
+	// AuditOpCreate is the operation of a vehicle that was saved
+	AuditOpCreate AuditOp = "create"
+	// AuditOpUpdate is the operation of a vehicle that was updated or patched
+	AuditOpUpdate AuditOp = "update"
+	// AuditOpDelete is the operation of a vehicle that was moved to the trash
+	AuditOpDelete AuditOp = "delete"
+	// AuditOpRestore is the operation of a vehicle that was restored from the trash
+	AuditOpRestore AuditOp = "restore"
+	// AuditOpPurge is the operation of a vehicle that was removed from the trash for good
+	AuditOpPurge AuditOp = "purge"
+)
+
+// AuditChange is a struct that represents the change of a field of a vehicle
+type AuditChange struct {
+	// Field is the name of the field, one of VehicleFields
+	Field string
+	// Before is the value before the change, nil when the vehicle was created
+	Before any
+	// After is the value after the change, nil when the vehicle was deleted
+	After any
+}
+
+// AuditEntry is a struct that represents a change of a vehicle made through the service
+type AuditEntry struct {
+	// Seq is the position of the entry in the audit trail, it is assigned by the store
+	Seq int
+	// Time is the time of the change
+	Time time.Time
+	// Actor is who made the change
+	Actor string
+	// Op is the operation of the change
+	Op AuditOp
+	// VehicleId is the id of the vehicle that changed
+	VehicleId int
+	// Version is the version of the vehicle after the change, or the last one when it was deleted
+	Version int
+	// Changes are the fields that changed, in the order of VehicleFieldNames
+	Changes []AuditChange
+}
+
+// AuditStore is an interface that represents the storage of the audit trail
+type AuditStore interface {
+	// Append is a method that adds entries at the end of the audit trail, their Seq is set
+	Append(entries ...*AuditEntry) (err error)
+	// FindByVehicle is a method that returns the entries of a vehicle, oldest first
+	FindByVehicle(id int) (entries []AuditEntry, err error)
+	// FindSince is a method that returns the entries made at or after a time, oldest first
+	FindSince(since time.Time) (entries []AuditEntry, err error)
+}
+
+// DiffVehicles is a function that returns the changes between two states of a vehicle
+// a nil before means the vehicle was created and a nil after that it was deleted, the id and the derived
+// fields are not compared
+func DiffVehicles(before, after *Vehicle) (changes []AuditChange) {
+	for _, name := range VehicleFieldNames() {
+		field := VehicleFields[name]
+		if name == "id" || field.Derived {
+			continue
+		}
+		var change = AuditChange{Field: name}
+		if before != nil {
+			change.Before = field.Value(*before)
+		}
+		if after != nil {
+			change.After = field.Value(*after)
+		}
+		if before != nil && after != nil && compareValues(change.Before, change.After) == 0 {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return
+}
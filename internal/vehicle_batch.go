@@ -0,0 +1,22 @@
+package internal
+
+import "fmt"
+
+// VehicleBatchError is a struct that represents the error of a vehicle of a batch
+// a batch is saved all or nothing, so the error of one vehicle means that none of them was saved
+type VehicleBatchError struct {
+	// Index is the position of the vehicle in the batch
+	Index int
+	// Err is the cause of the error
+	Err error
+}
+
+// Error is a method that returns the description of the error
+func (e *VehicleBatchError) Error() string {
+	return fmt.Sprintf("vehicle %d: %s", e.Index, e.Err.Error())
+}
+
+// Unwrap is a method that returns the cause of the error
+func (e *VehicleBatchError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,129 @@
+package internal
+
+import "strings"
+
+// NewVocabulary is a function that returns a new instance of Vocabulary
+// aliases maps other spellings to one of the values, the values and the aliases are matched ignoring case and
+// accents, see FoldText
+func NewVocabulary(values []string, aliases map[string]string) *Vocabulary {
+	v := &Vocabulary{values: values, aliases: aliases, index: make(map[string]string, len(values)+len(aliases))}
+	for alias, value := range aliases {
+		v.index[FoldText(alias)] = value
+	}
+	// a value always stands for itself, even if it is the alias of another one
+	for _, value := range values {
+		v.index[FoldText(value)] = value
+	}
+	return v
+}
+
+// Vocabulary is a struct that represents the values a text field of a vehicle can have
+type Vocabulary struct {
+	// values are the canonical values, in the order they are listed
+	values []string
+	// aliases are the canonical values by their other spellings
+	aliases map[string]string
+	// index are the canonical values by the folded form of the values and the aliases
+	index map[string]string
+}
+
+// Values is a method that returns the canonical values
+func (v *Vocabulary) Values() []string {
+	return v.values
+}
+
+// Aliases is a method that returns the canonical values by their other spellings
+func (v *Vocabulary) Aliases() map[string]string {
+	return v.aliases
+}
+
+// Canonical is a method that returns the canonical value of a value or one of its aliases
+// ok is false when the value is not part of the vocabulary
+func (v *Vocabulary) Canonical(value string) (canonical string, ok bool) {
+	canonical, ok = v.index[FoldText(strings.TrimSpace(value))]
+	return
+}
+
+// Vocabularies is a type that represents the vocabularies of the text fields of a vehicle by field name,
+// one of VehicleVocabularyFields
+type Vocabularies map[string]*Vocabulary
+
+// VehicleVocabularyFields are the names of the fields that can have a vocabulary
+var VehicleVocabularyFields = []string{"fuel_type", "transmission", "color"}
+
+// vocabularyField is a function that returns the field of a vehicle with a vocabulary, nil for other fields
+func vocabularyField(v *Vehicle, name string) *string {
+	switch name {
+	case "fuel_type":
+		return &v.FuelType
+	case "transmission":
+		return &v.Transmission
+	case "color":
+		return &v.Color
+	}
+	return nil
+}
+
+// Canonicalize is a method that sets the fields of a vehicle to their canonical values
+// empty fields are left empty, the violations by field are the values that are not part of their vocabulary,
+// nil when there is none
+func (vs Vocabularies) Canonicalize(v *Vehicle) (violations map[string][]string) {
+	for _, name := range VehicleVocabularyFields {
+		vocabulary, ok := vs[name]
+		field := vocabularyField(v, name)
+		if !ok || field == nil || *field == "" {
+			continue
+		}
+		canonical, ok := vocabulary.Canonical(*field)
+		if !ok {
+			if violations == nil {
+				violations = make(map[string][]string)
+			}
+			violations[name] = append(violations[name], "must be one of "+strings.Join(vocabulary.Values(), ", "))
+			continue
+		}
+		*field = canonical
+	}
+	return
+}
+
+// DefaultVocabularies are the vocabularies of the fuel type, the transmission and the color of the vehicles
+var DefaultVocabularies = Vocabularies{
+	"fuel_type": NewVocabulary(
+		[]string{"gasoline", "diesel", "biodiesel", "electric", "hybrid"},
+		map[string]string{
+			"gas":            "gasoline",
+			"petrol":         "gasoline",
+			"bio-diesel":     "biodiesel",
+			"biofuel":        "biodiesel",
+			"ev":             "electric",
+			"battery":        "electric",
+			"plug-in hybrid": "hybrid",
+		},
+	),
+	"transmission": NewVocabulary(
+		[]string{"manual", "automatic", "semi-automatic"},
+		map[string]string{
+			"stick":            "manual",
+			"standard":         "manual",
+			"auto":             "automatic",
+			"semi-auto":        "semi-automatic",
+			"semiautomatic":    "semi-automatic",
+			"semi automatic":   "semi-automatic",
+			"automated manual": "semi-automatic",
+		},
+	),
+	"color": NewVocabulary(
+		[]string{
+			"Aquamarine", "Beige", "Black", "Blue", "Brown", "Crimson", "Fuchsia", "Gold", "Goldenrod", "Gray",
+			"Green", "Indigo", "Khaki", "Maroon", "Mauve", "Orange", "Pink", "Puce", "Purple", "Red", "Silver",
+			"Teal", "Turquoise", "Violet", "White", "Yellow",
+		},
+		map[string]string{
+			"Fuscia":  "Fuchsia",
+			"Fuschia": "Fuchsia",
+			"Grey":    "Gray",
+			"Mauv":    "Mauve",
+		},
+	),
+}
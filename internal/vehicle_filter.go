@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidFilter is an error that occurs when a filter is not well formed
+	ErrInvalidFilter = NewError(KindInvalid, "invalid_filter", "invalid filter")
+)
+
+// FilterOp is a type that represents the operator of a filter
+type FilterOp string
+
+const (
+	// FilterAnd matches when every child filter matches
+	FilterAnd FilterOp = "and"
+	// FilterOr matches when any child filter matches
+	FilterOr FilterOp = "or"
+	// FilterNot matches when its only child filter does not match
+	FilterNot FilterOp = "not"
+	// FilterEq matches when the field is equal to the value
+	FilterEq FilterOp = "eq"
+	// FilterNe matches when the field is not equal to the value
+	FilterNe FilterOp = "ne"
+	// FilterLt matches when the field is less than the value
+	FilterLt FilterOp = "lt"
+	// FilterLte matches when the field is less than or equal to the value
+	FilterLte FilterOp = "lte"
+	// FilterGt matches when the field is greater than the value
+	FilterGt FilterOp = "gt"
+	// FilterGte matches when the field is greater than or equal to the value
+	FilterGte FilterOp = "gte"
+	// FilterIn matches when the field is equal to any of the values
+	FilterIn FilterOp = "in"
+	// FilterBetween matches when the field is between the two values, both included
+	FilterBetween FilterOp = "between"
+	// FilterPrefix matches when the field starts with the value
+	FilterPrefix FilterOp = "prefix"
+	// FilterContains matches when the field contains the value
+	FilterContains FilterOp = "contains"
+)
+
+// FieldKind is a type that represents the kind of value of a field of a vehicle
+type FieldKind int
+
+const (
+	// FieldString is the kind of the text fields
+	FieldString FieldKind = iota
+	// FieldNumber is the kind of the numeric fields, their values are float64
+	FieldNumber
+)
+
+// VehicleField is a struct that represents a field of a vehicle that can be queried
+type VehicleField struct {
+	// Kind is the kind of value of the field
+	Kind FieldKind
+	// Value is a function that returns the value of the field for a vehicle
+	Value func(v Vehicle) any
+	// Derived is true for the fields computed from other fields
+	Derived bool
+	// Folded is true for the text fields compared ignoring case and accents, see FoldText
+	Folded bool
+}
+
+// Normalize is a method that returns the form of a value of the field used to compare it,
+// the value folded with FoldText for the folded fields and the value itself otherwise
+func (f VehicleField) Normalize(value any) any {
+	if s, ok := value.(string); ok && f.Folded {
+		return FoldText(s)
+	}
+	return value
+}
+
+// VehicleFields is a map of the fields of a vehicle that can be queried by their JSON name
+var VehicleFields = map[string]VehicleField{
+	"id":           {Kind: FieldNumber, Value: func(v Vehicle) any { return float64(v.Id) }},
+	"brand":        {Kind: FieldString, Value: func(v Vehicle) any { return v.Brand }, Folded: true},
+	"model":        {Kind: FieldString, Value: func(v Vehicle) any { return v.Model }, Folded: true},
+	"registration": {Kind: FieldString, Value: func(v Vehicle) any { return v.Registration }},
+	"country":      {Kind: FieldString, Value: func(v Vehicle) any { return v.Country }},
+	"color":        {Kind: FieldString, Value: func(v Vehicle) any { return v.Color }, Folded: true},
+	"year":         {Kind: FieldNumber, Value: func(v Vehicle) any { return float64(v.FabricationYear) }},
+	"passengers":   {Kind: FieldNumber, Value: func(v Vehicle) any { return float64(v.Capacity) }},
+	"max_speed":    {Kind: FieldNumber, Value: func(v Vehicle) any { return v.MaxSpeed }},
+	"fuel_type":    {Kind: FieldString, Value: func(v Vehicle) any { return v.FuelType }, Folded: true},
+	"transmission": {Kind: FieldString, Value: func(v Vehicle) any { return v.Transmission }, Folded: true},
+	"weight":       {Kind: FieldNumber, Value: func(v Vehicle) any { return v.Weight }},
+	"height":       {Kind: FieldNumber, Value: func(v Vehicle) any { return v.Height }},
+	"length":       {Kind: FieldNumber, Value: func(v Vehicle) any { return v.Length }},
+	"width":        {Kind: FieldNumber, Value: func(v Vehicle) any { return v.Width }},
+	// derived fields
+	"volume":    {Kind: FieldNumber, Value: func(v Vehicle) any { return v.Volume() }, Derived: true},
+	"footprint": {Kind: FieldNumber, Value: func(v Vehicle) any { return v.Footprint() }, Derived: true},
+}
+
+// DimensionFields are the names of the fields that describe the size of a vehicle
+var DimensionFields = []string{"height", "length", "width", "volume", "footprint"}
+
+// VehicleFieldNames is a function that returns the names of the fields of a vehicle that can be queried, sorted
+func VehicleFieldNames() (names []string) {
+	for name := range VehicleFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Filter is a struct that represents an expression tree of predicates over the fields of a vehicle
+// the zero value matches every vehicle
+type Filter struct {
+	// Op is the operator of the filter
+	Op FilterOp
+	// Field is the name of the field compared by a predicate, one of VehicleFields, the values of the folded
+	// fields are compared ignoring case and accents
+	Field string
+	// Values are the operands of a predicate, strings for text fields and finite float64 for numeric fields
+	Values []any
+	// Filters are the children of and, or and not
+	Filters []Filter
+}
+
+// Validate is a method that checks that the filter is well formed
+func (f Filter) Validate() (err error) {
+	switch f.Op {
+	case "":
+		return
+	case FilterAnd, FilterOr:
+		if len(f.Filters) == 0 {
+			return fmt.Errorf("%w: %s requires at least one filter", ErrInvalidFilter, f.Op)
+		}
+	case FilterNot:
+		if len(f.Filters) != 1 {
+			return fmt.Errorf("%w: not requires exactly one filter", ErrInvalidFilter)
+		}
+	default:
+		return f.validatePredicate()
+	}
+	for _, child := range f.Filters {
+		if err = child.Validate(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// validatePredicate is a method that checks the field and the values of a predicate
+func (f Filter) validatePredicate() (err error) {
+	field, ok := VehicleFields[f.Field]
+	if !ok {
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, f.Field)
+	}
+
+	// arity
+	switch f.Op {
+	case FilterEq, FilterNe, FilterLt, FilterLte, FilterGt, FilterGte, FilterPrefix, FilterContains:
+		if len(f.Values) != 1 {
+			return fmt.Errorf("%w: %s requires exactly one value", ErrInvalidFilter, f.Op)
+		}
+	case FilterIn:
+		if len(f.Values) == 0 {
+			return fmt.Errorf("%w: in requires at least one value", ErrInvalidFilter)
+		}
+	case FilterBetween:
+		if len(f.Values) != 2 {
+			return fmt.Errorf("%w: between requires exactly two values", ErrInvalidFilter)
+		}
+	default:
+		return fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, f.Op)
+	}
+
+	// text operators
+	if (f.Op == FilterPrefix || f.Op == FilterContains) && field.Kind != FieldString {
+		return fmt.Errorf("%w: %s requires a text field, %q is numeric", ErrInvalidFilter, f.Op, f.Field)
+	}
+
+	// values must be of the kind of the field
+	for _, value := range f.Values {
+		switch value := value.(type) {
+		case string:
+			if field.Kind != FieldString {
+				return fmt.Errorf("%w: field %q requires numeric values", ErrInvalidFilter, f.Field)
+			}
+		case float64:
+			if field.Kind != FieldNumber {
+				return fmt.Errorf("%w: field %q requires text values", ErrInvalidFilter, f.Field)
+			}
+			// NaN is not ordered with any number, the indexes and the scans would not agree on its matches
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				return fmt.Errorf("%w: field %q requires finite values, found %v", ErrInvalidFilter, f.Field, value)
+			}
+		default:
+			return fmt.Errorf("%w: unsupported value %v", ErrInvalidFilter, value)
+		}
+	}
+	return
+}
+
+// Match is a method that returns whether the vehicle matches the filter, the filter must be valid
+func (f Filter) Match(v Vehicle) bool {
+	switch f.Op {
+	case "":
+		return true
+	case FilterAnd:
+		for _, child := range f.Filters {
+			if !child.Match(v) {
+				return false
+			}
+		}
+		return true
+	case FilterOr:
+		for _, child := range f.Filters {
+			if child.Match(v) {
+				return true
+			}
+		}
+		return false
+	case FilterNot:
+		return !f.Filters[0].Match(v)
+	}
+
+	// the value and the operands are compared in their normalized form
+	field := VehicleFields[f.Field]
+	value := field.Normalize(field.Value(v))
+	operand := func(i int) any { return field.Normalize(f.Values[i]) }
+	switch f.Op {
+	case FilterEq:
+		return compareValues(value, operand(0)) == 0
+	case FilterNe:
+		return compareValues(value, operand(0)) != 0
+	case FilterLt:
+		return compareValues(value, operand(0)) < 0
+	case FilterLte:
+		return compareValues(value, operand(0)) <= 0
+	case FilterGt:
+		return compareValues(value, operand(0)) > 0
+	case FilterGte:
+		return compareValues(value, operand(0)) >= 0
+	case FilterIn:
+		for i := range f.Values {
+			if compareValues(value, operand(i)) == 0 {
+				return true
+			}
+		}
+		return false
+	case FilterBetween:
+		return compareValues(value, operand(0)) >= 0 && compareValues(value, operand(1)) <= 0
+	case FilterPrefix:
+		return strings.HasPrefix(value.(string), operand(0).(string))
+	case FilterContains:
+		return strings.Contains(value.(string), operand(0).(string))
+	}
+	return false
+}
+
+// compareValues is a function that compares two values of the same kind
+// it returns a negative number when a is less than b, zero when they are equal and a positive number otherwise
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
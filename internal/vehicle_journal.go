@@ -0,0 +1,43 @@
+package internal
+
+// VehicleOp is a type that represents an operation over a vehicle
+type VehicleOp string
+
+const (
+	// VehicleOpCreate is the operation that creates a vehicle
+	VehicleOpCreate VehicleOp = "create"
+	// VehicleOpUpdate is the operation that updates a vehicle
+	VehicleOpUpdate VehicleOp = "update"
+	// VehicleOpDelete is the operation that moves a vehicle to the trash
+	// records written before the trash existed have no deletion time and remove the vehicle instead
+	VehicleOpDelete VehicleOp = "delete"
+	// VehicleOpPurge is the operation that removes a vehicle for good, for purges only the id is set
+	VehicleOpPurge VehicleOp = "purge"
+)
+
+// VehicleRecord is a struct that represents a change over a vehicle
+type VehicleRecord struct {
+	// Op is the operation applied
+	Op VehicleOp
+	// Vehicle is the vehicle after the operation
+	Vehicle Vehicle
+}
+
+// VehicleJournal is an interface that represents an append-only log of changes over vehicles
+type VehicleJournal interface {
+	// Append is a method that durably appends records to the log
+	Append(records ...VehicleRecord) (err error)
+	// Replay is a method that calls fn for every record in the log, in order
+	Replay(fn func(record VehicleRecord)) (err error)
+	// Reset is a method that discards every record in the log
+	Reset() (err error)
+}
+
+// VehicleHistory is an interface that represents the versions of the vehicles over time, including the purged ones
+// it is kept apart from the journal, which is emptied once its changes are in a snapshot
+type VehicleHistory interface {
+	// Replay is a method that calls fn for every record in the history, in order
+	Replay(fn func(record VehicleRecord)) (err error)
+	// Rewrite is a method that replaces every record in the history at once
+	Rewrite(records []VehicleRecord) (err error)
+}
@@ -4,4 +4,10 @@ package internal
 type VehicleLoader interface {
 	// Load is a method that loads the vehicles
 	Load() (v map[int]Vehicle, err error)
-}
\ No newline at end of file
+}
+
+// VehicleWriter is an interface that represents the writer for vehicles
+type VehicleWriter interface {
+	// Write is a method that writes the whole collection of vehicles
+	Write(v map[int]Vehicle) (err error)
+}
@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidPage is an error that occurs when the sort, the window or the cursor of a page is not valid
+	ErrInvalidPage = NewError(KindInvalid, "invalid_page", "invalid page")
+)
+
+// SortKey is a struct that represents a field used to order vehicles
+type SortKey struct {
+	// Field is the name of the field, one of VehicleFields
+	Field string
+	// Desc orders from the greatest to the lowest value
+	Desc bool
+}
+
+// PageRequest is a struct that represents the ordering and the window of a list of vehicles
+// vehicles are always ordered by id after the sort keys, so the order is stable between requests
+type PageRequest struct {
+	// Sort are the keys used to order the vehicles, by id when empty, the folded fields are ordered ignoring case
+	// and accents
+	Sort []SortKey
+	// Limit is the maximum number of vehicles of the page, zero means no limit
+	Limit int
+	// Offset is the number of vehicles skipped, after the cursor if one is set
+	Offset int
+	// Cursor is the NextCursor of a previous page with the same sort
+	Cursor string
+}
+
+// VehiclePage is a struct that represents a page of vehicles
+type VehiclePage struct {
+	// Vehicles are the vehicles of the page, in order
+	Vehicles []Vehicle
+	// Total is the number of vehicles of the list, in every page
+	Total int
+	// NextCursor points to the page after this one, empty on the last page
+	NextCursor string
+}
+
+// ParseSort is a function that parses a comma separated list of fields, a field prefixed by - is ordered descending
+func ParseSort(s string) (keys []SortKey, err error) {
+	if s == "" {
+		return
+	}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		key := SortKey{Field: strings.TrimPrefix(name, "-"), Desc: strings.HasPrefix(name, "-")}
+		if _, ok := VehicleFields[key.Field]; !ok {
+			return nil, ErrInvalidPage.Errorf("sort", "unknown sort field %q", key.Field)
+		}
+		keys = append(keys, key)
+	}
+	return
+}
+
+// Apply is a method that orders the vehicles and returns the page requested
+// the vehicles slice is sorted in place
+func (p PageRequest) Apply(vehicles []Vehicle) (page VehiclePage, err error) {
+	if p.Limit < 0 || p.Offset < 0 {
+		err = ErrInvalidPage.Errorf("", "limit and offset can not be negative")
+		return
+	}
+	keys, err := p.keys()
+	if err != nil {
+		return
+	}
+
+	// order, the sort values are read once per vehicle
+	values := make([][]any, len(vehicles))
+	for i, v := range vehicles {
+		values[i] = sortValues(v, keys)
+	}
+	sort.Sort(vehicleSorter{vehicles: vehicles, values: values, keys: keys})
+	page.Total = len(vehicles)
+
+	// window
+	start := 0
+	if p.Cursor != "" {
+		after, err := decodeCursor(p.Cursor, keys)
+		if err != nil {
+			return page, err
+		}
+		start = sort.Search(len(vehicles), func(i int) bool {
+			return compareSortValues(values[i], after, keys) > 0
+		})
+	}
+	start += p.Offset
+	if start > len(vehicles) {
+		start = len(vehicles)
+	}
+	end := len(vehicles)
+	if p.Limit > 0 && start+p.Limit < end {
+		end = start + p.Limit
+	}
+	page.Vehicles = vehicles[start:end]
+
+	// the cursor points after the last vehicle of the page
+	if end < len(vehicles) && end > start {
+		page.NextCursor = encodeCursor(values[end-1], keys)
+	}
+	return
+}
+
+// keys is a method that returns the validated sort keys followed by the id
+func (p PageRequest) keys() (keys []SortKey, err error) {
+	for _, key := range p.Sort {
+		if _, ok := VehicleFields[key.Field]; !ok {
+			return nil, ErrInvalidPage.Errorf("sort", "unknown sort field %q", key.Field)
+		}
+		keys = append(keys, key)
+		// the id is unique, keys after it do not change the order
+		if key.Field == "id" {
+			return
+		}
+	}
+	keys = append(keys, SortKey{Field: "id"})
+	return
+}
+
+// vehicleSorter is a struct that sorts vehicles together with their sort values
+type vehicleSorter struct {
+	vehicles []Vehicle
+	values   [][]any
+	keys     []SortKey
+}
+
+func (s vehicleSorter) Len() int { return len(s.vehicles) }
+
+func (s vehicleSorter) Less(i, j int) bool {
+	return compareSortValues(s.values[i], s.values[j], s.keys) < 0
+}
+
+func (s vehicleSorter) Swap(i, j int) {
+	s.vehicles[i], s.vehicles[j] = s.vehicles[j], s.vehicles[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
+
+// sortValues is a function that returns the values of the sort keys of a vehicle in their normalized form,
+// so the folded fields are ordered ignoring case and accents and the id breaks the ties
+func sortValues(v Vehicle, keys []SortKey) []any {
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		field := VehicleFields[key.Field]
+		values[i] = field.Normalize(field.Value(v))
+	}
+	return values
+}
+
+// compareSortValues is a function that compares the sort values of two vehicles
+func compareSortValues(a, b []any, keys []SortKey) int {
+	for i, key := range keys {
+		c := compareValues(a[i], b[i])
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// cursorJSON is a struct that represents the position encoded in a cursor
+type cursorJSON struct {
+	// Sort is the sort the cursor was created for
+	Sort string `json:"s"`
+	// Values are the sort values of the last vehicle of the page
+	Values []any `json:"v"`
+}
+
+// sortString is a function that returns the sort keys in the format of ParseSort
+func sortString(keys []SortKey) string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.Field
+		if key.Desc {
+			names[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// encodeCursor is a function that encodes the position after the sort values in an opaque cursor
+func encodeCursor(values []any, keys []SortKey) string {
+	b, _ := json.Marshal(cursorJSON{Sort: sortString(keys), Values: values})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor is a function that decodes a cursor created for the same sort keys
+func decodeCursor(cursor string, keys []SortKey) (values []any, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidPage.Errorf("cursor", "malformed cursor")
+	}
+	var c cursorJSON
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidPage.Errorf("cursor", "malformed cursor")
+	}
+	if c.Sort != sortString(keys) {
+		return nil, ErrInvalidPage.Errorf("cursor", "the cursor was created for another sort")
+	}
+	if len(c.Values) != len(keys) {
+		return nil, ErrInvalidPage.Errorf("cursor", "malformed cursor")
+	}
+	// values must be of the kind of their field
+	for i, key := range keys {
+		switch c.Values[i].(type) {
+		case string:
+			if VehicleFields[key.Field].Kind != FieldString {
+				return nil, ErrInvalidPage.Errorf("cursor", "malformed cursor")
+			}
+		case float64:
+			if VehicleFields[key.Field].Kind != FieldNumber {
+				return nil, ErrInvalidPage.Errorf("cursor", "malformed cursor")
+			}
+		default:
+			return nil, ErrInvalidPage.Errorf("cursor", "malformed cursor")
+		}
+	}
+	values = c.Values
+	return
+}
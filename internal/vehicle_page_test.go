@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// newPageTestVehicles is a function that returns vehicles whose brands differ only in case and accents
+func newPageTestVehicles() []Vehicle {
+	brands := []string{"citroen", "Citroën", "BMW", "CITROEN", "audi", "Zastava"}
+	vehicles := make([]Vehicle, len(brands))
+	for i, brand := range brands {
+		vehicles[i] = Vehicle{Id: i + 1, VehicleAttributes: VehicleAttributes{Brand: brand, FabricationYear: 2000 + i%3}}
+	}
+	return vehicles
+}
+
+// pageTestIds is a function that returns the ids of the vehicles of a page, in order
+func pageTestIds(vehicles []Vehicle) (ids []int) {
+	for _, v := range vehicles {
+		ids = append(ids, v.Id)
+	}
+	return
+}
+
+// TestPageRequest_Sort checks that the vehicles are ordered by the sort keys ignoring case and accents, with the id
+// breaking the ties
+func TestPageRequest_Sort(t *testing.T) {
+	cases := []struct {
+		sort string
+		ids  []int
+	}{
+		{sort: "", ids: []int{1, 2, 3, 4, 5, 6}},
+		{sort: "brand", ids: []int{5, 3, 1, 2, 4, 6}},
+		{sort: "-brand", ids: []int{6, 1, 2, 4, 3, 5}},
+		{sort: "-id", ids: []int{6, 5, 4, 3, 2, 1}},
+		{sort: "year,brand", ids: []int{1, 4, 5, 2, 3, 6}},
+		{sort: "-year,-id", ids: []int{6, 3, 5, 2, 4, 1}},
+		// - the keys after the id do not change the order
+		{sort: "id,brand", ids: []int{1, 2, 3, 4, 5, 6}},
+	}
+	for _, c := range cases {
+		t.Run(c.sort, func(t *testing.T) {
+			keys, err := ParseSort(c.sort)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			page, err := PageRequest{Sort: keys}.Apply(newPageTestVehicles())
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if got := pageTestIds(page.Vehicles); !reflect.DeepEqual(got, c.ids) {
+				t.Fatalf("ids %v, want %v", got, c.ids)
+			}
+			if page.Total != 6 || page.NextCursor != "" {
+				t.Fatalf("total %d and cursor %q, want 6 and no cursor", page.Total, page.NextCursor)
+			}
+		})
+	}
+}
+
+// TestPageRequest_Window checks the vehicles, the total and the cursor of the pages selected by limit and offset
+func TestPageRequest_Window(t *testing.T) {
+	cases := []struct {
+		name   string
+		limit  int
+		offset int
+		ids    []int
+		next   bool
+	}{
+		{name: "no limit", ids: []int{5, 3, 1, 2, 4, 6}},
+		{name: "first page", limit: 2, ids: []int{5, 3}, next: true},
+		{name: "middle page", limit: 2, offset: 2, ids: []int{1, 2}, next: true},
+		{name: "last page", limit: 2, offset: 4, ids: []int{4, 6}},
+		{name: "limit past the end", limit: 10, offset: 3, ids: []int{2, 4, 6}},
+		{name: "offset past the end", limit: 2, offset: 10, ids: []int{}},
+	}
+	keys, _ := ParseSort("brand")
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			page, err := PageRequest{Sort: keys, Limit: c.limit, Offset: c.offset}.Apply(newPageTestVehicles())
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if got := pageTestIds(page.Vehicles); len(got) != len(c.ids) || len(got) > 0 && !reflect.DeepEqual(got, c.ids) {
+				t.Fatalf("ids %v, want %v", got, c.ids)
+			}
+			if page.Total != 6 || (page.NextCursor != "") != c.next {
+				t.Fatalf("total %d and cursor %q, want 6 and a cursor %t", page.Total, page.NextCursor, c.next)
+			}
+		})
+	}
+}
+
+// TestPageRequest_Cursor checks that following the cursors walks every vehicle once and in order, also when the
+// vehicles change between the pages
+func TestPageRequest_Cursor(t *testing.T) {
+	for _, sort := range []string{"", "brand", "-brand", "year,-brand", "-year,id"} {
+		t.Run(sort, func(t *testing.T) {
+			keys, _ := ParseSort(sort)
+			all, _ := PageRequest{Sort: keys}.Apply(newPageTestVehicles())
+			want := pageTestIds(all.Vehicles)
+
+			var got []int
+			request := PageRequest{Sort: keys, Limit: 2}
+			for pages := 0; ; pages++ {
+				if pages > 6 {
+					t.Fatalf("the cursors do not end: ids %v", got)
+				}
+				page, err := request.Apply(newPageTestVehicles())
+				if err != nil {
+					t.Fatalf("apply: %v", err)
+				}
+				got = append(got, pageTestIds(page.Vehicles)...)
+				if page.NextCursor == "" {
+					break
+				}
+				request.Cursor = page.NextCursor
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("ids %v, want %v", got, want)
+			}
+		})
+	}
+
+	// - the offset is counted after the cursor
+	keys, _ := ParseSort("brand")
+	first, _ := PageRequest{Sort: keys, Limit: 2}.Apply(newPageTestVehicles())
+	page, err := PageRequest{Sort: keys, Limit: 2, Offset: 1, Cursor: first.NextCursor}.Apply(newPageTestVehicles())
+	if got := pageTestIds(page.Vehicles); err != nil || !reflect.DeepEqual(got, []int{2, 4}) {
+		t.Fatalf("ids %v, %v after the cursor and offset 1, want [2 4]", got, err)
+	}
+	// - the next page starts after the position of the cursor, even when its last vehicle is gone
+	vehicles := newPageTestVehicles()
+	vehicles = append(vehicles[:2], vehicles[3:]...)
+	page, err = PageRequest{Sort: keys, Limit: 2, Cursor: first.NextCursor}.Apply(vehicles)
+	if got := pageTestIds(page.Vehicles); err != nil || !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("ids %v, %v after the cursor once vehicle 3 is gone, want [1 2]", got, err)
+	}
+}
+
+// TestPageRequest_Invalid checks that the invalid pages are rejected with ErrInvalidPage
+func TestPageRequest_Invalid(t *testing.T) {
+	cursor := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	brand, _ := ParseSort("brand")
+	cases := []struct {
+		name    string
+		request PageRequest
+	}{
+		{name: "negative limit", request: PageRequest{Limit: -1}},
+		{name: "negative offset", request: PageRequest{Offset: -1}},
+		{name: "unknown sort field", request: PageRequest{Sort: []SortKey{{Field: "price"}}}},
+		{name: "cursor not base64", request: PageRequest{Sort: brand, Cursor: "%%%"}},
+		{name: "cursor not json", request: PageRequest{Sort: brand, Cursor: cursor("brand")}},
+		{name: "cursor of another sort", request: PageRequest{Sort: brand, Cursor: cursor(`{"s":"-brand,id","v":["bmw",3]}`)}},
+		{name: "cursor with missing values", request: PageRequest{Sort: brand, Cursor: cursor(`{"s":"brand,id","v":["bmw"]}`)}},
+		{name: "cursor with values of another kind", request: PageRequest{Sort: brand, Cursor: cursor(`{"s":"brand,id","v":[3,"bmw"]}`)}},
+		{name: "cursor with null values", request: PageRequest{Sort: brand, Cursor: cursor(`{"s":"brand,id","v":[null,3]}`)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := c.request.Apply(newPageTestVehicles()); !errors.Is(err, ErrInvalidPage) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidPage)
+			}
+		})
+	}
+	if _, err := ParseSort("brand,-price"); !errors.Is(err, ErrInvalidPage) {
+		t.Fatalf("parse of an unknown field: got %v, want %v", err, ErrInvalidPage)
+	}
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrInvalidRegistration is an error that occurs when a registration plate does not have a valid format
+	ErrInvalidRegistration = NewError(KindInvalid, "invalid_registration", "invalid registration")
+)
+
+// PlateError is an error that occurs when a registration plate breaks a rule, it wraps ErrInvalidRegistration
+type PlateError struct {
+	// Country is the country the plate was checked for, empty for the rules of every country
+	Country string
+	// Plate is the registration plate
+	Plate string
+	// Rule is the name of the rule that failed
+	Rule string
+	// Detail describes what the rule expects
+	Detail string
+}
+
+// Error is a method that returns the error message
+func (e *PlateError) Error() string {
+	if e.Country == "" {
+		return fmt.Sprintf("%s %q: rule %s: %s", ErrInvalidRegistration, e.Plate, e.Rule, e.Detail)
+	}
+	return fmt.Sprintf("%s %q for %s: rule %s: %s", ErrInvalidRegistration, e.Plate, e.Country, e.Rule, e.Detail)
+}
+
+// Unwrap is a method that returns ErrInvalidRegistration
+func (e *PlateError) Unwrap() error {
+	return ErrInvalidRegistration
+}
+
+// PlateValidator is an interface that represents the format of the registration plates of a country
+type PlateValidator interface {
+	// ValidatePlate is a method that checks a plate normalized with NormalizeRegistration,
+	// the error is a *PlateError with the rule that failed
+	ValidatePlate(plate string) (err error)
+}
+
+// PlateFormat is a struct that represents a format of registration plates
+type PlateFormat struct {
+	// Name is the name of the format, used as the rule of its errors
+	Name string
+	// Example is a plate with the format, shown in the errors
+	Example string
+	// Pattern is the expression a normalized plate matches
+	Pattern *regexp.Regexp
+}
+
+// PlateFormats is a type that represents the formats of a country, a plate is valid if it has any of them
+type PlateFormats []PlateFormat
+
+// ValidatePlate is a method that checks that a plate has one of the formats
+func (fs PlateFormats) ValidatePlate(plate string) (err error) {
+	names := make([]string, len(fs))
+	for i, f := range fs {
+		if f.Pattern.MatchString(plate) {
+			return nil
+		}
+		names[i] = fmt.Sprintf("%s (%s)", f.Name, f.Example)
+	}
+	rule := "format"
+	if len(fs) == 1 {
+		rule = fs[0].Name
+	}
+	return &PlateError{Plate: plate, Rule: rule, Detail: "expected " + strings.Join(names, " or ")}
+}
+
+// plateCharset is the expression every plate matches, whatever its country
+var plateCharset = regexp.MustCompile(`^[\p{Lu}0-9.-]{1,12}$`)
+
+// builtinPlateFormats are the formats registered by NewPlateRegistry, by ISO 3166-1 alpha-2 code,
+// the formats of the empty code are the ones of the plates without country
+var builtinPlateFormats = map[string]PlateFormats{
+	"": {
+		{Name: "minimum", Example: "AB123", Pattern: regexp.MustCompile(`^[\p{Lu}0-9][\p{Lu}0-9.-]*[\p{Lu}0-9]$`)},
+	},
+	"AR": {
+		{Name: "mercosur", Example: "AB123CD", Pattern: regexp.MustCompile(`^[A-Z]{2}[0-9]{3}[A-Z]{2}$`)},
+		{Name: "legacy", Example: "ABC123", Pattern: regexp.MustCompile(`^[A-Z]{3}[0-9]{3}$`)},
+	},
+	"BR": {
+		{Name: "mercosur", Example: "ABC1D23", Pattern: regexp.MustCompile(`^[A-Z]{3}[0-9][A-Z][0-9]{2}$`)},
+		{Name: "legacy", Example: "ABC-1234", Pattern: regexp.MustCompile(`^[A-Z]{3}-?[0-9]{4}$`)},
+	},
+	"CO": {
+		{Name: "private", Example: "ABC123", Pattern: regexp.MustCompile(`^[A-Z]{3}[0-9]{3}$`)},
+	},
+	"DE": {
+		{Name: "kennzeichen", Example: "B-AB1234", Pattern: regexp.MustCompile(`^[A-ZÄÖÜ]{1,3}-?[A-Z]{1,2}[0-9]{1,4}[EH]?$`)},
+	},
+	"ES": {
+		{Name: "national", Example: "1234BCD", Pattern: regexp.MustCompile(`^[0-9]{4}[BCDFGHJKLMNPRSTVWXYZ]{3}$`)},
+	},
+	"FR": {
+		{Name: "siv", Example: "AB-123-CD", Pattern: regexp.MustCompile(`^[A-Z]{2}-?[0-9]{3}-?[A-Z]{2}$`)},
+	},
+	"GB": {
+		{Name: "current", Example: "AB12CDE", Pattern: regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z]{3}$`)},
+	},
+	"IT": {
+		{Name: "national", Example: "AB123CD", Pattern: regexp.MustCompile(`^[A-Z]{2}[0-9]{3}[A-Z]{2}$`)},
+	},
+	"US": {
+		{Name: "state", Example: "7ABC123", Pattern: regexp.MustCompile(`^[A-Z0-9-]{2,8}$`)},
+	},
+}
+
+// NewPlateRegistry is a function that returns a new instance of PlateRegistry with the built-in formats
+// of AR, BR, CO, DE, ES, FR, GB, IT and US, and a minimum format for the plates without country: at least two
+// characters that start and end with a letter or a digit
+func NewPlateRegistry() *PlateRegistry {
+	r := &PlateRegistry{validators: make(map[string]PlateValidator)}
+	for country, formats := range builtinPlateFormats {
+		r.Register(country, formats)
+	}
+	return r
+}
+
+// PlateRegistry is a struct that represents the validators of registration plates by country
+// it is safe for concurrent use by multiple goroutines
+type PlateRegistry struct {
+	// mu guards validators
+	mu sync.RWMutex
+	// validators are the validators by country code, in upper case, the empty code for the plates without country
+	validators map[string]PlateValidator
+}
+
+// Register is a method that sets the validator of the plates of a country, replacing the previous one,
+// the empty country sets the validator of the plates without country
+func (r *PlateRegistry) Register(country string, validator PlateValidator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.validators[strings.ToUpper(country)] = validator
+}
+
+// Validate is a method that checks the registration plate of a country, the country is not case sensitive
+// the plate is normalized with NormalizeRegistration and must only have letters, digits, dots and dashes,
+// an empty plate is not checked. A plate without country follows the validator of the empty country, if any,
+// any other country must have a validator. The error is a *PlateError with the rule that failed
+func (r *PlateRegistry) Validate(country, plate string) (err error) {
+	normalized := NormalizeRegistration(plate)
+	if normalized == "" {
+		return
+	}
+	if !plateCharset.MatchString(normalized) {
+		return &PlateError{Plate: plate, Rule: "charset", Detail: "expected up to 12 letters, digits, dots or dashes"}
+	}
+
+	r.mu.RLock()
+	validator, ok := r.validators[strings.ToUpper(country)]
+	r.mu.RUnlock()
+	if !ok {
+		if country == "" {
+			return
+		}
+		return &PlateError{Country: country, Plate: plate, Rule: "country", Detail: "no plate format is registered for the country"}
+	}
+	if err = validator.ValidatePlate(normalized); err != nil {
+		// the plate is reported as it was written
+		var plateErr *PlateError
+		if !errors.As(err, &plateErr) {
+			plateErr = &PlateError{Rule: "format", Detail: err.Error()}
+		}
+		plateErr.Country, plateErr.Plate = strings.ToUpper(country), plate
+		return plateErr
+	}
+	return
+}
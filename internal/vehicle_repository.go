@@ -1,44 +1,91 @@
 package internal
 
-import "errors"
+import "time"
 
 var (
-	// ErrAlreadyExists is an error that occurs when a vehicle already exists
-	ErrAlreadyExists = errors.New("vehicle already exists")
-	// ErrorNotFound is an error that occurs when a vehicle is not found
-	ErrorNotFound = errors.New("There is no vehicle with this characteristics")
-	// ErrInvalidQuery is an error that occurs when a query is invalid
-	ErrInvalidQuery = errors.New("repository: invalid query")
+	// ErrAlreadyExists is an error that occurs when a vehicle already exists, it is wrapped by a *VehicleConflictError
+	// that names the other vehicle
+	ErrAlreadyExists = NewError(KindConflict, "vehicle_conflict", "vehicle already exists")
+	// ErrNotFound is an error that occurs when a vehicle is not found, or no vehicle matches a query
+	ErrNotFound = NewError(KindNotFound, "vehicle_not_found", "vehicle not found")
+	// ErrAsOfExpired is an error that occurs when the vehicles are read as of a time older than the versions kept,
+	// nothing is known about them at that time
+	ErrAsOfExpired = NewError(KindNotFound, "as_of_expired", "the versions of the vehicles at as_of are no longer kept")
+	// ErrTxDone is an error that occurs when a transaction is used after it was committed or rolled back
+	ErrTxDone = NewError(KindInternal, "tx_done", "repository: transaction has already been committed or rolled back")
 )
 
+// VehicleRevision is a struct that represents the state of the vehicles of a repository
+type VehicleRevision struct {
+	// Counter is incremented on every change, it is never repeated, not even after a restart
+	Counter uint64
+	// ModifiedAt is the time of the latest change
+	ModifiedAt time.Time
+}
+
+// VehicleTx is an interface that represents a unit of work over the vehicles of a repository
+// the changes are only seen by the transaction until Commit applies all of them at once, Rollback discards them,
+// every transaction must end with one of both because other changes wait for it
+type VehicleTx interface {
+	// GetbyID is a method that returns a vehicle by id, including the changes of the transaction
+	GetbyID(id int) (vehicle Vehicle, err error)
+	// GetTrashed is a method that returns a vehicle of the trash by id, including the changes of the transaction
+	GetTrashed(id int) (vehicle Vehicle, err error)
+	// Save is a method that saves a vehicle, the id and the first version are assigned when it is saved
+	Save(vehicle *Vehicle) (err error)
+	// UpdateVehicle is a method that updates a vehicle, its version is set to the next one
+	UpdateVehicle(vehicle *Vehicle) (err error)
+	// UpdateTrashed is a method that updates a vehicle of the trash, it stays in the trash and its version is set to
+	// the next one
+	UpdateTrashed(vehicle *Vehicle) (err error)
+	// Delete is a method that moves a vehicle to the trash by id
+	Delete(id int) (err error)
+	// Restore is a method that moves a vehicle back from the trash by id and returns it
+	Restore(id int) (vehicle Vehicle, err error)
+	// Purge is a method that removes a vehicle of the trash for good by id
+	Purge(id int) (err error)
+	// Commit is a method that applies the changes of the transaction
+	Commit() (err error)
+	// Rollback is a method that discards the changes of the transaction
+	Rollback() (err error)
+}
+
 // VehicleRepository is an interface that represents a vehicle repository
+// deleted vehicles are kept in a trash until they are purged, only FindTrash and the transactions see them,
+// and every version of the vehicles is kept so they can be read as they were at a time
 type VehicleRepository interface {
 	// FindAll is a method that returns a map of all vehicles
 	FindAll() (v map[int]Vehicle, err error)
 	// GetbyID is a method that returns a vehicle by id
 	GetbyID(id int) (vehicle Vehicle, err error)
+	// GetByRegistration is a method that returns a vehicle by its registration plate, ignoring case and spaces
+	GetByRegistration(plate string) (vehicle Vehicle, err error)
 	// Save is a method that saves a vehicle
 	Save(vehicle *Vehicle) (err error)
-	//find by color and year
-	FindByColorAndYear(color string, year int) (v map[int]Vehicle, err error)
-	// FindByBrandAndYearRange is a method that returns a map of vehicles by brand and year range
-	FindByBrandAndYearRange(brand string, yearRange [2]int) (vehicle map[int]Vehicle, err error)
+	// Search is a method that returns the requested page of the vehicles that match the filter
+	Search(filter Filter, page PageRequest) (result VehiclePage, err error)
 	// VelocityAverageByBrand is a method that returns the average velocity of a vehicle by brand
 	VelocityAveragebyBrand(brand string) (average float64, err error)
 	// SaveMany is a method that saves many vehicles
 	SaveMany(vehicles []Vehicle) (err error)
-	// UpdateVehicle is a method that updates a vehicle
+	// UpdateVehicle is a method that updates a vehicle, its version is set to the next one
 	UpdateVehicle(vehicle *Vehicle) (err error)
-	//Find by type of FuelType
-	FindByFuelType(fueltype string) (vehicle map[int]Vehicle, err error)
-	//Delete is a method that deletes a vehicle by id
+	//Delete is a method that moves a vehicle to the trash by id
 	Delete(id int) (err error)
-	//Find by transmission type
-	FindByTransmission(transmission string) (vehicle map[int]Vehicle, err error)
+	// FindTrash is a method that returns the requested page of the vehicles in the trash
+	FindTrash(page PageRequest) (result VehiclePage, err error)
+	// GetAsOf is a method that returns a vehicle by id as it was at a time, it may have been deleted since
+	GetAsOf(id int, at time.Time) (vehicle Vehicle, err error)
+	// SearchAsOf is a method that returns the requested page of the vehicles that matched the filter at a time,
+	// including the ones deleted since
+	SearchAsOf(filter Filter, page PageRequest, at time.Time) (result VehiclePage, err error)
 	//Find by capacity average by brand
 	CapacityAveragebyBrand(brand string) (average float64, err error)
-	// FindQuery is a method that returns a map of vehicles by query
-	FindQuery(query map[string]any) (vehicles map[int]Vehicle, err error)
-	//FilterByWeight is a method that returns a map of vehicles by weight
-	FilterByWeight(query map[string]any) (vehicles map[int]Vehicle, err error)
+	// Stats is a method that returns the table of the groups and metrics of the vehicles that match the filter
+	// of the query
+	Stats(query StatsQuery) (result StatsResult, err error)
+	// Begin is a method that starts a transaction
+	Begin() (tx VehicleTx, err error)
+	// Revision is a method that returns the current revision of the vehicles
+	Revision() (revision VehicleRevision)
 }
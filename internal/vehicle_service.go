@@ -1,16 +1,19 @@
 package internal
 
-import "errors"
+import "time"
 
 var (
-	ErrFieldRequired        = errors.New("field required")
-	ErrVehicleAlreadyExists = errors.New("vehicle already exists")
-	ErrNotFound             = errors.New("There is no vehicle with this color and year")
-	ErrVehicleNotFound      = errors.New("Not found")
-	ErrVehicleNotUpdated    = errors.New("Vehicle not updated")
-	ErrVelocityOutOfRange   = errors.New("Velocity out of range")
+	// ErrInvalidPatch is an error that occurs when a patch can not be decoded or applied to a vehicle
+	ErrInvalidPatch = NewError(KindInvalid, "invalid_patch", "invalid patch")
+	// ErrInvalidRange is an error that occurs when the lower bound of a range is greater than the upper one
+	ErrInvalidRange = NewError(KindInvalid, "invalid_range", "invalid range")
+	// ErrVersionMismatch is an error that occurs when a change requires a version that is not the current one
+	ErrVersionMismatch = NewError(KindPrecondition, "version_mismatch", "vehicle version does not match")
 )
 
+// VehiclePatch is a function that applies a partial update to a vehicle
+type VehiclePatch func(vehicle *Vehicle) (err error)
+
 // VehicleService is an interface that represents a vehicle service
 type VehicleService interface {
 	// FindAll is a method that returns a map of all vehicles
@@ -19,26 +22,63 @@ type VehicleService interface {
 	GetByID(id int) (vehicle Vehicle, err error)
 	// Save is a method that saves a vehicle
 	Save(vehicle *Vehicle) (err error)
-	// FindByColorAndYear is a method that returns a map of vehicles by color and year
-	FindByColorAndYear(color string, year int) (vehicle map[int]Vehicle, err error)
-	// FindByBrandAndYearRange is a method that returns a map of vehicles by brand and year range
-	FindByBrandAndYearRange(brand string, yearRange [2]int) (vehicle map[int]Vehicle, err error)
+	// GetByRegistration is a method that returns a vehicle by its registration plate, ignoring case and spaces
+	GetByRegistration(plate string) (vehicle Vehicle, err error)
+	// GetByIDAsOf is a method that returns a vehicle by id as it was at a time, it may have been deleted since
+	GetByIDAsOf(id int, at time.Time) (vehicle Vehicle, err error)
+	// Search is a method that returns the requested page of the vehicles that match the filter
+	Search(filter Filter, page PageRequest) (result VehiclePage, err error)
+	// SearchAsOf is a method that returns the requested page of the vehicles that matched the filter at a time
+	SearchAsOf(filter Filter, page PageRequest, at time.Time) (result VehiclePage, err error)
+	// FindByColorAndYear is a method that returns a page of vehicles by color and year
+	FindByColorAndYear(color string, year int, page PageRequest) (result VehiclePage, err error)
+	// FindByBrandAndYearRange is a method that returns a page of vehicles by brand and year range
+	FindByBrandAndYearRange(brand string, yearRange [2]int, page PageRequest) (result VehiclePage, err error)
 	// VelocityAverageByBrand is a method that returns the average velocity of a vehicle by brand
 	VelocityAveragebyBrand(brand string) (average float64, err error)
-	// SaveMany is a method that saves many vehicles
+	// SaveMany is a method that saves many vehicles, all or nothing
 	SaveMany(vehicles []Vehicle) (err error)
-	// UpdateVehicle is a method that updates a vehicle
+	// SaveEach is a method that saves every vehicle on its own and returns the error of each one
+	SaveEach(vehicles []Vehicle) (errs []error)
+	// UpdateVehicle is a method that updates a vehicle, its version, if not zero, must be the current one
 	UpdateVehicle(vehicle *Vehicle) (err error)
+	// PatchVehicle is a method that applies a patch to a vehicle and returns the updated vehicle
+	// version, if not zero, must be the current version of the vehicle
+	PatchVehicle(id int, version int, patch VehiclePatch) (vehicle Vehicle, err error)
 	//Find by type of FuelType
-	FindByFuelType(fueltype string) (vehicle map[int]Vehicle, err error)
-	//Delete is a method that deletes a vehicle by id
-	Delete(id int) (err error)
+	FindByFuelType(fueltype string, page PageRequest) (result VehiclePage, err error)
+	//Delete is a method that moves a vehicle to the trash by id, version, if not zero, must be the current version of the vehicle
+	Delete(id int, version int) (err error)
+	// FindTrash is a method that returns the requested page of the vehicles in the trash
+	FindTrash(page PageRequest) (result VehiclePage, err error)
+	// Restore is a method that moves a vehicle back from the trash and returns it
+	Restore(id int) (vehicle Vehicle, err error)
+	// Purge is a method that removes a vehicle of the trash for good
+	Purge(id int) (err error)
+	// PurgeTrash is a method that purges the vehicles moved to the trash before a time and returns how many were purged
+	PurgeTrash(before time.Time) (purged int, err error)
 	//Find by transmission type
-	FindByTransmission(transmission string) (vehicle map[int]Vehicle, err error)
+	FindByTransmission(transmission string, page PageRequest) (result VehiclePage, err error)
 	//Find by capacity average by brand
 	CapacityAveragebyBrand(brand string) (average float64, err error)
-	// FindQuery is a method that returns a map of vehicles by query
-	FindQuery(query map[string]any) (vehicle map[int]Vehicle, err error)
-	//FilterByWeight is a method that returns a map of vehicles by weight
-	FilterByWeight(query map[string]any) (vehicle map[int]Vehicle, err error)
+	// FindByDimensions is a method that returns a page of vehicles by ranges of their dimensions
+	FindByDimensions(query map[string]any, page PageRequest) (result VehiclePage, err error)
+	//FilterByWeight is a method that returns a page of vehicles by weight
+	FilterByWeight(query map[string]any, page PageRequest) (result VehiclePage, err error)
+	// Stats is a method that returns the table of the groups and metrics of the vehicles that match the filter
+	// of the query
+	Stats(query StatsQuery) (result StatsResult, err error)
+	// Vocabularies is a method that returns the vocabularies of the text fields of the vehicles
+	Vocabularies() (vocabularies Vocabularies)
+	// Canonicalize is a method that sets the fields of the stored vehicles to their canonical values and returns how
+	// many vehicles were changed, the ones that can not be changed are kept as they are and err joins their errors
+	Canonicalize() (changed int, err error)
+	// Revision is a method that returns the current revision of the vehicles
+	Revision() (revision VehicleRevision)
+	// As is a method that returns the service for the changes made by an actor, recorded in the audit trail
+	As(actor string) (sv VehicleService)
+	// History is a method that returns the audit entries of a vehicle, oldest first
+	History(id int) (entries []AuditEntry, err error)
+	// Audit is a method that returns the audit entries of every vehicle made at or after a time, oldest first
+	Audit(since time.Time) (entries []AuditEntry, err error)
 }
@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidStats is an error that occurs when the groups or the metrics of a stats query are not valid
+	ErrInvalidStats = NewError(KindInvalid, "invalid_stats", "invalid stats query")
+)
+
+// Aggregate is a type that represents the function of a metric
+type Aggregate string
+
+const (
+	// AggregateCount is the number of vehicles, it has no field
+	AggregateCount Aggregate = "count"
+	// AggregateSum is the sum of the values of a numeric field
+	AggregateSum Aggregate = "sum"
+	// AggregateAvg is the average of the values of a numeric field
+	AggregateAvg Aggregate = "avg"
+	// AggregateMin is the lowest value of a numeric field
+	AggregateMin Aggregate = "min"
+	// AggregateMax is the greatest value of a numeric field
+	AggregateMax Aggregate = "max"
+)
+
+// Metric is a struct that represents a value computed over the vehicles of a group
+type Metric struct {
+	// Aggregate is the function of the metric
+	Aggregate Aggregate
+	// Field is the name of the numeric field aggregated, one of VehicleFields, empty for count
+	Field string
+}
+
+// String is a method that returns the metric in the format of ParseMetrics, e.g. avg(max_speed) or count
+func (m Metric) String() string {
+	if m.Field == "" {
+		return string(m.Aggregate)
+	}
+	return string(m.Aggregate) + "(" + m.Field + ")"
+}
+
+// ParseMetrics is a function that parses a comma separated list of metrics, e.g. avg(max_speed),count
+func ParseMetrics(s string) (metrics []Metric, err error) {
+	if s == "" {
+		return
+	}
+	for _, text := range strings.Split(s, ",") {
+		text = strings.TrimSpace(text)
+		var m Metric
+		name, field, ok := strings.Cut(text, "(")
+		switch {
+		case !ok:
+			m.Aggregate = Aggregate(name)
+		case strings.HasSuffix(field, ")"):
+			m.Aggregate, m.Field = Aggregate(strings.TrimSpace(name)), strings.TrimSpace(strings.TrimSuffix(field, ")"))
+		default:
+			return nil, ErrInvalidStats.Errorf("metrics", "malformed metric %q", text)
+		}
+		metrics = append(metrics, m)
+	}
+	return
+}
+
+// StatsQuery is a struct that represents the aggregation of the vehicles that match a filter
+// the vehicles are grouped by the values of the group fields and every metric is computed for each group,
+// the values of the folded fields are grouped ignoring case and accents
+type StatsQuery struct {
+	// GroupBy are the names of the fields the vehicles are grouped by, one of VehicleFields, a single group of
+	// every vehicle when empty
+	GroupBy []string
+	// Metrics are the values computed for each group, count when empty
+	Metrics []Metric
+	// Filter selects the vehicles aggregated
+	Filter Filter
+}
+
+// StatsColumn is a struct that represents a column of a stats result
+type StatsColumn struct {
+	// Name is the name of the group field or the metric, in the format of ParseMetrics
+	Name string
+	// Kind is the kind of the values of the column
+	Kind FieldKind
+}
+
+// StatsResult is a struct that represents the table of a stats query
+// a row has the values of the group fields followed by the values of the metrics, ordered by the group values,
+// a metric is nil when the group has no value for it, like the average of no vehicles
+type StatsResult struct {
+	// Columns are the group fields followed by the metrics
+	Columns []StatsColumn
+	// Rows are the values of each group, in the order of the columns
+	Rows [][]any
+}
+
+// Validate is a method that checks the groups, the metrics and the filter of the query
+func (q StatsQuery) Validate() (err error) {
+	seen := make(map[string]bool, len(q.GroupBy))
+	for _, name := range q.GroupBy {
+		if _, ok := VehicleFields[name]; !ok {
+			return ErrInvalidStats.Errorf("group_by", "unknown field %q", name)
+		}
+		if seen[name] {
+			return ErrInvalidStats.Errorf("group_by", "field %q is repeated", name)
+		}
+		seen[name] = true
+	}
+	for _, m := range q.Metrics {
+		switch m.Aggregate {
+		case AggregateCount:
+			if m.Field != "" {
+				return ErrInvalidStats.Errorf("metrics", "count has no field")
+			}
+		case AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+			field, ok := VehicleFields[m.Field]
+			if !ok {
+				return ErrInvalidStats.Errorf("metrics", "%s: unknown field %q", m.Aggregate, m.Field)
+			}
+			if field.Kind != FieldNumber {
+				return ErrInvalidStats.Errorf("metrics", "%s requires a numeric field, %q is text", m.Aggregate, m.Field)
+			}
+		default:
+			return ErrInvalidStats.Errorf("metrics", "unknown aggregate %q", m.Aggregate)
+		}
+	}
+	err = q.Filter.Validate()
+	return
+}
+
+// metrics is a method that returns the metrics of the query, count when it has none
+func (q StatsQuery) metrics() []Metric {
+	if len(q.Metrics) == 0 {
+		return []Metric{{Aggregate: AggregateCount}}
+	}
+	return q.Metrics
+}
+
+// statsGroup is a struct that represents the running values of the metrics of a group
+type statsGroup struct {
+	// values are the values of the group fields, the ones of the vehicle with the lowest id
+	values []any
+	// keys are the normalized values of the group fields
+	keys []any
+	// count is the number of vehicles of the group
+	count int
+	// sums, mins and maxs are the running values of each metric, the ones that do not use them are left zero
+	sums []float64
+	mins []float64
+	maxs []float64
+}
+
+// Apply is a method that aggregates the vehicles, they must already match the filter of the query
+// the vehicles slice is sorted in place by id
+func (q StatsQuery) Apply(vehicles []Vehicle) (result StatsResult, err error) {
+	if err = q.Validate(); err != nil {
+		return
+	}
+	metrics := q.metrics()
+
+	// columns
+	for _, name := range q.GroupBy {
+		result.Columns = append(result.Columns, StatsColumn{Name: name, Kind: VehicleFields[name].Kind})
+	}
+	for _, m := range metrics {
+		result.Columns = append(result.Columns, StatsColumn{Name: m.String(), Kind: FieldNumber})
+	}
+
+	// groups, the vehicles are read by id so the values shown for a group do not change between requests
+	sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].Id < vehicles[j].Id })
+	groups := make(map[string]*statsGroup)
+	var order []*statsGroup
+	for _, v := range vehicles {
+		values := make([]any, len(q.GroupBy))
+		keys := make([]any, len(q.GroupBy))
+		for i, name := range q.GroupBy {
+			field := VehicleFields[name]
+			values[i] = field.Value(v)
+			keys[i] = field.Normalize(values[i])
+		}
+		// the keys are strings and numbers, their encoding identifies the group
+		b, _ := json.Marshal(keys)
+		g, ok := groups[string(b)]
+		if !ok {
+			g = &statsGroup{
+				values: values,
+				keys:   keys,
+				sums:   make([]float64, len(metrics)),
+				mins:   make([]float64, len(metrics)),
+				maxs:   make([]float64, len(metrics)),
+			}
+			groups[string(b)] = g
+			order = append(order, g)
+		}
+		for i, m := range metrics {
+			if m.Field == "" {
+				continue
+			}
+			value := VehicleFields[m.Field].Value(v).(float64)
+			g.sums[i] += value
+			if g.count == 0 || value < g.mins[i] {
+				g.mins[i] = value
+			}
+			if g.count == 0 || value > g.maxs[i] {
+				g.maxs[i] = value
+			}
+		}
+		g.count++
+	}
+	// - every vehicle is a single group, even when there is none
+	if len(q.GroupBy) == 0 && len(order) == 0 {
+		order = append(order, &statsGroup{
+			sums: make([]float64, len(metrics)),
+			mins: make([]float64, len(metrics)),
+			maxs: make([]float64, len(metrics)),
+		})
+	}
+
+	// rows, ordered by the group values
+	sort.SliceStable(order, func(i, j int) bool {
+		for k := range q.GroupBy {
+			if c := compareValues(order[i].keys[k], order[j].keys[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	result.Rows = make([][]any, len(order))
+	for i, g := range order {
+		row := append(make([]any, 0, len(result.Columns)), g.values...)
+		for j, m := range metrics {
+			row = append(row, g.metric(j, m))
+		}
+		result.Rows[i] = row
+	}
+	return
+}
+
+// metric is a method that returns the value of the metric at an index of the query, nil when the group is empty
+// and the metric has no value
+func (g *statsGroup) metric(i int, m Metric) any {
+	switch m.Aggregate {
+	case AggregateCount:
+		return g.count
+	case AggregateSum:
+		return g.sums[i]
+	}
+	if g.count == 0 {
+		return nil
+	}
+	switch m.Aggregate {
+	case AggregateAvg:
+		return g.sums[i] / float64(g.count)
+	case AggregateMin:
+		return g.mins[i]
+	case AggregateMax:
+		return g.maxs[i]
+	}
+	return nil
+}
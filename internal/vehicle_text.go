@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// FoldText is a function that returns the form of a text used to compare it ignoring case and accents,
+// so "Citroën", "CITROEN" and "citroen" are the same text. The text is decomposed, its combining marks are
+// removed and it is case folded, the result is only meant for comparisons and is never stored
+func FoldText(s string) string {
+	// transformers keep state, they are created for every call so it is safe for concurrent use
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), cases.Fold(), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+	return folded
+}
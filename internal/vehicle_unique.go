@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// UniqueKey is a type that represents a value of a vehicle that no two vehicles can share
+type UniqueKey string
+
+const (
+	// UniqueRegistration is the key of the registration plate, normalized with NormalizeRegistration
+	UniqueRegistration UniqueKey = "registration"
+	// UniqueBrandModelYear is the key of the brand, the model and the fabrication year together, the brand and the
+	// model are compared ignoring case and accents
+	UniqueBrandModelYear UniqueKey = "brand_model_year"
+)
+
+// UniqueKeys are the keys a UniquenessPolicy can enforce
+var UniqueKeys = []UniqueKey{UniqueRegistration, UniqueBrandModelYear}
+
+// Value is a method that returns the value of the key for a vehicle, empty when the vehicle has no value for it,
+// vehicles without a value never conflict
+func (k UniqueKey) Value(v Vehicle) string {
+	switch k {
+	case UniqueRegistration:
+		return NormalizeRegistration(v.Registration)
+	case UniqueBrandModelYear:
+		return FoldText(v.Brand) + "\x00" + FoldText(v.Model) + "\x00" + strconv.Itoa(v.FabricationYear)
+	}
+	return ""
+}
+
+// NormalizeRegistration is a function that returns a registration plate in upper case and without spaces,
+// so "ab 123" and "AB123" are the same plate
+func NormalizeRegistration(plate string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, plate)
+}
+
+// UniquenessPolicy is a type that represents the unique keys enforced when vehicles are saved, updated or restored
+type UniquenessPolicy []UniqueKey
+
+// DefaultUniquenessPolicy is the policy used when none is configured, the registration is the only unique key
+var DefaultUniquenessPolicy = UniquenessPolicy{UniqueRegistration}
+
+// VehicleConflictError is an error that occurs when a vehicle has the same unique key as another vehicle
+// it wraps ErrAlreadyExists
+type VehicleConflictError struct {
+	// Key is the unique key both vehicles share
+	Key UniqueKey
+	// Id is the id of the other vehicle
+	Id int
+}
+
+// Error is a method that returns the error message
+func (e *VehicleConflictError) Error() string {
+	return fmt.Sprintf("%s: vehicle %d has the same %s", ErrAlreadyExists, e.Id, e.Key)
+}
+
+// Unwrap is a method that returns ErrAlreadyExists
+func (e *VehicleConflictError) Unwrap() error {
+	return ErrAlreadyExists
+}
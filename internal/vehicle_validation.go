@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ErrInvalidVehicle is an error that occurs when a vehicle breaks its validation rules
+	ErrInvalidVehicle = NewError(KindInvalid, "invalid_vehicle", "invalid vehicle")
+	// ErrInvalidRules is an error that occurs when validation rules are not well formed
+	ErrInvalidRules = NewError(KindInvalid, "invalid_rules", "invalid validation rules")
+)
+
+// FieldRule is a struct that represents the constraints of a field of a vehicle
+// an empty value, "" or 0, is the value of a field that is not set, it only breaks Required and the other
+// constraints are not checked for it, so a rule sets Required to enforce its bounds on every vehicle: with min 1
+// alone a vehicle without passengers is valid, with required and min 1 it is not
+type FieldRule struct {
+	// Required is true when the field can not be empty
+	Required bool
+	// Min is the lowest value of a numeric field, nil when there is none
+	Min *float64
+	// Max is the greatest value of a numeric field, nil when there is none
+	Max *float64
+	// Enum are the only values of a text field, any value is valid when it is empty
+	Enum []string
+	// Pattern is the expression the value of a text field matches, nil when there is none
+	Pattern *regexp.Regexp
+}
+
+// CrossFieldRule is a struct that represents a constraint between fields of a vehicle
+// the vehicles that match When must match Assert, for example When eq(fuel_type,electric) and Assert
+// ne(transmission,manual)
+type CrossFieldRule struct {
+	// Name is the name of the rule
+	Name string
+	// Field is the field the violation is reported for
+	Field string
+	// When selects the vehicles the rule applies to, the zero value selects every vehicle
+	When Filter
+	// Assert is the filter the vehicles must match
+	Assert Filter
+	// Message is the message of the violation, the name of the rule is used when it is empty
+	Message string
+}
+
+// ValidationRules is a struct that represents every constraint of a vehicle
+type ValidationRules struct {
+	// Fields are the constraints by field name, one of VehicleFields
+	Fields map[string]FieldRule
+	// Rules are the constraints between fields
+	Rules []CrossFieldRule
+}
+
+// DefaultValidationRules are the rules used when none are configured, the fields that every vehicle needs
+var DefaultValidationRules = &ValidationRules{
+	Fields: map[string]FieldRule{
+		"brand":        {Required: true},
+		"model":        {Required: true},
+		"color":        {Required: true},
+		"year":         {Required: true},
+		"passengers":   {Required: true},
+		"transmission": {Required: true},
+		"max_speed":    {Required: true},
+	},
+}
+
+// Check is a method that checks that the rules are well formed, the fields must exist and their constraints
+// must be of their kind
+func (rs *ValidationRules) Check() (err error) {
+	for name, rule := range rs.Fields {
+		field, ok := VehicleFields[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidRules, name)
+		}
+		switch field.Kind {
+		case FieldString:
+			if rule.Min != nil || rule.Max != nil {
+				return fmt.Errorf("%w: min and max require a numeric field, %q is text", ErrInvalidRules, name)
+			}
+		case FieldNumber:
+			if len(rule.Enum) > 0 || rule.Pattern != nil {
+				return fmt.Errorf("%w: enum and pattern require a text field, %q is numeric", ErrInvalidRules, name)
+			}
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return fmt.Errorf("%w: min of %q is greater than its max", ErrInvalidRules, name)
+		}
+	}
+	for _, rule := range rs.Rules {
+		if _, ok := VehicleFields[rule.Field]; !ok {
+			return fmt.Errorf("%w: rule %q: unknown field %q", ErrInvalidRules, rule.Name, rule.Field)
+		}
+		if err = rule.When.Validate(); err != nil {
+			return fmt.Errorf("%w: rule %q: when: %w", ErrInvalidRules, rule.Name, err)
+		}
+		if err = rule.Assert.Validate(); err != nil {
+			return fmt.Errorf("%w: rule %q: assert: %w", ErrInvalidRules, rule.Name, err)
+		}
+	}
+	return
+}
+
+// Validate is a method that checks every rule and returns the violations by field, nil when there is none
+// the rules must be well formed
+func (rs *ValidationRules) Validate(v Vehicle) (violations map[string][]string) {
+	add := func(field, message string) {
+		if violations == nil {
+			violations = make(map[string][]string)
+		}
+		violations[field] = append(violations[field], message)
+	}
+
+	for name, rule := range rs.Fields {
+		switch value := VehicleFields[name].Value(v).(type) {
+		case string:
+			switch {
+			case value == "":
+				if rule.Required {
+					add(name, "is required")
+				}
+			case len(rule.Enum) > 0 && !containsString(rule.Enum, value):
+				add(name, "must be one of "+strings.Join(rule.Enum, ", "))
+			case rule.Pattern != nil && !rule.Pattern.MatchString(value):
+				add(name, "must match "+rule.Pattern.String())
+			}
+		case float64:
+			switch {
+			case value == 0:
+				if rule.Required {
+					add(name, "is required")
+				}
+			case rule.Min != nil && value < *rule.Min:
+				add(name, fmt.Sprintf("must be at least %v", *rule.Min))
+			case rule.Max != nil && value > *rule.Max:
+				add(name, fmt.Sprintf("must be at most %v", *rule.Max))
+			}
+		}
+	}
+	for _, rule := range rs.Rules {
+		if rule.When.Match(v) && !rule.Assert.Match(v) {
+			message := rule.Message
+			if message == "" {
+				message = "breaks rule " + rule.Name
+			}
+			add(rule.Field, message)
+		}
+	}
+	return
+}
+
+// containsString is a function that returns whether a slice has a string
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError is an error that occurs when a vehicle breaks some of its rules, it wraps ErrInvalidVehicle
+// and the errors of the violations that have one
+type ValidationError struct {
+	// Fields are the messages of the violations by field name
+	Fields map[string][]string
+	// Causes are the errors behind some violations, like a *PlateError
+	Causes []error
+}
+
+// Error is a method that returns the error message, the violations ordered by field
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	violations := make([]string, len(names))
+	for i, name := range names {
+		violations[i] = name + " " + strings.Join(e.Fields[name], ", ")
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidVehicle, strings.Join(violations, "; "))
+}
+
+// Unwrap is a method that returns ErrInvalidVehicle and the causes of the violations
+func (e *ValidationError) Unwrap() []error {
+	return append([]error{ErrInvalidVehicle}, e.Causes...)
+}
+
+// ValidationRulesLoader is an interface that represents the loader for validation rules
+type ValidationRulesLoader interface {
+	// Load is a method that loads the rules, they are not checked
+	Load() (rules *ValidationRules, err error)
+}
+
+// NewVehicleValidator is a function that returns a new instance of VehicleValidator
+func NewVehicleValidator(rules *ValidationRules) *VehicleValidator {
+	v := &VehicleValidator{}
+	v.rules.Store(rules)
+	return v
+}
+
+// VehicleValidator is a struct that validates vehicles with rules that can be replaced while it is in use
+// it is safe for concurrent use by multiple goroutines
+type VehicleValidator struct {
+	// rules are the current rules
+	rules atomic.Pointer[ValidationRules]
+}
+
+// Rules is a method that returns the current rules
+func (v *VehicleValidator) Rules() *ValidationRules {
+	return v.rules.Load()
+}
+
+// Reload is a method that loads the rules and replaces the current ones, which are kept when the rules can not be
+// loaded or are not well formed
+func (v *VehicleValidator) Reload(l ValidationRulesLoader) (err error) {
+	rules, err := l.Load()
+	if err != nil {
+		return
+	}
+	err = v.SetRules(rules)
+	return
+}
+
+// SetRules is a method that replaces the rules, they are checked first and kept when they are not well formed
+func (v *VehicleValidator) SetRules(rules *ValidationRules) (err error) {
+	if err = rules.Check(); err != nil {
+		return
+	}
+	v.rules.Store(rules)
+	return
+}
+
+// Validate is a method that returns the violations of the current rules by field, nil when there is none
+func (v *VehicleValidator) Validate(vehicle Vehicle) (violations map[string][]string) {
+	violations = v.rules.Load().Validate(vehicle)
+	return
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// TestValidationRules_Check checks that the rules that are not well formed are rejected with ErrInvalidRules
+func TestValidationRules_Check(t *testing.T) {
+	one, two := 1.0, 2.0
+	cases := []struct {
+		name  string
+		rules ValidationRules
+		valid bool
+	}{
+		{name: "default", rules: *DefaultValidationRules, valid: true},
+		{name: "bounds", rules: ValidationRules{Fields: map[string]FieldRule{"year": {Min: &one, Max: &two}}}, valid: true},
+		{name: "equal bounds", rules: ValidationRules{Fields: map[string]FieldRule{"year": {Min: &one, Max: &one}}}, valid: true},
+		{name: "min greater than max", rules: ValidationRules{Fields: map[string]FieldRule{"year": {Min: &two, Max: &one}}}},
+		{name: "unknown field", rules: ValidationRules{Fields: map[string]FieldRule{"price": {Required: true}}}},
+		{name: "bounds of a text field", rules: ValidationRules{Fields: map[string]FieldRule{"brand": {Min: &one}}}},
+		{name: "enum of a numeric field", rules: ValidationRules{Fields: map[string]FieldRule{"year": {Enum: []string{"2000"}}}}},
+		{name: "pattern of a numeric field", rules: ValidationRules{Fields: map[string]FieldRule{"year": {Pattern: regexp.MustCompile(`^2`)}}}},
+		{name: "rule of an unknown field", rules: ValidationRules{Rules: []CrossFieldRule{{Name: "r", Field: "price"}}}},
+		{name: "rule with an invalid filter", rules: ValidationRules{Rules: []CrossFieldRule{{Name: "r", Field: "brand", Assert: Filter{Op: FilterEq, Field: "price", Values: []any{"x"}}}}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.rules.Check()
+			if c.valid && err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			if !c.valid && !errors.Is(err, ErrInvalidRules) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidRules)
+			}
+		})
+	}
+}
+
+// TestValidationRules_Validate checks the violations of the field rules and of the rules between fields, the
+// constraints of an empty value are only checked when it is required
+func TestValidationRules_Validate(t *testing.T) {
+	one, five := 1.0, 5.0
+	rules := &ValidationRules{
+		Fields: map[string]FieldRule{
+			"passengers": {Min: &one, Max: &five},
+			"year":       {Required: true, Min: &one},
+			"color":      {Enum: []string{"Red", "Blue"}},
+			"model":      {Pattern: regexp.MustCompile(`^[A-Z]`)},
+		},
+		Rules: []CrossFieldRule{{
+			Name:   "electric_transmission",
+			Field:  "transmission",
+			When:   Filter{Op: FilterEq, Field: "fuel_type", Values: []any{"electric"}},
+			Assert: Filter{Op: FilterNe, Field: "transmission", Values: []any{"manual"}},
+		}},
+	}
+	vehicle := func(change func(v *VehicleAttributes)) Vehicle {
+		v := Vehicle{VehicleAttributes: VehicleAttributes{Model: "Focus", Color: "Red", FabricationYear: 2015, Capacity: 5, FuelType: "electric", Transmission: "automatic"}}
+		change(&v.VehicleAttributes)
+		return v
+	}
+	cases := []struct {
+		name       string
+		vehicle    Vehicle
+		violations map[string][]string
+	}{
+		{name: "valid", vehicle: vehicle(func(v *VehicleAttributes) {})},
+		{name: "optional bounds not set", vehicle: vehicle(func(v *VehicleAttributes) { v.Capacity = 0 })},
+		{name: "optional text not set", vehicle: vehicle(func(v *VehicleAttributes) { v.Color, v.Model = "", "" })},
+		{name: "required bounds not set", vehicle: vehicle(func(v *VehicleAttributes) { v.FabricationYear = 0 }), violations: map[string][]string{"year": {"is required"}}},
+		{name: "below min", vehicle: vehicle(func(v *VehicleAttributes) { v.Capacity = -1 }), violations: map[string][]string{"passengers": {"must be at least 1"}}},
+		{name: "above max", vehicle: vehicle(func(v *VehicleAttributes) { v.Capacity = 6 }), violations: map[string][]string{"passengers": {"must be at most 5"}}},
+		{name: "not in enum", vehicle: vehicle(func(v *VehicleAttributes) { v.Color = "Green" }), violations: map[string][]string{"color": {"must be one of Red, Blue"}}},
+		{name: "pattern", vehicle: vehicle(func(v *VehicleAttributes) { v.Model = "focus" }), violations: map[string][]string{"model": {"must match ^[A-Z]"}}},
+		{name: "cross field", vehicle: vehicle(func(v *VehicleAttributes) { v.Transmission = "manual" }), violations: map[string][]string{"transmission": {"breaks rule electric_transmission"}}},
+		{name: "cross field not selected", vehicle: vehicle(func(v *VehicleAttributes) { v.FuelType, v.Transmission = "diesel", "manual" })},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := rules.Validate(c.vehicle); !reflect.DeepEqual(got, c.violations) {
+				t.Fatalf("violations %v, want %v", got, c.violations)
+			}
+		})
+	}
+}